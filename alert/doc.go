@@ -0,0 +1,2 @@
+// Package alert implements threshold alert rules over performance data.
+package alert
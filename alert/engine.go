@@ -0,0 +1,266 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/w-sdc/mushroomant/sysinfo"
+)
+
+// State is the state of an alert
+type State string
+
+// States of alerts
+const (
+	StatePending  State = "pending"
+	StateFiring   State = "firing"
+	StateResolved State = "resolved"
+	// StateInactive is reported when a pending alert is cleared before
+	// firing
+	StateInactive State = "inactive"
+)
+
+// Alert is the state of a rule
+type Alert struct {
+	Rule     string  `json:"rule"`
+	Severity string  `json:"severity,omitempty"`
+	Summary  string  `json:"summary,omitempty"`
+	State    State   `json:"state"`
+	Value    float64 `json:"value"`
+	// timestamps in unix milliseconds
+	ActiveAt   int64 `json:"active_at"`
+	FiredAt    int64 `json:"fired_at,omitempty"`
+	ResolvedAt int64 `json:"resolved_at,omitempty"`
+}
+
+// Subscriber receives the state changes of alerts
+type Subscriber interface {
+	OnAlert(a Alert)
+}
+
+// SubscriberFunc is an adapter to use a function as Subscriber
+type SubscriberFunc func(a Alert)
+
+// OnAlert implements Subscriber
+func (f SubscriberFunc) OnAlert(a Alert) {
+	f(a)
+}
+
+// Engine evaluates alert rules against PerfStat snapshots
+type Engine struct {
+	mtx    sync.Mutex
+	rules  []Rule
+	active map[string]*Alert // active alerts keyed by rule name
+	subs   map[int]Subscriber
+	nextID int
+}
+
+// NewEngine creates an Engine with the rules
+func NewEngine(rules []Rule) *Engine {
+	return &Engine{
+		rules:  rules,
+		active: make(map[string]*Alert),
+		subs:   make(map[int]Subscriber),
+	}
+}
+
+// Subscribe registers a Subscriber to receive state changes of alerts.
+// Subscribers are called synchronously in Eval and should not block.
+// The returned function unregisters the subscriber.
+func (e *Engine) Subscribe(s Subscriber) func() {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	id := e.nextID
+	e.nextID++
+	e.subs[id] = s
+	return func() {
+		e.mtx.Lock()
+		defer e.mtx.Unlock()
+		delete(e.subs, id)
+	}
+}
+
+// Active returns the pending and firing alerts ordered by rule name
+func (e *Engine) Active() []Alert {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	ret := make([]Alert, 0, len(e.active))
+	for _, a := range e.active {
+		ret = append(ret, *a)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Rule < ret[j].Rule })
+	return ret
+}
+
+// Eval evaluates all rules against a snapshot, the container info is used
+// to resolve containers by name. The timestamp of the snapshot is used as
+// the current time, so that recorded timelines are evaluated in their own
+// time. It returns the state changes.
+func (e *Engine) Eval(
+	stat sysinfo.PerfStat,
+	cinfo map[string]sysinfo.ContianerInfo,
+) []Alert {
+	now := stat.TS
+	if now == 0 {
+		now = time.Now().UnixMilli()
+	}
+	doc := toDoc(stat)
+
+	e.mtx.Lock()
+	var changes []Alert
+	for i := range e.rules {
+		r := &e.rules[i]
+		a, isActive := e.active[r.Name]
+		v, ok := lookup(doc, r.Path, cinfo)
+		firing := isActive && a.State == StateFiring
+		match := ok && r.match(v, firing)
+		switch {
+		case match && !isActive:
+			a = &Alert{
+				Rule: r.Name, Severity: r.Severity, Summary: r.Summary,
+				State: StatePending, Value: v, ActiveAt: now,
+			}
+			e.active[r.Name] = a
+			changes = append(changes, *a)
+		case !match && isActive:
+			if firing {
+				a.State = StateResolved
+				a.ResolvedAt = now
+			} else {
+				a.State = StateInactive
+			}
+			if ok {
+				a.Value = v
+			}
+			delete(e.active, r.Name)
+			changes = append(changes, *a)
+			continue
+		case match:
+			a.Value = v
+		default:
+			continue
+		}
+		if a.State == StatePending && now-a.ActiveAt >= r.For.Milliseconds() {
+			a.State = StateFiring
+			a.FiredAt = now
+			if len(changes) == 0 || changes[len(changes)-1].Rule != r.Name {
+				changes = append(changes, *a)
+			} else {
+				changes[len(changes)-1] = *a
+			}
+		}
+	}
+	subs := make([]Subscriber, 0, len(e.subs))
+	for _, s := range e.subs {
+		subs = append(subs, s)
+	}
+	e.mtx.Unlock()
+
+	for _, c := range changes {
+		for _, s := range subs {
+			s.OnAlert(c)
+		}
+	}
+	return changes
+}
+
+// Replay evaluates a recorded timeline, whose stats are in descending order
+// of time, and returns all state changes.
+func (e *Engine) Replay(tl sysinfo.PerfTimeline) []Alert {
+	var ret []Alert
+	for i := len(tl.Stats) - 1; i >= 0; i-- {
+		ret = append(ret, e.Eval(tl.Stats[i], tl.CInfo)...)
+	}
+	return ret
+}
+
+// Run evaluates the current snapshot of the manager every interval of the
+// clock until the context is done, sysinfo.SystemClock is used if clock is
+// nil.
+func (e *Engine) Run(
+	ctx context.Context,
+	mgr sysinfo.PerfTimelineMgr,
+	interval time.Duration,
+	clock sysinfo.Clock,
+) {
+	if clock == nil {
+		clock = sysinfo.SystemClock
+	}
+	ticker := clock.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			stat := mgr.Current()
+			stat.TS = clock.Now().UnixMilli()
+			e.Eval(stat, mgr.Containers())
+		}
+	}
+}
+
+// toDoc converts a snapshot to a generic document by its JSON form, so that
+// paths follow the JSON names.
+func toDoc(stat sysinfo.PerfStat) map[string]any {
+	var doc map[string]any
+	data, _ := json.Marshal(stat)
+	json.Unmarshal(data, &doc)
+	return doc
+}
+
+// lookup resolves a path in the document to a number
+func lookup(
+	doc map[string]any,
+	path []PathElem,
+	cinfo map[string]sysinfo.ContianerInfo,
+) (float64, bool) {
+	var cur any = doc
+	var field string
+	for _, p := range path {
+		switch c := cur.(type) {
+		case map[string]any:
+			key := p.Field
+			if p.IsKey {
+				key = p.Key
+			}
+			v, ok := c[key]
+			if !ok && p.IsKey && field == "c_stat" {
+				// refer container by name
+				for id, info := range cinfo {
+					if info.Name == key {
+						v, ok = c[id]
+						break
+					}
+				}
+			}
+			if !ok {
+				return 0, false
+			}
+			cur = v
+		case []any:
+			i, err := strconv.Atoi(p.Key)
+			if !p.IsKey || err != nil || i < 0 || i >= len(c) {
+				return 0, false
+			}
+			cur = c[i]
+		default:
+			return 0, false
+		}
+		field = p.Field
+	}
+	switch v := cur.(type) {
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,192 @@
+package alert
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/w-sdc/mushroomant/sysinfo"
+)
+
+// recordTimeline builds a timeline in descending order of time from the
+// CPU and container memory values of every second
+func recordTimeline(cpu []float32, mem []uint64) sysinfo.PerfTimeline {
+	tl := sysinfo.PerfTimeline{
+		Interval: 1000,
+		CInfo: map[string]sysinfo.ContianerInfo{
+			"abc123": {ID: "abc123", Name: "palworld", Runing: true},
+		},
+	}
+	for i := len(cpu) - 1; i >= 0; i-- {
+		tl.Stats = append(tl.Stats, sysinfo.PerfStat{
+			TS:  int64(i) * 1000,
+			CPU: &sysinfo.CPUStat{Total: cpu[i], Core: []float32{cpu[i]}},
+			CStat: map[string]sysinfo.ContainerStat{
+				"abc123": {MemUsed: mem[i]},
+			},
+		})
+	}
+	return tl
+}
+
+func TestParseRule(t *testing.T) {
+	Convey("Test rule parsing", t, func() {
+		r, err := ParseRule("cpu", "cpu.total > 90 for 5m clear 80")
+		So(err, ShouldBeNil)
+		So(r.Path, ShouldResemble, []PathElem{{Field: "cpu"}, {Field: "total"}})
+		So(r.Op, ShouldEqual, ">")
+		So(r.Value, ShouldEqual, 90)
+		So(r.Clear, ShouldEqual, 80)
+		So(r.For, ShouldEqual, 5*time.Minute)
+
+		r, err = ParseRule("mem", "c_stat[palworld].mem_used >= 14GiB for 1m")
+		So(err, ShouldBeNil)
+		So(r.Path, ShouldResemble, []PathElem{
+			{Field: "c_stat"}, {Key: "palworld", IsKey: true},
+			{Field: "mem_used"},
+		})
+		So(r.Op, ShouldEqual, ">=")
+		So(r.Value, ShouldEqual, 14<<30)
+		So(r.Clear, ShouldEqual, 14<<30)
+
+		r, err = ParseRule("disk", "disk_usage[/data > x].used<1.5GB")
+		So(err, ShouldBeNil)
+		So(r.Path[1].Key, ShouldEqual, "/data > x")
+		So(r.Op, ShouldEqual, "<")
+		So(r.Value, ShouldEqual, 1.5e9)
+
+		for _, expr := range []string{
+			"cpu.total", "cpu.total >", "> 5", "cpu.total > x",
+			"cpu.total > 5 for", "cpu.total > 5 during 5m", "cpu[0 > 5",
+		} {
+			_, err := ParseRule("bad", expr)
+			So(err, ShouldWrap, ErrRuleSyntax)
+		}
+	})
+
+	Convey("Test rule loading", t, func() {
+		p := filepath.Join(t.TempDir(), "rules.json")
+		os.WriteFile(p, []byte(`{"rules": [
+			{"name": "cpu", "expr": "cpu.total > 90 for 5m",
+			 "severity": "warning", "summary": "CPU is busy"}
+		]}`), 0o644)
+		rules, err := LoadRules(p)
+		So(err, ShouldBeNil)
+		So(rules, ShouldHaveLength, 1)
+		So(rules[0].Severity, ShouldEqual, "warning")
+		So(rules[0].For, ShouldEqual, 5*time.Minute)
+
+		os.WriteFile(p, []byte(`{"rules": [{"name": "x", "expr": "x"}]}`),
+			0o644)
+		_, err = LoadRules(p)
+		So(err, ShouldWrap, ErrRuleSyntax)
+
+		// alerts are tracked by rule name
+		os.WriteFile(p, []byte(`{"rules": [
+			{"name": "cpu", "expr": "cpu.total > 90"},
+			{"expr": "cpu.total > 95"}
+		]}`), 0o644)
+		_, err = LoadRules(p)
+		So(err, ShouldWrap, ErrRuleName)
+		So(err.Error(), ShouldContainSubstring, "rule 2")
+		os.WriteFile(p, []byte(`{"rules": [
+			{"name": "cpu", "expr": "cpu.total > 90"},
+			{"name": "cpu", "expr": "cpu.total > 95"}
+		]}`), 0o644)
+		_, err = LoadRules(p)
+		So(err, ShouldWrap, ErrRuleName)
+		So(err.Error(), ShouldContainSubstring, `"cpu"`)
+	})
+}
+
+func TestEngine(t *testing.T) {
+	Convey("Test alert engine", t, func() {
+		cpuRule, _ := ParseRule("cpu", "cpu.total > 90 for 3s clear 80")
+		memRule, _ := ParseRule("mem",
+			"c_stat[palworld].mem_used > 14GiB for 2s")
+		coreRule, _ := ParseRule("core", "cpu.core[0] > 99")
+		e := NewEngine([]Rule{cpuRule, memRule, coreRule})
+		var got []Alert
+		cancel := e.Subscribe(SubscriberFunc(func(a Alert) {
+			got = append(got, a)
+		}))
+
+		cpu := []float32{50, 95, 95, 85, 95, 95, 95, 95, 85, 79, 100}
+		mem := []uint64{1, 15 << 30, 15 << 30, 1, 15 << 30, 15 << 30,
+			15 << 30, 15 << 30, 1, 1, 1}
+		changes := e.Replay(recordTimeline(cpu, mem))
+		So(got, ShouldResemble, changes)
+
+		type step struct {
+			rule  string
+			state State
+			ts    int64
+		}
+		var steps []step
+		for _, c := range changes {
+			steps = append(steps, step{c.Rule, c.State, c.ActiveAt})
+		}
+		So(steps, ShouldResemble, []step{
+			{"cpu", StatePending, 1000},
+			{"mem", StatePending, 1000},
+			// CPU at 85 clears the pending state before firing
+			{"cpu", StateInactive, 1000},
+			{"mem", StateInactive, 1000},
+			{"cpu", StatePending, 4000},
+			{"mem", StatePending, 4000},
+			{"mem", StateFiring, 4000},
+			{"cpu", StateFiring, 4000},
+			// CPU at 85 does not resolve the firing alert due to hysteresis
+			{"mem", StateResolved, 4000},
+			{"cpu", StateResolved, 4000},
+			{"cpu", StatePending, 10000},
+			{"core", StateFiring, 10000},
+		})
+		So(changes[6].FiredAt, ShouldEqual, 6000)
+		So(changes[7].FiredAt, ShouldEqual, 7000)
+		So(changes[8].ResolvedAt, ShouldEqual, 8000)
+		So(changes[9].ResolvedAt, ShouldEqual, 9000)
+
+		active := e.Active()
+		So(active, ShouldHaveLength, 2)
+		So(active[0].Rule, ShouldEqual, "core")
+		So(active[1].Rule, ShouldEqual, "cpu")
+		So(active[1].Value, ShouldEqual, 100)
+
+		cancel()
+		e.Eval(sysinfo.PerfStat{TS: 11000}, nil)
+		So(e.Active(), ShouldBeEmpty)
+		So(got, ShouldHaveLength, len(changes))
+	})
+}
+
+func TestEngineRun(t *testing.T) {
+	Convey("Test alert engine driven by a manual clock", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		start := time.UnixMilli(1760000000000)
+		clock := sysinfo.NewManualClock(start)
+		mgr := sysinfo.CreateManualPerfTimelineMgr(ctx, 1000, 10,
+			sysinfo.PerfStat{CPU: &sysinfo.CPUStat{Total: 95}}, clock)
+		rule, _ := ParseRule("cpu", "cpu.total > 90")
+		e := NewEngine([]Rule{rule})
+		go e.Run(ctx, mgr, time.Second, clock)
+
+		// the ticker of Run may not exist yet when the clock first moves
+		deadline := time.Now().Add(5 * time.Second)
+		for len(e.Active()) == 0 && time.Now().Before(deadline) {
+			clock.Advance(time.Second)
+			time.Sleep(time.Millisecond)
+		}
+		active := e.Active()
+		So(active, ShouldHaveLength, 1)
+		So(active[0].State, ShouldEqual, StateFiring)
+		// evaluated at the time of the clock
+		So(active[0].ActiveAt, ShouldBeGreaterThan, start.UnixMilli())
+		So(active[0].ActiveAt, ShouldBeLessThanOrEqualTo,
+			clock.Now().UnixMilli())
+	})
+}
@@ -0,0 +1,231 @@
+package alert
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrRuleSyntax = errors.New("invalid alert rule")
+	ErrRuleName   = errors.New("invalid alert rule name")
+)
+
+// comparison operators, longer ones first for parsing
+var ruleOps = []string{">=", "<=", "==", "!=", ">", "<"}
+
+// unit suffixes of values
+var ruleUnits = []struct {
+	suffix string
+	factor float64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+	{"%", 1},
+}
+
+// Rule is a threshold rule over a value of PerfStat, written as
+//
+//	<path> <op> <value> [for <duration>] [clear <value>]
+//
+// such as "cpu.total > 90 for 5m clear 80" or
+// "c_stat[palworld].mem_used > 14GiB for 1m".
+//
+// The path follows the JSON names of PerfStat, map keys and slice indexes
+// are given in brackets. Containers can be referred by ID or name.
+// The rule becomes pending when the condition holds, and firing when it
+// keeps holding for the duration. A firing rule is resolved when the
+// condition no longer holds against the clear value, which defaults to the
+// threshold, so "clear" gives hysteresis.
+type Rule struct {
+	Name     string        `json:"name"`
+	Expr     string        `json:"expr"`
+	Severity string        `json:"severity,omitempty"`
+	Summary  string        `json:"summary,omitempty"`
+	Path     []PathElem    `json:"-"`
+	Op       string        `json:"-"`
+	Value    float64       `json:"-"`
+	Clear    float64       `json:"-"`
+	For      time.Duration `json:"-"`
+}
+
+// PathElem is an element of a value path, either a field or a key
+type PathElem struct {
+	Field string
+	Key   string
+	IsKey bool
+}
+
+// RuleFile is the format of an alert rule config file
+type RuleFile struct {
+	Rules []Rule `json:"rules"`
+}
+
+// ParseRule parses the expression of a rule
+func ParseRule(name, expr string) (Rule, error) {
+	r := Rule{Name: name, Expr: expr}
+	fail := func(msg string) (Rule, error) {
+		return Rule{}, fmt.Errorf("%w %q: %s", ErrRuleSyntax, expr, msg)
+	}
+
+	// the path may contain spaces in brackets, find the operator outside
+	depth := 0
+	opPos, opLen := -1, 0
+	for i := 0; i < len(expr) && opPos < 0; i++ {
+		switch expr[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		default:
+			if depth > 0 {
+				continue
+			}
+			for _, op := range ruleOps {
+				if strings.HasPrefix(expr[i:], op) {
+					opPos, opLen = i, len(op)
+					r.Op = op
+					break
+				}
+			}
+		}
+	}
+	if opPos < 0 {
+		return fail("missing operator")
+	}
+	path, err := parsePath(strings.TrimSpace(expr[:opPos]))
+	if err != nil {
+		return fail(err.Error())
+	}
+	r.Path = path
+
+	f := strings.Fields(expr[opPos+opLen:])
+	if len(f) == 0 {
+		return fail("missing value")
+	}
+	if r.Value, err = parseValue(f[0]); err != nil {
+		return fail(err.Error())
+	}
+	r.Clear = r.Value
+	for f = f[1:]; len(f) > 0; f = f[2:] {
+		if len(f) < 2 {
+			return fail("missing argument of " + f[0])
+		}
+		switch f[0] {
+		case "for":
+			if r.For, err = time.ParseDuration(f[1]); err != nil {
+				return fail(err.Error())
+			}
+		case "clear":
+			if r.Clear, err = parseValue(f[1]); err != nil {
+				return fail(err.Error())
+			}
+		default:
+			return fail("unknown keyword " + f[0])
+		}
+	}
+	return r, nil
+}
+
+// parsePath parses a path like "c_stat[palworld].mem_used"
+func parsePath(s string) ([]PathElem, error) {
+	var ret []PathElem
+	for len(s) > 0 {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+		case '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, errors.New("unclosed bracket")
+			}
+			ret = append(ret, PathElem{Key: s[1:end], IsKey: true})
+			s = s[end+1:]
+		default:
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			ret = append(ret, PathElem{Field: s[:end]})
+			s = s[end:]
+		}
+	}
+	if len(ret) == 0 {
+		return nil, errors.New("missing path")
+	}
+	return ret, nil
+}
+
+// parseValue parses a number with an optional unit suffix
+func parseValue(s string) (float64, error) {
+	factor := 1.0
+	for _, u := range ruleUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			s = strings.TrimSuffix(s, u.suffix)
+			factor = u.factor
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	return v * factor, err
+}
+
+// LoadRules loads rules from a JSON config file in RuleFile format. Rules
+// are identified by their names, which must be unique and not empty.
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rf RuleFile
+	if err := json.Unmarshal(data, &rf); err != nil {
+		return nil, err
+	}
+	ret := make([]Rule, len(rf.Rules))
+	names := make(map[string]bool, len(rf.Rules))
+	for i, v := range rf.Rules {
+		if v.Name == "" {
+			return nil, fmt.Errorf("%w: rule %d has no name", ErrRuleName, i+1)
+		}
+		if names[v.Name] {
+			return nil, fmt.Errorf("%w: duplicate %q", ErrRuleName, v.Name)
+		}
+		names[v.Name] = true
+		r, err := ParseRule(v.Name, v.Expr)
+		if err != nil {
+			return nil, err
+		}
+		r.Severity = v.Severity
+		r.Summary = v.Summary
+		ret[i] = r
+	}
+	return ret, nil
+}
+
+// match checks the condition of the rule, with the clear value if the
+// rule is firing
+func (r *Rule) match(v float64, firing bool) bool {
+	t := r.Value
+	if firing {
+		t = r.Clear
+	}
+	switch r.Op {
+	case ">":
+		return v > t
+	case ">=":
+		return v >= t
+	case "<":
+		return v < t
+	case "<=":
+		return v <= t
+	case "==":
+		return v == t
+	case "!=":
+		return v != t
+	}
+	return false
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/w-sdc/mushroomant/alert"
+	mlog "github.com/w-sdc/mushroomant/log"
+	"github.com/w-sdc/mushroomant/sysinfo"
+)
+
+// apiResult is the envelope of all API responses, it is parsed by the
+// Result class of the frontend.
+type apiResult struct {
+	Status string `json:"status"`
+	Body   any    `json:"body,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// writeResult writes a successful API response.
+func writeResult(w http.ResponseWriter, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(apiResult{Status: "ok", Body: body})
+}
+
+// writeError writes a failed API response with the given status code.
+func writeError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(apiResult{Status: "error", Error: err.Error()})
+}
+
+// tokenHeader is the header of the API token sent by the frontend
+const tokenHeader = "WSDC-Token"
+
+// tokenCookie is the cookie of the API token, for clients which cannot set
+// headers, such as EventSource of browsers
+const tokenCookie = "WSDC-Token"
+
+// maxTopInterval limits the sampling interval of /api/top
+const maxTopInterval = 10 * time.Second
+
+// logKeepAlive is the interval of comments sent to idle log streams, so
+// that proxies do not close them
+const logKeepAlive = 15 * time.Second
+
+var (
+	errNoToken      = errors.New("API token is not configured")
+	errUnauthorized = errors.New("invalid API token")
+	errExportFormat = errors.New("unsupported export format")
+	errNoStreaming  = errors.New("streaming is not supported")
+)
+
+// requireToken only passes the requests carrying the token, in the
+// WSDC-Token header or else the WSDC-Token cookie. The cookie is for
+// EventSource, which cannot set headers, and should be set with
+// SameSite=Strict. All requests are rejected if the token is empty, so
+// that an unconfigured server does not expose the endpoint.
+func requireToken(token string, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			writeError(w, http.StatusForbidden, errNoToken)
+			return
+		}
+		got := r.Header.Get(tokenHeader)
+		if got == "" {
+			if c, err := r.Cookie(tokenCookie); err == nil {
+				got = c.Value
+			}
+		}
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			writeError(w, http.StatusUnauthorized, errUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}
+}
+
+// acceptsMIME checks whether the request explicitly accepts the given media
+// type. Wildcards are not counted, so JSON stays the default.
+func acceptsMIME(r *http.Request, mtype string) bool {
+	for _, v := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(v))
+		if err != nil || mt != mtype {
+			continue
+		}
+		return params["q"] != "0"
+	}
+	return false
+}
+
+// handlePerf serves a performance timeline of the registry given by the
+// "timeline" query parameter, defaultTimeline if absent, or the timeline of
+// a single container given by the "container" parameter. The compact binary
+// encoding is used if the client accepts sysinfo.PerfTimelineMIME,
+// otherwise JSON. If several timelines are given, they are served as a JSON
+// object keyed by name.
+func handlePerf(
+	reg *sysinfo.PerfTimelineRegistry,
+	defaultTimeline string,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		names := r.URL.Query()["timeline"]
+		if len(names) == 0 {
+			names = []string{defaultTimeline}
+		}
+		tls, err := reg.Export(names...)
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		if c := r.URL.Query().Get("container"); c != "" {
+			for name, tl := range tls {
+				tls[name] = sysinfo.FilterContainer(tl, c)
+			}
+		}
+		if len(tls) > 1 {
+			writeResult(w, tls)
+			return
+		}
+		tl := tls[names[0]]
+		w.Header().Add("Vary", "Accept")
+		if acceptsMIME(r, sysinfo.PerfTimelineMIME) {
+			w.Header().Set("Content-Type", sysinfo.PerfTimelineMIME)
+			sysinfo.EncodePerfTimeline(w, tl)
+			return
+		}
+		writeResult(w, tl)
+	}
+}
+
+// parseTime parses a time given in unix milliseconds or RFC 3339 into unix
+// milliseconds, an empty string is zero.
+func parseTime(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return ms, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return 0, err
+	}
+	return t.UnixMilli(), nil
+}
+
+// handlePerfExport serves a timeline of the registry as a CSV or JSON Lines
+// download, given by the "format" query parameter. The timeline is
+// selected as in handlePerf, and limited to the time range between the
+// "from" and "to" parameters.
+func handlePerfExport(
+	reg *sysinfo.PerfTimelineRegistry,
+	defaultTimeline string,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		name := q.Get("timeline")
+		if name == "" {
+			name = defaultTimeline
+		}
+		from, err := parseTime(q.Get("from"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		to, err := parseTime(q.Get("to"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		var ctype, ext string
+		var write func(io.Writer, sysinfo.PerfTimeline) error
+		switch q.Get("format") {
+		case "", "csv":
+			ctype, ext, write = "text/csv", "csv", sysinfo.WritePerfCSV
+		case "jsonl":
+			ctype, ext = "application/jsonl", "jsonl"
+			write = sysinfo.WritePerfJSONL
+		default:
+			writeError(w, http.StatusBadRequest, errExportFormat)
+			return
+		}
+
+		mgr, ok := reg.Get(name)
+		if !ok {
+			writeError(w, http.StatusNotFound, sysinfo.ErrPerfTimelineNotFound)
+			return
+		}
+		tl := sysinfo.SlicePerfTimeline(mgr.Export(), from, to)
+		if c := q.Get("container"); c != "" {
+			tl = sysinfo.FilterContainer(tl, c)
+		}
+		w.Header().Set("Content-Type", ctype)
+		w.Header().Set("Content-Disposition", mime.FormatMediaType(
+			"attachment", map[string]string{"filename": fmt.Sprintf(
+				"perf-%s-%s.%s", name,
+				time.Now().UTC().Format("20060102T150405Z"), ext)}))
+		write(w, tl)
+	}
+}
+
+// handleTimelines lists the timelines of the registry.
+func handleTimelines(reg *sysinfo.PerfTimelineRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeResult(w, reg.List())
+	}
+}
+
+// handleHost serves the inventory of the host.
+func handleHost() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		info, err := sysinfo.GetHostInfo()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeResult(w, info)
+	}
+}
+
+// handleTop serves the top processes, ordered by the "by" query parameter
+// (cpu or mem), limited to "n" processes, with CPU usage sampled over
+// "interval".
+func handleTop() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		by := q.Get("by")
+		if by == "" {
+			by = sysinfo.TopByCPU
+		}
+		n := 20
+		if v := q.Get("n"); v != "" {
+			var err error
+			if n, err = strconv.Atoi(v); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+		interval := time.Second
+		if v := q.Get("interval"); v != "" {
+			var err error
+			if interval, err = time.ParseDuration(v); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			interval = min(max(interval, 0), maxTopInterval)
+		}
+		top, err := sysinfo.TopProcs(r.Context(), by, n, interval)
+		if errors.Is(err, sysinfo.ErrTopOrder) {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeResult(w, top)
+	}
+}
+
+// handleAlerts serves the pending and firing alerts.
+func handleAlerts(e *alert.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeResult(w, e.Active())
+	}
+}
+
+// parseLogQuery parses the query parameters of /api/logs: "level" is the
+// lowest level, "module", "trace" is a prefix of trace IDs, "from" and "to"
+// are as in handlePerfExport, "q" is a substring, "after" is a sequence
+// number and "limit" the number of latest records.
+func parseLogQuery(r *http.Request) (mlog.LogQuery, error) {
+	q := r.URL.Query()
+	ret := mlog.LogQuery{
+		Module:   q.Get("module"),
+		Trace:    q.Get("trace"),
+		Contains: q.Get("q"),
+	}
+	var err error
+	if v := q.Get("level"); v != "" {
+		if ret.Level, err = mlog.ParseLevel(v); err != nil {
+			return ret, err
+		}
+	}
+	for _, b := range []struct {
+		name string
+		t    *time.Time
+	}{{"from", &ret.From}, {"to", &ret.To}} {
+		ms, err := parseTime(q.Get(b.name))
+		if err != nil {
+			return ret, err
+		}
+		if ms != 0 {
+			*b.t = time.UnixMilli(ms)
+		}
+	}
+	if v := q.Get("after"); v != "" {
+		if ret.After, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return ret, err
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if ret.Limit, err = strconv.Atoi(v); err != nil {
+			return ret, err
+		}
+	}
+	return ret, nil
+}
+
+// handleLogs serves the recent log records matching the query.
+func handleLogs(logs mlog.LogBuffer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, err := parseLogQuery(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		recs := logs.Query(q)
+		if recs == nil {
+			recs = []mlog.LogRecord{}
+		}
+		writeResult(w, recs)
+	}
+}
+
+// handleLogStream streams the log records matching the query as
+// server-sent events, with the sequence number as the event ID. The recent
+// records are sent first, then the new ones until the client goes away.
+// A reconnecting client resumes from the Last-Event-ID header.
+func handleLogStream(logs mlog.LogBuffer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, err := parseLogQuery(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if v := r.Header.Get("Last-Event-ID"); v != "" {
+			if q.After, err = strconv.ParseUint(v, 10, 64); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeError(w, http.StatusInternalServerError, errNoStreaming)
+			return
+		}
+		// follow before querying so that no record is missed in between,
+		// records already sent are skipped by the sequence number
+		follow := logs.Follow(r.Context(), q)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		last := q.After
+		send := func(rec mlog.LogRecord) {
+			if rec.Seq <= last {
+				return
+			}
+			last = rec.Seq
+			data, _ := json.Marshal(rec)
+			fmt.Fprintf(w, "id: %d\ndata: %s\n\n", rec.Seq, data)
+		}
+		for _, rec := range logs.Query(q) {
+			send(rec)
+		}
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(logKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case rec, ok := <-follow:
+				if !ok {
+					return
+				}
+				send(rec)
+			case <-keepAlive.C:
+				io.WriteString(w, ": keep-alive\n\n")
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	mlog "github.com/w-sdc/mushroomant/log"
+)
+
+// fakeLogs is a LogBuffer of fixed query results and followed records
+type fakeLogs struct {
+	mlog.LogBuffer
+	recs   []mlog.LogRecord
+	follow chan mlog.LogRecord
+	q      mlog.LogQuery
+}
+
+func (l *fakeLogs) Query(q mlog.LogQuery) []mlog.LogRecord {
+	l.q = q
+	return l.recs
+}
+
+func (l *fakeLogs) Follow(
+	ctx context.Context,
+	q mlog.LogQuery,
+) <-chan mlog.LogRecord {
+	return l.follow
+}
+
+// readEventIDs reads the IDs of server-sent events until n are read or the
+// stream ends
+func readEventIDs(sc *bufio.Scanner, n int) []string {
+	var ids []string
+	for len(ids) < n && sc.Scan() {
+		if id, ok := strings.CutPrefix(sc.Text(), "id: "); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func TestRequireToken(t *testing.T) {
+	Convey("Test API token", t, func() {
+		h := requireToken("secret", http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				writeResult(w, "ok")
+			}))
+		serve := func(r *http.Request) int {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			return w.Code
+		}
+
+		r := httptest.NewRequest("GET", "/api/logs", nil)
+		So(serve(r), ShouldEqual, http.StatusUnauthorized)
+		r.Header.Set(tokenHeader, "secret")
+		So(serve(r), ShouldEqual, http.StatusOK)
+		r.Header.Set(tokenHeader, "wrong")
+		So(serve(r), ShouldEqual, http.StatusUnauthorized)
+
+		// EventSource can only send the token as a cookie
+		r = httptest.NewRequest("GET", "/api/logs/stream", nil)
+		r.AddCookie(&http.Cookie{Name: tokenCookie, Value: "secret"})
+		So(serve(r), ShouldEqual, http.StatusOK)
+		r = httptest.NewRequest("GET", "/api/logs/stream", nil)
+		r.AddCookie(&http.Cookie{Name: tokenCookie, Value: "wrong"})
+		So(serve(r), ShouldEqual, http.StatusUnauthorized)
+
+		h = requireToken("", h)
+		r.Header.Set(tokenHeader, "")
+		So(serve(r), ShouldEqual, http.StatusForbidden)
+	})
+}
+
+func TestParseLogQuery(t *testing.T) {
+	Convey("Test parsing log queries", t, func() {
+		r := httptest.NewRequest("GET", "/api/logs?level=warn&module=main"+
+			"&trace=abc&from=1760000000000&to=2025-10-09T09:00:00Z"+
+			"&q=saved&after=42&limit=10", nil)
+		q, err := parseLogQuery(r)
+		So(err, ShouldBeNil)
+		So(q, ShouldResemble, mlog.LogQuery{
+			Level:    mlog.LLWarn,
+			Module:   "main",
+			Trace:    "abc",
+			From:     time.UnixMilli(1760000000000),
+			To:       time.UnixMilli(1760000400000),
+			Contains: "saved",
+			After:    42,
+			Limit:    10,
+		})
+
+		q, err = parseLogQuery(httptest.NewRequest("GET", "/api/logs", nil))
+		So(err, ShouldBeNil)
+		So(q, ShouldResemble, mlog.LogQuery{})
+
+		for _, v := range []string{
+			"level=loud", "from=yesterday", "after=-1", "limit=ten",
+		} {
+			_, err = parseLogQuery(httptest.NewRequest("GET",
+				"/api/logs?"+v, nil))
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func TestHandleLogStream(t *testing.T) {
+	Convey("Test streaming logs", t, func() {
+		Convey("Records in both the query and the follow are sent once",
+			func() {
+				logs := &fakeLogs{
+					recs:   []mlog.LogRecord{{Seq: 1}, {Seq: 2}, {Seq: 3}},
+					follow: make(chan mlog.LogRecord, 3),
+				}
+				// written between following and querying
+				logs.follow <- mlog.LogRecord{Seq: 2}
+				logs.follow <- mlog.LogRecord{Seq: 3}
+				logs.follow <- mlog.LogRecord{Seq: 4}
+				close(logs.follow)
+				w := httptest.NewRecorder()
+				handleLogStream(logs).ServeHTTP(w,
+					httptest.NewRequest("GET", "/api/logs/stream", nil))
+				So(w.Code, ShouldEqual, http.StatusOK)
+				So(w.Header().Get("Content-Type"), ShouldEqual,
+					"text/event-stream")
+				sc := bufio.NewScanner(w.Body)
+				So(readEventIDs(sc, 10), ShouldResemble,
+					[]string{"1", "2", "3", "4"})
+			})
+
+		Convey("Last-Event-ID resumes the stream", func() {
+			logs := &fakeLogs{follow: make(chan mlog.LogRecord)}
+			close(logs.follow)
+			r := httptest.NewRequest("GET", "/api/logs/stream?after=1", nil)
+			r.Header.Set("Last-Event-ID", "7")
+			handleLogStream(logs).ServeHTTP(httptest.NewRecorder(), r)
+			So(logs.q.After, ShouldEqual, 7)
+
+			r.Header.Set("Last-Event-ID", "seven")
+			w := httptest.NewRecorder()
+			handleLogStream(logs).ServeHTTP(w, r)
+			So(w.Code, ShouldEqual, http.StatusBadRequest)
+		})
+
+		Convey("Recent and new records of a log buffer", func() {
+			logs := mlog.NewLogBuffer(10)
+			l := mlog.NewSimpleLogger("streamtest", "", mlog.NewLevelWriter(
+				logs, logs, logs, logs, logs, logs, mlog.LLDebug))
+			for i := 0; i < 3; i++ {
+				l.Info("record ", i)
+			}
+			srv := httptest.NewServer(handleLogStream(logs))
+			defer srv.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			req, _ := http.NewRequestWithContext(ctx, "GET",
+				srv.URL+"?module=streamtest", nil)
+			req.Header.Set("Last-Event-ID", "1")
+			resp, err := http.DefaultClient.Do(req)
+			So(err, ShouldBeNil)
+			defer resp.Body.Close()
+			sc := bufio.NewScanner(resp.Body)
+			So(readEventIDs(sc, 2), ShouldResemble, []string{"2", "3"})
+
+			l.Info("record 3")
+			So(readEventIDs(sc, 1), ShouldResemble, []string{"4"})
+		})
+	})
+}
@@ -1,110 +1,236 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"github.com/shirou/gopsutil/cpu"
-	"github.com/shirou/gopsutil/mem"
+	"github.com/w-sdc/mushroomant/alert"
+	mlog "github.com/w-sdc/mushroomant/log"
+	"github.com/w-sdc/mushroomant/sysinfo"
+	"github.com/w-sdc/mushroomant/taskmgr"
 )
 
-var (
-	// CPU metrics
-	cpuUsagePerCore = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "cpu_usage_per_core",
-			Help: "CPU usage percentage per core",
-		},
-		[]string{"core"},
-	)
-
-	cpuUsageSummary = prometheus.NewSummary(
-		prometheus.SummaryOpts{
-			Name:       "cpu_usage_summary",
-			Help:       "Summary of overall CPU usage percentage over time",
-			Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001}, // 记录中位数、90分位和99分位数
-			MaxAge:     time.Minute * 5,                                        // 5分钟的时间窗口
-		},
-	)
-
-	// Memory metrics
-	memoryTotal = prometheus.NewGauge(prometheus.GaugeOpts{
-		Name: "memory_total_bytes",
-		Help: "Total memory in bytes",
-	})
-
-	memoryUsed = prometheus.NewGauge(prometheus.GaugeOpts{
-		Name: "memory_used_bytes",
-		Help: "Used memory in bytes",
-	})
-
-	memoryFree = prometheus.NewGauge(prometheus.GaugeOpts{
-		Name: "memory_free_bytes",
-		Help: "Free memory in bytes",
-	})
+const (
+	perfInterval = 5 * time.Second
+	perfCapacity = 720 // 1 hour of snapshots
+	hostTimeline = "host"
+)
 
-	memoryAvailable = prometheus.NewGauge(prometheus.GaugeOpts{
-		Name: "memory_available_bytes",
-		Help: "Available memory in bytes",
-	})
+var (
+	flagListen     = flag.String("listen", ":2112", "address to listen on")
+	flagCgroupRoot = flag.String("cgroup-root", sysinfo.DefaultCgroupRoot,
+		"mount point of the cgroup v2 hierarchy, empty to disable")
+	flagServices = flag.String("services", "",
+		"comma separated systemd units to be watched as containers")
+	flagOOMHorizon = flag.Duration("oom-horizon", 2*time.Hour,
+		"report a memory leak when OOM is expected within this duration")
+	flagOOMWindow = flag.Duration("oom-window", 30*time.Minute,
+		"duration of history to fit the memory trend on")
+	flagAlertRules = flag.String("alert-rules", "",
+		"path of the alert rules config file")
+	flagCustomExec = flag.String("custom-exec", "",
+		"comma separated scripts printing custom metrics to stdout")
+	flagCustomInterval = flag.Duration("custom-interval",
+		sysinfo.DefaultCustomInterval,
+		"interval of running the custom metric scripts")
+	flagCustomTimeout = flag.Duration("custom-timeout",
+		sysinfo.DefaultCustomTimeout, "timeout of a custom metric script")
+	flagTextfileDir = flag.String("textfile-dir", "",
+		"directory of *.prom files with custom metrics")
+	flagWatchProcs = flag.String("watch-procs", "",
+		"comma separated process names or pids to sample, such as "+
+			"PalServer-Linux-Shipping")
+	flagWatchPorts = flag.String("watch-ports", "",
+		"comma separated ports to count sockets on, such as tcp/25565")
+	flagAPIToken = flag.String("api-token", os.Getenv("MUSHROOMANT_API_TOKEN"),
+		"token of the authenticated API, defaults to $MUSHROOMANT_API_TOKEN")
+	flagLogBuffer = flag.Int("log-buffer", mlog.DefaultLogBufferSize,
+		"number of recent log records kept for the console")
+	flagLogJournal = flag.Bool("log-journal", false,
+		"send logs to journald instead of stderr")
 )
 
-func init() {
-	// Register all metrics
-	prometheus.MustRegister(cpuUsagePerCore)
-	prometheus.MustRegister(cpuUsageSummary)
-	prometheus.MustRegister(memoryTotal)
-	prometheus.MustRegister(memoryUsed)
-	prometheus.MustRegister(memoryFree)
-	prometheus.MustRegister(memoryAvailable)
+// procTargets samples mushroomant itself and the watched processes, given
+// by pid or executable name
+func procTargets(watch ...string) sysinfo.ProcTargets {
+	var pids []int
+	var names []string
+	for _, v := range watch {
+		if pid, err := strconv.Atoi(v); err == nil {
+			pids = append(pids, pid)
+		} else {
+			names = append(names, v)
+		}
+	}
+	byPid := sysinfo.PidTargets(pids...)
+	byName := sysinfo.NameTargets(names...)
+	return func() map[string]int {
+		ret := byName()
+		for k, v := range byPid() {
+			ret[k] = v
+		}
+		ret["mushroomant"] = os.Getpid()
+		return ret
+	}
 }
 
-func collectMetrics() {
-	for {
-		// Collect CPU usage
-		percentages, err := cpu.Percent(time.Second, true)
-		if err != nil {
-			log.Printf("Error collecting CPU metrics: %v", err)
-		} else {
-			// Record per-core metrics
-			for i, percentage := range percentages {
-				core := fmt.Sprintf("%d", i)
-				cpuUsagePerCore.WithLabelValues(core).Set(percentage)
-			}
+// annotateEvent records a task or operation event on the timeline
+func annotateEvent(mgr sysinfo.PerfTimelineMgr, e taskmgr.Event) {
+	a := sysinfo.Annotation{
+		TS:   e.TS.UnixMilli(),
+		Type: string(e.Type),
+		Text: e.Text,
+	}
+	if a.Text == "" {
+		a.Text = e.Task
+	}
+	if len(e.Trace) > 0 {
+		a.TraceID = e.Trace[len(e.Trace)-1].ID.String()
+	}
+	if err := mgr.Annotate(a); err != nil {
+		log.Printf("Error annotating timeline: %v", err)
+	}
+}
 
-			// Calculate and record average CPU usage for summary
-			var total float64
-			for _, percentage := range percentages {
-				total += percentage
-			}
-			average := total / float64(len(percentages))
-			cpuUsageSummary.Observe(average)
+// splitList splits a comma separated flag value
+func splitList(s string) []string {
+	var ret []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			ret = append(ret, v)
 		}
+	}
+	return ret
+}
 
-		// Collect memory information
-		memInfo, err := mem.VirtualMemory()
+// setupLogs sends the logs of both log packages and slog to a buffer of
+// recent records, and journald if enabled or stderr otherwise. Under
+// systemd stderr goes to the journal as well, which would duplicate every
+// record.
+func setupLogs(size int, journal bool) mlog.LogBuffer {
+	logs := mlog.NewLogBuffer(size)
+	var sink mlog.RawWriter = mlog.StdErrWriter
+	if journal {
+		jw, err := mlog.NewJournalWriter("")
 		if err != nil {
-			log.Printf("Error collecting memory metrics: %v", err)
-		} else {
-			memoryTotal.Set(float64(memInfo.Total))
-			memoryUsed.Set(float64(memInfo.Used))
-			memoryFree.Set(float64(memInfo.Free))
-			memoryAvailable.Set(float64(memInfo.Available))
+			log.Fatalf("Error connecting to journald: %v", err)
 		}
-
-		time.Sleep(5 * time.Second)
+		sink = jw
 	}
+	out := mlog.NewMultiWriter(sink, logs)
+	lw := mlog.NewLevelWriter(out, out, out, out, out, out, mlog.LLInfo)
+	mlog.DefaultLevelWriter = lw
+	// the standard logger writes to the default slog logger from now on,
+	// with the source of the caller
+	log.SetFlags(log.Lshortfile)
+	slog.SetDefault(slog.New(mlog.NewSlogHandler("main", "", lw)))
+	return logs
 }
 
 func main() {
+	flag.Parse()
+	ctx := context.Background()
+	logs := setupLogs(*flagLogBuffer, *flagLogJournal)
+
 	// Start metrics collection
-	go collectMetrics()
+	samplers := []sysinfo.Sampler{
+		sysinfo.NewHostSampler(),
+		sysinfo.NewDiskSampler(false),
+		sysinfo.NewProcSampler(procTargets(splitList(*flagWatchProcs)...)),
+	}
+	if *flagCgroupRoot != "" {
+		s, err := sysinfo.NewCgroupSampler(*flagCgroupRoot,
+			splitList(*flagServices)...)
+		if err != nil {
+			log.Printf("Cgroup sampling is disabled: %v", err)
+		} else {
+			samplers = append(samplers, s)
+		}
+	}
+	for _, script := range splitList(*flagCustomExec) {
+		samplers = append(samplers, sysinfo.NewExecSampler(ctx,
+			filepath.Base(script), *flagCustomInterval, *flagCustomTimeout,
+			script))
+	}
+	var ports []sysinfo.SocketPort
+	for _, v := range splitList(*flagWatchPorts) {
+		p, err := sysinfo.ParseSocketPort(v)
+		if err != nil {
+			log.Fatalf("Error parsing watched ports: %v", err)
+		}
+		ports = append(ports, p)
+	}
+	samplers = append(samplers, sysinfo.NewSocketSampler(ports...))
+	if *flagTextfileDir != "" {
+		samplers = append(samplers,
+			sysinfo.NewTextfileSampler(*flagTextfileDir))
+	}
+	timelines := sysinfo.NewPerfTimelineRegistry(ctx, nil)
+	perfMgr, err := timelines.Create(hostTimeline,
+		perfInterval.Milliseconds(), perfCapacity, sysinfo.PerfStat{})
+	if err != nil {
+		log.Fatalf("Error creating perf timeline: %v", err)
+	}
+	go sysinfo.RunSamplers(ctx, perfMgr, perfInterval, func(err error) {
+		log.Printf("Error collecting metrics: %v", err)
+	}, samplers...)
+	prometheus.MustRegister(sysinfo.NewPerfCollector(perfMgr))
+	taskmgr.OnEvent(func(e taskmgr.Event) { annotateEvent(perfMgr, e) })
+
+	memTrend := sysinfo.NewMemTrendAnalyzer(perfMgr, sysinfo.MemTrendConfig{
+		Window:  *flagOOMWindow,
+		Horizon: *flagOOMHorizon,
+		OnEvent: func(f sysinfo.MemForecast) {
+			log.Printf("Memory trend: %s", f)
+			perfMgr.Annotate(sysinfo.Annotation{
+				TS: f.TS, Type: "memory_trend", Text: f.String(),
+			})
+		},
+	})
+	go memTrend.Run(ctx, time.Minute, nil)
+	prometheus.MustRegister(memTrend)
+
+	var rules []alert.Rule
+	if *flagAlertRules != "" {
+		var err error
+		if rules, err = alert.LoadRules(*flagAlertRules); err != nil {
+			log.Fatalf("Error loading alert rules: %v", err)
+		}
+	}
+	alerts := alert.NewEngine(rules)
+	alerts.Subscribe(alert.SubscriberFunc(func(a alert.Alert) {
+		log.Printf("Alert %s is %s: %v", a.Rule, a.State, a.Value)
+		if a.State == alert.StateFiring || a.State == alert.StateResolved {
+			perfMgr.Annotate(sysinfo.Annotation{
+				Type: "alert",
+				Text: fmt.Sprintf("alert %s is %s", a.Rule, a.State),
+			})
+		}
+	}))
+	go alerts.Run(ctx, perfMgr, perfInterval, nil)
 
 	http.Handle("/metrics", promhttp.Handler())
-	log.Println("Starting server on :2112")
-	log.Fatal(http.ListenAndServe(":2112", nil))
+	http.Handle("/api/perf", handlePerf(timelines, hostTimeline))
+	http.Handle("/api/perf/export",
+		handlePerfExport(timelines, hostTimeline))
+	http.Handle("/api/timelines", handleTimelines(timelines))
+	http.Handle("/api/alerts", handleAlerts(alerts))
+	http.Handle("/api/host", handleHost())
+	http.Handle("/api/top", requireToken(*flagAPIToken, handleTop()))
+	http.Handle("/api/logs", requireToken(*flagAPIToken, handleLogs(logs)))
+	http.Handle("/api/logs/stream",
+		requireToken(*flagAPIToken, handleLogStream(logs)))
+	log.Printf("Starting server on %s", *flagListen)
+	log.Fatal(http.ListenAndServe(*flagListen, nil))
 }
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	mlog "github.com/w-sdc/mushroomant/log"
+	"github.com/w-sdc/mushroomant/sysinfo"
+	"github.com/w-sdc/mushroomant/taskmgr"
+)
+
+func TestAnnotateEvent(t *testing.T) {
+	Convey("Test annotating task events", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		mgr := sysinfo.CreateManualPerfTimelineMgr(ctx, 1000, 10,
+			sysinfo.PerfStat{}, sysinfo.SystemClock)
+		trace := mlog.GetTrace(mlog.WithTrace(context.Background(), "restart"))
+
+		annotateEvent(mgr, taskmgr.Event{
+			TS:    time.UnixMilli(1760000000000),
+			Type:  taskmgr.EventOperation,
+			Task:  "palworld",
+			Text:  "restart by alice",
+			Trace: trace,
+		})
+		annotateEvent(mgr, taskmgr.Event{
+			TS:   time.UnixMilli(1760000001000),
+			Type: taskmgr.EventTaskStart,
+			Task: "palworld",
+			Pid:  42,
+		})
+		as := mgr.Export().Annotations
+		So(as, ShouldHaveLength, 2)
+		So(as[1], ShouldResemble, sysinfo.Annotation{
+			TS:      1760000000000,
+			Type:    "operation",
+			Text:    "restart by alice",
+			TraceID: trace[len(trace)-1].ID.String(),
+		})
+		// the task name is used without a description
+		So(as[0], ShouldResemble, sysinfo.Annotation{
+			TS:   1760000001000,
+			Type: "task_start",
+			Text: "palworld",
+		})
+	})
+}
@@ -0,0 +1,184 @@
+package log
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// OverflowPolicy decides what an async writer does when its queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks the caller until there is room in the queue.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest drops the record being written.
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest record in the queue.
+	OverflowDropOldest
+	// OverflowDropBelow drops the record being written if its level is below
+	// AsyncConfig.Level, and blocks otherwise.
+	OverflowDropBelow
+)
+
+// AsyncConfig configures an async writer.
+type AsyncConfig struct {
+	// Size is the capacity of the queue, maxLogQueueSize by default.
+	Size   int
+	Policy OverflowPolicy
+	// Level is the lowest level never dropped by OverflowDropBelow.
+	Level Level
+}
+
+// AsyncWriter is a RawWriter which writes records in the background.
+type AsyncWriter interface {
+	RawWriter
+	// Dropped returns the number of records dropped by the overflow policy.
+	Dropped() uint64
+	// Flush waits until the queued records are written, and returns the
+	// last error of the underlying writer since the last Flush.
+	Flush() error
+	// Close drains the queue and stops the writer. The underlying writer is
+	// not closed.
+	Close() error
+}
+
+// asyncRecord is a queued record, owning copies of the data.
+type asyncRecord struct {
+	meta logMeta
+	data []byte
+}
+
+// asyncWriter implements AsyncWriter.
+type asyncWriter struct {
+	out    RawWriter
+	cfg    AsyncConfig
+	mtx    sync.Mutex
+	cond   *sync.Cond // signaled when the queue or busy changes
+	queue  []*asyncRecord
+	head   int  // index of the oldest record
+	count  int  // number of queued records
+	busy   bool // a record is being written
+	closed bool
+	err    error
+	drops  atomic.Uint64
+	done   chan struct{}
+}
+
+// NewAsyncWriter creates a RawWriter which formats records in the caller and
+// writes them to out in a goroutine, so a slow out does not block logging.
+// The queue is bounded, and cfg.Policy decides what to do when it is full.
+func NewAsyncWriter(out RawWriter, cfg AsyncConfig) AsyncWriter {
+	if cfg.Size <= 0 {
+		cfg.Size = maxLogQueueSize
+	}
+	w := &asyncWriter{
+		out:   out,
+		cfg:   cfg,
+		queue: make([]*asyncRecord, cfg.Size),
+		done:  make(chan struct{}),
+	}
+	w.cond = sync.NewCond(&w.mtx)
+	go w.run()
+	return w
+}
+
+func (w *asyncWriter) WriteItem(m *logMeta, wproc func(w io.Writer)) error {
+	r := &asyncRecord{meta: *m}
+	wproc((*byteWriter)(&r.data))
+	if m.msg != nil {
+		r.meta.msg = append([]byte{}, m.msg...)
+	}
+
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if w.closed {
+		return ErrClosedWriter
+	}
+	for w.count == len(w.queue) {
+		switch {
+		case w.cfg.Policy == OverflowDropNewest,
+			w.cfg.Policy == OverflowDropBelow && m.lv < w.cfg.Level:
+			w.drops.Add(1)
+			return nil
+		case w.cfg.Policy == OverflowDropOldest:
+			w.queue[w.head] = nil
+			w.head = (w.head + 1) % len(w.queue)
+			w.count--
+			w.drops.Add(1)
+		default:
+			w.cond.Wait()
+			if w.closed {
+				return ErrClosedWriter
+			}
+		}
+	}
+	w.queue[(w.head+w.count)%len(w.queue)] = r
+	w.count++
+	w.cond.Broadcast()
+	return nil
+}
+
+// run writes the queued records until the writer is closed and drained.
+func (w *asyncWriter) run() {
+	defer close(w.done)
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	for {
+		for w.count == 0 && !w.closed {
+			w.cond.Wait()
+		}
+		if w.count == 0 {
+			return
+		}
+		r := w.queue[w.head]
+		w.queue[w.head] = nil
+		w.head = (w.head + 1) % len(w.queue)
+		w.count--
+		w.busy = true
+		w.cond.Broadcast()
+
+		w.mtx.Unlock()
+		err := w.out.WriteItem(&r.meta, func(w io.Writer) {
+			w.Write(r.data)
+		})
+		w.mtx.Lock()
+
+		w.busy = false
+		if err != nil {
+			w.err = err
+		}
+		w.cond.Broadcast()
+	}
+}
+
+func (w *asyncWriter) Dropped() uint64 {
+	return w.drops.Load()
+}
+
+func (w *asyncWriter) Flush() error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	for w.count > 0 || w.busy {
+		w.cond.Wait()
+	}
+	err := w.err
+	w.err = nil
+	return err
+}
+
+func (w *asyncWriter) Close() error {
+	w.mtx.Lock()
+	if w.closed {
+		w.mtx.Unlock()
+		return ErrClosedWriter
+	}
+	w.closed = true
+	w.cond.Broadcast()
+	w.mtx.Unlock()
+	<-w.done
+
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	return w.err
+}
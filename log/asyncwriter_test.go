@@ -0,0 +1,148 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// gateWriter is a RawWriter which records the written records, and blocks
+// while the gate is closed.
+type gateWriter struct {
+	gate    chan struct{}
+	mtx     sync.Mutex
+	records []string
+	err     error
+}
+
+func (g *gateWriter) WriteItem(m *logMeta, wproc func(w io.Writer)) error {
+	<-g.gate
+	var b byteWriter
+	wproc(&b)
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	g.records = append(g.records, string(b))
+	return g.err
+}
+
+func (g *gateWriter) written() []string {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	return append([]string{}, g.records...)
+}
+
+func TestAsyncWriter(t *testing.T) {
+	Convey("Test async writer", t, func() {
+		out := &gateWriter{gate: make(chan struct{})}
+		write := func(w RawWriter, lv Level, msg string) error {
+			return w.WriteItem(&logMeta{lv: lv}, func(w io.Writer) {
+				io.WriteString(w, msg)
+			})
+		}
+		// fill writes a record blocked in out, and n records in the queue
+		fill := func(w AsyncWriter, n int) {
+			aw := w.(*asyncWriter)
+			So(write(w, LLInfo, "busy"), ShouldBeNil)
+			aw.mtx.Lock()
+			for !aw.busy {
+				aw.cond.Wait()
+			}
+			aw.mtx.Unlock()
+			for i := 0; i < n; i++ {
+				So(write(w, LLInfo, fmt.Sprint("queued ", i)), ShouldBeNil)
+			}
+		}
+
+		Convey("Default queue size", func() {
+			w := NewAsyncWriter(out, AsyncConfig{})
+			So(w.(*asyncWriter).queue, ShouldHaveLength, maxLogQueueSize)
+			close(out.gate)
+			So(w.Close(), ShouldBeNil)
+			So(w.Close(), ShouldEqual, ErrClosedWriter)
+			So(write(w, LLInfo, "closed"), ShouldEqual, ErrClosedWriter)
+		})
+
+		Convey("Drop newest", func() {
+			w := NewAsyncWriter(out, AsyncConfig{
+				Size: 2, Policy: OverflowDropNewest})
+			fill(w, 2)
+			So(write(w, LLError, "dropped"), ShouldBeNil)
+			So(w.Dropped(), ShouldEqual, 1)
+			close(out.gate)
+			So(w.Flush(), ShouldBeNil)
+			So(out.written(), ShouldResemble,
+				[]string{"busy", "queued 0", "queued 1"})
+			So(w.Close(), ShouldBeNil)
+		})
+
+		Convey("Drop oldest", func() {
+			w := NewAsyncWriter(out, AsyncConfig{
+				Size: 2, Policy: OverflowDropOldest})
+			fill(w, 2)
+			So(write(w, LLInfo, "newest"), ShouldBeNil)
+			So(w.Dropped(), ShouldEqual, 1)
+			close(out.gate)
+			So(w.Close(), ShouldBeNil)
+			So(out.written(), ShouldResemble,
+				[]string{"busy", "queued 1", "newest"})
+		})
+
+		Convey("Drop below level and block otherwise", func() {
+			w := NewAsyncWriter(out, AsyncConfig{
+				Size: 2, Policy: OverflowDropBelow, Level: LLWarn})
+			fill(w, 2)
+			So(write(w, LLInfo, "dropped"), ShouldBeNil)
+			So(w.Dropped(), ShouldEqual, 1)
+			done := make(chan error)
+			go func() { done <- write(w, LLError, "kept") }()
+			select {
+			case <-done:
+				t.Error("error record should be blocked")
+			case <-time.After(20 * time.Millisecond):
+			}
+			close(out.gate)
+			So(<-done, ShouldBeNil)
+			So(w.Close(), ShouldBeNil)
+			So(out.written(), ShouldResemble,
+				[]string{"busy", "queued 0", "queued 1", "kept"})
+		})
+
+		Convey("Block and drain on close", func() {
+			w := NewAsyncWriter(out, AsyncConfig{Size: 4})
+			errOut := errors.New("disk full")
+			out.err = errOut
+			go func() {
+				time.Sleep(20 * time.Millisecond)
+				close(out.gate)
+			}()
+			for i := 0; i < 20; i++ {
+				So(write(w, LLDebug, fmt.Sprint(i)), ShouldBeNil)
+			}
+			So(w.Close(), ShouldEqual, errOut)
+			So(out.written(), ShouldHaveLength, 20)
+			So(w.Dropped(), ShouldEqual, 0)
+		})
+
+		Convey("Messages are copied", func() {
+			w := NewAsyncWriter(NewJSONWriter(&gateWriter{
+				gate: out.gate}), AsyncConfig{})
+			msg := []byte("original")
+			m := logMeta{lv: LLInfo, msg: msg}
+			So(w.WriteItem(&m, func(w io.Writer) {
+				w.Write(msg)
+			}), ShouldBeNil)
+			copy(msg, "modified")
+			close(out.gate)
+			So(w.Close(), ShouldBeNil)
+			jw := w.(*asyncWriter).out.(*jsonWriter).out.(*gateWriter)
+			got := jw.written()
+			So(got, ShouldHaveLength, 1)
+			So(got[0], ShouldContainSubstring, `"msg":"original"`)
+		})
+	})
+}
@@ -21,8 +21,9 @@ func getBuf() *[]byte {
 
 // putBuf returns a buffer to the pool.
 func putBuf(b *[]byte) {
+	// large buffers are left to the GC
 	if cap(*b) > 64<<10 {
-		b = nil
+		return
 	}
 	bufPool.Put(b)
 }
@@ -0,0 +1,153 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// badKey is the key of a value without a key in keyvals.
+const badKey = "!BADKEY"
+
+// field is a key-value field of a log record.
+type field struct {
+	key   string
+	value interface{}
+}
+
+// appendFields appends keyvals, given as alternating keys and values, to
+// fields. The result never shares the backing array with fields, so fields
+// of a logger are immutable once created.
+func appendFields(fields []field, keyvals []interface{}) []field {
+	if len(keyvals) == 0 {
+		return fields
+	}
+	ret := make([]field, len(fields), len(fields)+(len(keyvals)+1)/2)
+	copy(ret, fields)
+	for i := 0; i < len(keyvals); i += 2 {
+		if i+1 == len(keyvals) {
+			ret = append(ret, field{key: badKey, value: keyvals[i]})
+			break
+		}
+		key, ok := keyvals[i].(string)
+		if !ok {
+			key = fmt.Sprint(keyvals[i])
+		}
+		ret = append(ret, field{key: key, value: keyvals[i+1]})
+	}
+	return ret
+}
+
+// appendTextFields appends fields as " k=v" to b, values with spaces or
+// quotes are quoted.
+func appendTextFields(b []byte, fields []field) []byte {
+	for _, f := range fields {
+		b = append(b, ' ')
+		b = append(b, f.key...)
+		b = append(b, '=')
+		s := fieldText(f.value)
+		if s == "" || strings.ContainsAny(s, " =\"\t\r\n") {
+			b = strconv.AppendQuote(b, s)
+		} else {
+			b = append(b, s...)
+		}
+	}
+	return b
+}
+
+// fieldText returns a field value as text.
+func fieldText(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// properties of JSON records written by jsonWriter.
+var jsonReserved = map[string]bool{
+	"ts": true, "level": true, "module": true, "file": true, "line": true,
+	"trace": true, "msg": true,
+}
+
+// appendJSONFields appends fields as properties of a JSON object to b.
+// Fields named as the builtin properties are prefixed by an underscore.
+func appendJSONFields(b []byte, fields []field) []byte {
+	for _, f := range fields {
+		b = append(b, ',')
+		if jsonReserved[f.key] {
+			b = appendJSONString(b, "_"+f.key)
+		} else {
+			b = appendJSONString(b, f.key)
+		}
+		b = append(b, ':')
+		b = appendJSONValue(b, f.value)
+	}
+	return b
+}
+
+// appendJSONValue appends a field value as JSON. Errors, Stringers and
+// non-finite numbers are written as strings.
+func appendJSONValue(b []byte, value interface{}) []byte {
+	switch v := value.(type) {
+	case nil:
+		return append(b, "null"...)
+	case string:
+		return appendJSONString(b, v)
+	case bool:
+		return strconv.AppendBool(b, v)
+	case int:
+		return strconv.AppendInt(b, int64(v), 10)
+	case int8:
+		return strconv.AppendInt(b, int64(v), 10)
+	case int16:
+		return strconv.AppendInt(b, int64(v), 10)
+	case int32:
+		return strconv.AppendInt(b, int64(v), 10)
+	case int64:
+		return strconv.AppendInt(b, v, 10)
+	case uint:
+		return strconv.AppendUint(b, uint64(v), 10)
+	case uint8:
+		return strconv.AppendUint(b, uint64(v), 10)
+	case uint16:
+		return strconv.AppendUint(b, uint64(v), 10)
+	case uint32:
+		return strconv.AppendUint(b, uint64(v), 10)
+	case uint64:
+		return strconv.AppendUint(b, v, 10)
+	case float32:
+		return appendJSONFloat(b, float64(v), 32)
+	case float64:
+		return appendJSONFloat(b, v, 64)
+	case time.Time:
+		b = append(b, '"')
+		b = v.AppendFormat(b, time.RFC3339Nano)
+		return append(b, '"')
+	case time.Duration:
+		return appendJSONString(b, v.String())
+	case error:
+		return appendJSONString(b, v.Error())
+	case fmt.Stringer:
+		return appendJSONString(b, v.String())
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return appendJSONString(b, fmt.Sprint(value))
+	}
+	return append(b, data...)
+}
+
+// appendJSONFloat appends a float, or a string if it is not finite.
+func appendJSONFloat(b []byte, v float64, bitSize int) []byte {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return appendJSONString(b, strconv.FormatFloat(v, 'g', -1, bitSize))
+	}
+	return strconv.AppendFloat(b, v, 'g', -1, bitSize)
+}
@@ -0,0 +1,84 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFields(t *testing.T) {
+	Convey("Test key-value fields", t, func() {
+		var text, js bytes.Buffer
+		tw := NewSimpWriter(&text)
+		jw := NewJSONWriter(NewSimpWriter(&js))
+		tl := NewSimpleLogger("fields", "",
+			NewLevelWriter(tw, tw, tw, tw, tw, tw, LLDebug))
+		jl := NewSimpleLogger("fields", "",
+			NewLevelWriter(jw, jw, jw, jw, jw, jw, LLDebug))
+
+		Convey("Fields are rendered as k=v in text", func() {
+			l := tl.With("server", "palworld", "port", 8211)
+			l.Infow("player joined", "player", "Some One", "empty", "")
+			tl.Info("no fields")
+			lines := strings.Split(strings.TrimSpace(text.String()), "\n")
+			So(lines, ShouldHaveLength, 2)
+			So(lines[0], ShouldEndWith, ` - player joined server=palworld `+
+				`port=8211 player="Some One" empty=""`)
+			So(lines[1], ShouldEndWith, " - no fields")
+		})
+
+		Convey("Fields are properties in JSON", func() {
+			l := jl.With("server", "palworld", "msg", "reserved")
+			l.Warnw("slow tick", "took", 1500*time.Millisecond,
+				"err", errors.New("disk full"), "ratio", 0.5,
+				"nan", math.NaN(), "tags", []string{"a", "b"}, "odd")
+			var rec map[string]interface{}
+			So(json.Unmarshal(js.Bytes(), &rec), ShouldBeNil)
+			So(rec["msg"], ShouldEqual, "slow tick")
+			So(rec["server"], ShouldEqual, "palworld")
+			So(rec["_msg"], ShouldEqual, "reserved")
+			So(rec["took"], ShouldEqual, "1.5s")
+			So(rec["err"], ShouldEqual, "disk full")
+			So(rec["ratio"], ShouldEqual, 0.5)
+			So(rec["nan"], ShouldEqual, "NaN")
+			So(rec["tags"], ShouldResemble, []interface{}{"a", "b"})
+			So(rec[badKey], ShouldEqual, "odd")
+		})
+
+		Convey("Fields are kept through FromTrace and With", func() {
+			ctx := WithTrace(context.Background(), "req")
+			l, err := jl.With("a", 1).FromTrace(ctx)
+			So(err, ShouldBeNil)
+			l.With("b", 2).Errorw("failed", "c", 3)
+			l.Info("plain")
+			lines := strings.Split(strings.TrimSpace(js.String()), "\n")
+			So(lines, ShouldHaveLength, 2)
+			var rec map[string]interface{}
+			So(json.Unmarshal([]byte(lines[0]), &rec), ShouldBeNil)
+			So(rec["a"], ShouldEqual, 1)
+			So(rec["b"], ShouldEqual, 2)
+			So(rec["c"], ShouldEqual, 3)
+			So(rec["trace"], ShouldHaveLength, 1)
+			rec = nil
+			So(json.Unmarshal([]byte(lines[1]), &rec), ShouldBeNil)
+			So(rec["a"], ShouldEqual, 1)
+			So(rec, ShouldNotContainKey, "b")
+		})
+
+		Convey("Fields of a logger are immutable", func() {
+			base := appendFields(nil, []interface{}{"a", 1})
+			f1 := appendFields(base, []interface{}{"b", 2})
+			f2 := appendFields(base, []interface{}{"c", 3})
+			So(f1[1].key, ShouldEqual, "b")
+			So(f2[1].key, ShouldEqual, "c")
+			So(appendFields(base, nil), ShouldHaveLength, 1)
+		})
+	})
+}
@@ -0,0 +1,379 @@
+package log
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrNoLogPath = errors.New("log file path is not given")
+)
+
+// layout of the timestamp suffix of rotated files.
+const rotateTimeLayout = "20060102-150405.000"
+
+// RotateConfig configures a rotating file writer.
+type RotateConfig struct {
+	// Path is the path of the active log file. Rotated files are named by
+	// the path and the time of rotation, such as app.log.20251009-085321.000,
+	// with a .gz suffix if compressed.
+	Path string
+	// MaxSize is the size in bytes over which the file is rotated, 0 for no
+	// limit. A record is never split across files.
+	MaxSize int64
+	// Every is the period of rotation, such as 24 hours, 0 to disable.
+	// Periods are aligned to the zero time in UTC.
+	Every time.Duration
+	// MaxAge removes rotated files older than it, 0 to keep them.
+	MaxAge time.Duration
+	// MaxFiles is the number of rotated files to keep, 0 to keep all.
+	MaxFiles int
+	// Compress gzips rotated files in the background.
+	Compress bool
+	// ReopenOnSIGHUP reopens the file on SIGHUP, for external tools like
+	// logrotate which move the file away.
+	ReopenOnSIGHUP bool
+}
+
+// RotateWriter is a RawWriter of a file with rotation.
+type RotateWriter interface {
+	RawWriter
+	// Rotate rotates the file immediately.
+	Rotate() error
+	// Reopen closes and reopens the file at the path, without rotation.
+	Reopen() error
+	// Close closes the file and waits for the background compression.
+	Close() error
+}
+
+// rotateWriter implements RotateWriter.
+type rotateWriter struct {
+	cfg RotateConfig
+	now func() time.Time
+
+	mtx    sync.Mutex
+	file   *os.File
+	size   int64
+	period time.Time // start of the current period
+	closed bool
+
+	jobs    chan struct{} // wakes up the background worker
+	sighup  chan os.Signal
+	done    chan struct{}
+	workers sync.WaitGroup
+}
+
+// NewRotateWriter creates a RawWriter which appends to a file, and rotates
+// it by size and time. Rotated files are compressed and removed by the
+// retention policy in the background.
+func NewRotateWriter(cfg RotateConfig) (RotateWriter, error) {
+	return newRotateWriter(cfg, time.Now)
+}
+
+// newRotateWriter creates a rotateWriter with the given clock.
+func newRotateWriter(
+	cfg RotateConfig,
+	now func() time.Time,
+) (*rotateWriter, error) {
+	if cfg.Path == "" {
+		return nil, ErrNoLogPath
+	}
+	w := &rotateWriter{
+		cfg:  cfg,
+		now:  now,
+		jobs: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	w.period = w.periodOf(w.now())
+	w.workers.Add(1)
+	go w.work()
+	if cfg.ReopenOnSIGHUP {
+		w.sighup = make(chan os.Signal, 1)
+		signal.Notify(w.sighup, syscall.SIGHUP)
+		w.workers.Add(1)
+		go w.watchSignal()
+	}
+	// files left by the last run are handled as well
+	w.wake()
+	return w, nil
+}
+
+// open opens the file at the path for appending.
+func (w *rotateWriter) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.cfg.Path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(w.cfg.Path,
+		os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file = f
+	w.size = st.Size()
+	return nil
+}
+
+// periodOf returns the start of the rotation period of t.
+func (w *rotateWriter) periodOf(t time.Time) time.Time {
+	if w.cfg.Every <= 0 {
+		return time.Time{}
+	}
+	return t.UTC().Truncate(w.cfg.Every)
+}
+
+func (w *rotateWriter) WriteItem(m *logMeta, wproc func(w io.Writer)) error {
+	// format outside of the lock, and write the record at once so that it
+	// is never split by rotation.
+	buf := getBuf()
+	defer putBuf(buf)
+	wproc((*byteWriter)(buf))
+	*buf = append(*buf, '\n')
+
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if w.closed {
+		return ErrClosedWriter
+	}
+	// a failed rotation does not lose the record, it is written to the
+	// current file and the error is returned along with the write result.
+	var rerr error
+	now := w.now()
+	if p := w.periodOf(now); !p.Equal(w.period) {
+		w.period = p
+		if w.size > 0 {
+			rerr = w.rotate(now)
+		}
+	}
+	if rerr == nil && w.cfg.MaxSize > 0 && w.size > 0 &&
+		w.size+int64(len(*buf)) > w.cfg.MaxSize {
+		rerr = w.rotate(now)
+	}
+	if rerr != nil {
+		rerr = fmt.Errorf("rotate %s: %w", w.cfg.Path, rerr)
+	}
+	n, err := w.file.Write(*buf)
+	w.size += int64(n)
+	return errors.Join(rerr, err)
+}
+
+// rotate moves the file away and opens a new one, with the lock held.
+// If the new file can not be opened, records keep going to the moved file,
+// so nothing is lost.
+func (w *rotateWriter) rotate(now time.Time) error {
+	name := w.cfg.Path + "." + now.UTC().Format(rotateTimeLayout)
+	for i := 1; fileExists(name) || fileExists(name+".gz"); i++ {
+		name = fmt.Sprintf("%s.%s.%d", w.cfg.Path,
+			now.UTC().Format(rotateTimeLayout), i)
+	}
+	if err := os.Rename(w.cfg.Path, name); err != nil {
+		return err
+	}
+	old := w.file
+	if err := w.open(); err != nil {
+		return err
+	}
+	old.Close()
+	w.wake()
+	return nil
+}
+
+// Rotate implements RotateWriter.
+func (w *rotateWriter) Rotate() error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if w.closed {
+		return ErrClosedWriter
+	}
+	return w.rotate(w.now())
+}
+
+// Reopen implements RotateWriter.
+func (w *rotateWriter) Reopen() error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if w.closed {
+		return ErrClosedWriter
+	}
+	old := w.file
+	if err := w.open(); err != nil {
+		return err
+	}
+	old.Close()
+	return nil
+}
+
+// Close implements RotateWriter.
+func (w *rotateWriter) Close() error {
+	w.mtx.Lock()
+	if w.closed {
+		w.mtx.Unlock()
+		return ErrClosedWriter
+	}
+	w.closed = true
+	err := w.file.Close()
+	w.mtx.Unlock()
+
+	if w.sighup != nil {
+		signal.Stop(w.sighup)
+	}
+	close(w.done)
+	w.workers.Wait()
+	return err
+}
+
+// wake wakes up the background worker without blocking.
+func (w *rotateWriter) wake() {
+	select {
+	case w.jobs <- struct{}{}:
+	default:
+	}
+}
+
+// watchSignal reopens the file on SIGHUP.
+func (w *rotateWriter) watchSignal() {
+	defer w.workers.Done()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-w.sighup:
+			if err := w.Reopen(); err != nil {
+				fmt.Fprintf(os.Stderr, "log: reopen %s: %v\n", w.cfg.Path, err)
+			}
+		}
+	}
+}
+
+// work compresses and removes the rotated files in the background. The
+// pending work is finished before Close returns.
+func (w *rotateWriter) work() {
+	defer w.workers.Done()
+	for {
+		select {
+		case <-w.jobs:
+			w.cleanup()
+		case <-w.done:
+			select {
+			case <-w.jobs:
+				w.cleanup()
+			default:
+			}
+			return
+		}
+	}
+}
+
+// rotatedFile is a rotated log file.
+type rotatedFile struct {
+	path string
+	ts   time.Time
+}
+
+// rotatedFiles lists the rotated files in descending order of time.
+func (w *rotateWriter) rotatedFiles() []rotatedFile {
+	matches, _ := filepath.Glob(w.cfg.Path + ".*")
+	var ret []rotatedFile
+	prefix := w.cfg.Path + "."
+	for _, p := range matches {
+		if strings.HasSuffix(p, ".tmp") {
+			continue // left by an interrupted compression
+		}
+		s := strings.TrimSuffix(strings.TrimPrefix(p, prefix), ".gz")
+		if len(s) < len(rotateTimeLayout) {
+			continue
+		}
+		ts, err := time.Parse(rotateTimeLayout, s[:len(rotateTimeLayout)])
+		if err != nil {
+			continue
+		}
+		ret = append(ret, rotatedFile{path: p, ts: ts})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if !ret[i].ts.Equal(ret[j].ts) {
+			return ret[i].ts.After(ret[j].ts)
+		}
+		return ret[i].path > ret[j].path
+	})
+	return ret
+}
+
+// cleanup compresses the rotated files and applies the retention policy.
+func (w *rotateWriter) cleanup() {
+	files := w.rotatedFiles()
+	now := w.now()
+	for i, f := range files {
+		expired := (w.cfg.MaxFiles > 0 && i >= w.cfg.MaxFiles) ||
+			(w.cfg.MaxAge > 0 && now.Sub(f.ts) > w.cfg.MaxAge)
+		if expired {
+			os.Remove(f.path)
+			continue
+		}
+		if w.cfg.Compress && !strings.HasSuffix(f.path, ".gz") {
+			if err := gzipFile(f.path); err != nil {
+				fmt.Fprintf(os.Stderr, "log: compress %s: %v\n", f.path, err)
+			}
+		}
+	}
+}
+
+// gzipFile compresses a file to file.gz and removes the original.
+func gzipFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	tmp := name + ".gz.tmp"
+	dst, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, name+".gz")
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(name)
+}
+
+// fileExists checks whether a file exists.
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+// byteWriter is an io.Writer appending to a byte slice.
+type byteWriter []byte
+
+func (b *byteWriter) Write(p []byte) (int, error) {
+	*b = append(*b, p...)
+	return len(p), nil
+}
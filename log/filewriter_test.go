@@ -0,0 +1,172 @@
+package log
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// readLogLines reads the lines of a log file, which may be gzipped.
+func readLogLines(name string) []string {
+	f, err := os.Open(name)
+	So(err, ShouldBeNil)
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(name, ".gz") {
+		zr, err := gzip.NewReader(f)
+		So(err, ShouldBeNil)
+		r = zr
+	}
+	var ret []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		ret = append(ret, sc.Text())
+	}
+	return ret
+}
+
+func TestRotateWriter(t *testing.T) {
+	Convey("Test rotating file writer", t, func() {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "app.log")
+		var now atomic.Int64
+		now.Store(time.Date(2025, 10, 9, 8, 0, 0, 0, time.UTC).UnixNano())
+		clock := func() time.Time { return time.Unix(0, now.Load()) }
+		tick := func(d time.Duration) { now.Add(int64(d)) }
+		write := func(w RawWriter, msg string) error {
+			return w.WriteItem(&logMeta{}, func(w io.Writer) {
+				io.WriteString(w, msg)
+			})
+		}
+		rotated := func() []string {
+			m, _ := filepath.Glob(path + ".*")
+			return m
+		}
+
+		Convey("Rotate by size without splitting records", func() {
+			w, err := newRotateWriter(RotateConfig{Path: path, MaxSize: 100}, clock)
+			So(err, ShouldBeNil)
+			for i := 0; i < 10; i++ {
+				tick(time.Millisecond)
+				So(write(w, fmt.Sprintf("record %02d %s", i,
+					strings.Repeat("x", 19))), ShouldBeNil)
+			}
+			So(w.Close(), ShouldBeNil)
+			So(write(w, "closed"), ShouldEqual, ErrClosedWriter)
+
+			files := append(rotated(), path)
+			So(len(files), ShouldEqual, 4)
+			var lines []string
+			for _, f := range files {
+				st, err := os.Stat(f)
+				So(err, ShouldBeNil)
+				So(st.Size(), ShouldBeLessThanOrEqualTo, 100)
+				lines = append(lines, readLogLines(f)...)
+			}
+			So(lines, ShouldHaveLength, 10)
+			So(lines[0], ShouldStartWith, "record 00")
+			So(lines[9], ShouldStartWith, "record 09")
+		})
+
+		Convey("Report failed rotation without losing records", func() {
+			w, err := newRotateWriter(RotateConfig{Path: path, MaxSize: 10}, clock)
+			So(err, ShouldBeNil)
+			So(write(w, "first"), ShouldBeNil)
+			// keep the file reachable after it disappears from the path, so
+			// that it can not be renamed
+			kept := filepath.Join(dir, "kept.log")
+			So(os.Link(path, kept), ShouldBeNil)
+			So(os.Remove(path), ShouldBeNil)
+			err = write(w, "second")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "rotate "+path)
+			So(w.Close(), ShouldBeNil)
+			So(rotated(), ShouldBeEmpty)
+			So(readLogLines(kept), ShouldResemble, []string{"first", "second"})
+		})
+
+		Convey("Rotate by time", func() {
+			w, err := newRotateWriter(
+				RotateConfig{Path: path, Every: time.Hour}, clock)
+			So(err, ShouldBeNil)
+			So(write(w, "first"), ShouldBeNil)
+			tick(30 * time.Minute)
+			So(write(w, "second"), ShouldBeNil)
+			So(rotated(), ShouldBeEmpty)
+			tick(30 * time.Minute)
+			So(write(w, "third"), ShouldBeNil)
+			So(w.Close(), ShouldBeNil)
+			So(rotated(), ShouldResemble,
+				[]string{path + ".20251009-090000.000"})
+			So(readLogLines(rotated()[0]), ShouldResemble,
+				[]string{"first", "second"})
+			So(readLogLines(path), ShouldResemble, []string{"third"})
+		})
+
+		Convey("Compress and keep at most MaxFiles", func() {
+			w, err := newRotateWriter(RotateConfig{
+				Path: path, Compress: true, MaxFiles: 2}, clock)
+			So(err, ShouldBeNil)
+			for i := 0; i < 4; i++ {
+				So(write(w, fmt.Sprint("record ", i)), ShouldBeNil)
+				tick(time.Second)
+				So(w.Rotate(), ShouldBeNil)
+			}
+			So(w.Close(), ShouldBeNil)
+			files := rotated()
+			So(files, ShouldResemble, []string{
+				path + ".20251009-080003.000.gz",
+				path + ".20251009-080004.000.gz",
+			})
+			So(readLogLines(files[0]), ShouldResemble, []string{"record 2"})
+			So(readLogLines(files[1]), ShouldResemble, []string{"record 3"})
+		})
+
+		Convey("Remove files older than MaxAge", func() {
+			old := path + ".20251001-000000.000.gz"
+			recent := path + ".20251009-070000.000.gz"
+			So(os.WriteFile(old, nil, 0o644), ShouldBeNil)
+			So(os.WriteFile(recent, nil, 0o644), ShouldBeNil)
+			w, err := newRotateWriter(RotateConfig{
+				Path: path, MaxAge: 24 * time.Hour}, clock)
+			So(err, ShouldBeNil)
+			So(w.Close(), ShouldBeNil)
+			So(rotated(), ShouldResemble, []string{recent})
+		})
+
+		Convey("Reopen after the file is moved away", func() {
+			w, err := newRotateWriter(RotateConfig{
+				Path: path, ReopenOnSIGHUP: true}, clock)
+			So(err, ShouldBeNil)
+			So(write(w, "before"), ShouldBeNil)
+			So(os.Rename(path, path+"-moved"), ShouldBeNil)
+			So(write(w, "moved"), ShouldBeNil)
+			So(w.Reopen(), ShouldBeNil)
+			So(write(w, "after"), ShouldBeNil)
+			So(readLogLines(path+"-moved"), ShouldResemble,
+				[]string{"before", "moved"})
+			So(readLogLines(path), ShouldResemble, []string{"after"})
+
+			// as logrotate does
+			So(os.Rename(path, path+"-hup"), ShouldBeNil)
+			So(syscall.Kill(os.Getpid(), syscall.SIGHUP), ShouldBeNil)
+			deadline := time.Now().Add(5 * time.Second)
+			for time.Now().Before(deadline) && !fileExists(path) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			So(write(w, "hup"), ShouldBeNil)
+			So(w.Close(), ShouldBeNil)
+			So(readLogLines(path), ShouldResemble, []string{"hup"})
+		})
+	})
+}
@@ -0,0 +1,35 @@
+package log
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+// sendJournalFile passes a record too large for a datagram to journald as
+// the descriptor of an unlinked file in /dev/shm.
+func sendJournalFile(conn *net.UnixConn, data []byte) error {
+	f, err := os.CreateTemp("/dev/shm", "journal-")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	// WriteMsgUnix refuses connected datagram sockets
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	rights := syscall.UnixRights(int(f.Fd()))
+	werr := rc.Write(func(fd uintptr) bool {
+		err = syscall.Sendmsg(int(fd), nil, rights, nil, 0)
+		return err != syscall.EAGAIN
+	})
+	if werr != nil {
+		return werr
+	}
+	return err
+}
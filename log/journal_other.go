@@ -0,0 +1,13 @@
+//go:build !linux
+
+package log
+
+import (
+	"net"
+	"syscall"
+)
+
+// sendJournalFile is only supported on Linux, where journald runs.
+func sendJournalFile(conn *net.UnixConn, data []byte) error {
+	return syscall.EMSGSIZE
+}
@@ -0,0 +1,212 @@
+package log
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// DefaultJournalSocket is the socket of the native protocol of journald.
+const DefaultJournalSocket = "/run/systemd/journal/socket"
+
+// syslogSeverity maps a level to the syslog severity, which is the
+// PRIORITY of journald as well.
+func syslogSeverity(level Level) int {
+	switch level {
+	case LLDebug:
+		return 7 // debug
+	case LLInfo:
+		return 6 // info
+	case LLWarn:
+		return 4 // warning
+	case llFatal:
+		return 2 // critical
+	case llPanic:
+		return 1 // alert
+	default:
+		return 3 // error
+	}
+}
+
+// identifier is the program name, used as SYSLOG_IDENTIFIER and APP-NAME.
+var identifier = filepath.Base(os.Args[0])
+
+// fields written by journalWriter, fields of records named as them are
+// prefixed by FIELD_.
+var journalReserved = map[string]bool{
+	"MESSAGE": true, "PRIORITY": true, "CODE_FILE": true, "CODE_LINE": true,
+	"MODULE": true, "SYSLOG_IDENTIFIER": true, "TRACE_ID": true, "TRACE": true,
+}
+
+// journalKey converts a field key to a journal field name, which consists
+// of upper case letters, digits and underscores, not starting with an
+// underscore or a digit. Empty is returned if nothing is left.
+func journalKey(key string) string {
+	b := make([]byte, 0, len(key))
+	for i := 0; i < len(key) && len(b) < 64; i++ {
+		c := key[i]
+		switch {
+		case c >= 'a' && c <= 'z':
+			b = append(b, c-'a'+'A')
+		case c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+			b = append(b, c)
+		case len(b) > 0:
+			b = append(b, '_')
+		}
+	}
+	k := strings.TrimRight(string(b), "_")
+	if k == "" {
+		return ""
+	}
+	if k[0] >= '0' && k[0] <= '9' || journalReserved[k] {
+		k = "FIELD_" + k
+	}
+	if len(k) > 64 {
+		k = k[:64]
+	}
+	return k
+}
+
+// appendJournalField appends a field in the native protocol. Values with
+// line breaks are written in the binary form with the length.
+func appendJournalField(b []byte, key, value string) []byte {
+	b = append(b, key...)
+	if !strings.Contains(value, "\n") {
+		b = append(b, '=')
+		b = append(b, value...)
+		return append(b, '\n')
+	}
+	b = append(b, '\n')
+	b = binary.LittleEndian.AppendUint64(b, uint64(len(value)))
+	b = append(b, value...)
+	return append(b, '\n')
+}
+
+// journalWriter implements RawWriteCloser of journald.
+type journalWriter struct {
+	mtx    sync.Mutex
+	conn   *net.UnixConn // nil after a failed redial
+	addr   *net.UnixAddr
+	closed bool
+}
+
+// NewJournalWriter creates a RawWriter which sends records to journald over
+// the native protocol on socket, or DefaultJournalSocket if empty. Records
+// have the fields of MESSAGE, PRIORITY, CODE_FILE, CODE_LINE, MODULE,
+// SYSLOG_IDENTIFIER, and TRACE_ID of the current trace with TRACE of the
+// whole scope. Key-value fields are converted to upper case journal fields,
+// such as PLAYER_ID for "player.id".
+func NewJournalWriter(socket string) (RawWriteCloser, error) {
+	if socket == "" {
+		socket = DefaultJournalSocket
+	}
+	w := &journalWriter{addr: &net.UnixAddr{Name: socket, Net: "unixgram"}}
+	if err := w.dial(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// dial connects to the socket, with the lock held.
+func (w *journalWriter) dial() error {
+	conn, err := net.DialUnix("unixgram", nil, w.addr)
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	return nil
+}
+
+func (w *journalWriter) WriteItem(m *logMeta, wproc func(w io.Writer)) error {
+	buf := getBuf()
+	defer putBuf(buf)
+	msg := m.msg
+	if msg == nil {
+		wproc((*byteWriter)(buf))
+		msg = *buf
+	}
+
+	dbuf := getBuf()
+	defer putBuf(dbuf)
+	b := appendJournalField(*dbuf, "MESSAGE", string(msg))
+	b = appendJournalField(b, "PRIORITY",
+		strconv.Itoa(syslogSeverity(m.lv)))
+	b = appendJournalField(b, "SYSLOG_IDENTIFIER", identifier)
+	if m.module != "" {
+		b = appendJournalField(b, "MODULE", m.module)
+	}
+	if m.file != "" {
+		b = appendJournalField(b, "CODE_FILE", m.file)
+		b = appendJournalField(b, "CODE_LINE", strconv.Itoa(m.line))
+	}
+	if len(m.trace) > 0 {
+		b = appendJournalField(b, "TRACE_ID",
+			m.trace[len(m.trace)-1].ID.String())
+		b = appendJournalField(b, "TRACE", m.trace.String())
+	}
+	for _, f := range m.fields {
+		if k := journalKey(f.key); k != "" {
+			b = appendJournalField(b, k, fieldText(f.value))
+		}
+	}
+	*dbuf = b
+
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if w.closed {
+		return net.ErrClosed
+	}
+	if w.conn == nil {
+		// the last redial failed, journald may be back by now
+		if err := w.dial(); err != nil {
+			return err
+		}
+	}
+	err := w.send(b)
+	if isConnError(err) {
+		// journald has been restarted with a new socket
+		w.conn.Close()
+		w.conn = nil
+		if err = w.dial(); err == nil {
+			err = w.send(b)
+		}
+	}
+	return err
+}
+
+// isConnError reports whether a write failed as the peer is gone or the
+// connection is closed, so that it is worth redialing.
+func isConnError(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ENOTCONN) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, net.ErrClosed)
+}
+
+// send writes a record as a datagram, with the lock held.
+func (w *journalWriter) send(data []byte) error {
+	_, err := w.conn.Write(data)
+	if errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS) {
+		// too large for a datagram, pass it in a file instead
+		return sendJournalFile(w.conn, data)
+	}
+	return err
+}
+
+func (w *journalWriter) Close() error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	w.closed = true
+	if w.conn == nil {
+		return nil
+	}
+	return w.conn.Close()
+}
@@ -0,0 +1,141 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// parseJournalFields parses a datagram of the native journal protocol.
+func parseJournalFields(data []byte) map[string]string {
+	ret := make(map[string]string)
+	for len(data) > 0 {
+		nl := bytes.IndexByte(data, '\n')
+		So(nl, ShouldBeGreaterThan, 0)
+		line := data[:nl]
+		if k, v, ok := bytes.Cut(line, []byte("=")); ok {
+			ret[string(k)] = string(v)
+			data = data[nl+1:]
+			continue
+		}
+		n := binary.LittleEndian.Uint64(data[nl+1:])
+		ret[string(line)] = string(data[nl+9 : nl+9+int(n)])
+		So(data[nl+9+int(n)], ShouldEqual, '\n')
+		data = data[nl+10+int(n):]
+	}
+	return ret
+}
+
+func TestJournalWriter(t *testing.T) {
+	Convey("Test journald writer", t, func() {
+		socket := filepath.Join(t.TempDir(), "journal.socket")
+		ln, err := net.ListenUnixgram("unixgram",
+			&net.UnixAddr{Name: socket, Net: "unixgram"})
+		So(err, ShouldBeNil)
+		defer ln.Close()
+		receive := func() map[string]string {
+			buf := make([]byte, 64<<10)
+			ln.SetReadDeadline(time.Now().Add(5 * time.Second))
+			n, err := ln.Read(buf)
+			So(err, ShouldBeNil)
+			return parseJournalFields(buf[:n])
+		}
+
+		jw, err := NewJournalWriter(socket)
+		So(err, ShouldBeNil)
+		defer jw.Close()
+		lw := NewLevelWriter(jw, jw, jw, jw, jw, jw, LLDebug)
+		ctx := WithTrace(WithTrace(context.Background(), "outer"), "inner")
+		l, _ := NewSimpleLogger("journaltest", "", lw).FromTrace(ctx)
+
+		l.With("player.id", 7, "message", "dup", "_hidden", 1, "9lives", 9).
+			Warnw("first line\nsecond line")
+		fields := receive()
+		trace := GetTrace(ctx)
+		So(fields, ShouldResemble, map[string]string{
+			"MESSAGE":           "first line\nsecond line",
+			"PRIORITY":          "4",
+			"SYSLOG_IDENTIFIER": identifier,
+			"MODULE":            "journaltest",
+			"CODE_FILE":         "journalwriter_test.go",
+			"CODE_LINE":         fields["CODE_LINE"],
+			"TRACE_ID":          trace[1].ID.String(),
+			"TRACE":             trace.String(),
+			"PLAYER_ID":         "7",
+			"FIELD_MESSAGE":     "dup",
+			"HIDDEN":            "1",
+			"FIELD_9LIVES":      "9",
+		})
+		So(fields["CODE_LINE"], ShouldNotBeEmpty)
+
+		l.Debug("debug")
+		So(receive()["PRIORITY"], ShouldEqual, "7")
+
+		Convey("Reconnects after journald is restarted", func() {
+			ln.Close()
+			os.Remove(socket)
+			m := &logMeta{lv: LLInfo, msg: []byte("lost")}
+			So(jw.WriteItem(m, nil), ShouldNotBeNil)
+			// the failed redial leaves no connection behind
+			So(jw.WriteItem(m, nil), ShouldNotBeNil)
+
+			ln, err = net.ListenUnixgram("unixgram",
+				&net.UnixAddr{Name: socket, Net: "unixgram"})
+			So(err, ShouldBeNil)
+			defer ln.Close()
+			m.msg = []byte("back")
+			So(jw.WriteItem(m, nil), ShouldBeNil)
+			So(receive()["MESSAGE"], ShouldEqual, "back")
+
+			// a closed connection is redialed as well
+			jw.(*journalWriter).conn.Close()
+			m.msg = []byte("again")
+			So(jw.WriteItem(m, nil), ShouldBeNil)
+			So(receive()["MESSAGE"], ShouldEqual, "again")
+
+			So(jw.Close(), ShouldBeNil)
+			So(jw.WriteItem(m, nil), ShouldEqual, net.ErrClosed)
+		})
+
+		Convey("Records too large for a datagram are passed in files", func() {
+			big := strings.Repeat("x", 4<<20)
+			So(jw.WriteItem(&logMeta{lv: LLInfo, msg: []byte(big)},
+				nil), ShouldBeNil)
+			oob := make([]byte, syscall.CmsgSpace(4))
+			ln.SetReadDeadline(time.Now().Add(5 * time.Second))
+			n, oobn, _, _, err := ln.ReadMsgUnix(nil, oob)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 0)
+			msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+			So(err, ShouldBeNil)
+			So(msgs, ShouldHaveLength, 1)
+			fds, err := syscall.ParseUnixRights(&msgs[0])
+			So(err, ShouldBeNil)
+			f := os.NewFile(uintptr(fds[0]), "journal")
+			defer f.Close()
+			data, err := io.ReadAll(io.NewSectionReader(f, 0, 8<<20))
+			So(err, ShouldBeNil)
+			So(parseJournalFields(data)["MESSAGE"], ShouldEqual, big)
+		})
+	})
+
+	Convey("Test journal field names", t, func() {
+		for k, v := range map[string]string{
+			"player": "PLAYER", "req.method": "REQ_METHOD",
+			"__x": "X", "!!": "", "priority": "FIELD_PRIORITY",
+			strings.Repeat("a", 70): strings.Repeat("A", 64),
+		} {
+			So(journalKey(k), ShouldEqual, v)
+		}
+	})
+}
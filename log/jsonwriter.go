@@ -0,0 +1,146 @@
+package log
+
+import (
+	"io"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// jsonWriter implements a RawWriter which writes records as JSON objects.
+type jsonWriter struct {
+	out RawWriter
+}
+
+// NewJSONWriter creates a RawWriter which converts each record to a JSON
+// object, and writes it as a single record to out. With a line based writer
+// like NewSimpWriter or NewRotateWriter, the output is JSON Lines, such as:
+//
+//	{"ts":"2025-10-09T08:53:21.000+08:00","level":"info","module":"taskmgr",
+//	"file":"task.go","line":42,"trace":[{"id":"...","name":"start"}],
+//	"msg":"task started","task":"backup"}
+//
+// Key-value fields of the record are written as properties after msg.
+// Line breaks in the message are escaped, so a multi-line message is kept in
+// one record.
+func NewJSONWriter(out RawWriter) RawWriter {
+	return &jsonWriter{out: out}
+}
+
+func (w *jsonWriter) WriteItem(m *logMeta, wproc func(w io.Writer)) error {
+	msg := m.msg
+	if msg == nil {
+		// the whole record is the message if it is not separated
+		cbuf := getBuf()
+		defer putBuf(cbuf)
+		wproc((*byteWriter)(cbuf))
+		msg = *cbuf
+	}
+
+	buf := getBuf()
+	defer putBuf(buf)
+	b := append(*buf, `{"ts":"`...)
+	b = m.ts.AppendFormat(b, time.RFC3339Nano)
+	b = append(b, `","level":"`...)
+	b = append(b, levelTag(m.lv)...)
+	b = append(b, `","module":`...)
+	b = appendJSONString(b, m.module)
+	if m.file != "" {
+		b = append(b, `,"file":`...)
+		b = appendJSONString(b, m.file)
+		b = append(b, `,"line":`...)
+		b = strconv.AppendInt(b, int64(m.line), 10)
+	}
+	if len(m.trace) > 0 {
+		b = append(b, `,"trace":[`...)
+		for i, t := range m.trace {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = append(b, `{"id":"`...)
+			b = append(b, t.ID.String()...)
+			b = append(b, '"')
+			if t.Name != "" {
+				b = append(b, `,"name":`...)
+				b = appendJSONString(b, t.Name)
+			}
+			b = append(b, '}')
+		}
+		b = append(b, ']')
+	}
+	b = append(b, `,"msg":`...)
+	b = appendJSONString(b, string(msg))
+	b = appendJSONFields(b, m.fields)
+	b = append(b, '}')
+	*buf = b
+
+	return w.out.WriteItem(m, func(w io.Writer) {
+		w.Write(b)
+	})
+}
+
+// levelTag returns the lower case name of the level for structured output.
+func levelTag(level Level) string {
+	switch level {
+	case LLDebug:
+		return "debug"
+	case LLInfo:
+		return "info"
+	case LLWarn:
+		return "warn"
+	case LLError:
+		return "error"
+	case llPanic:
+		return "panic"
+	case llFatal:
+		return "fatal"
+	default:
+		return "unknown"
+	}
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendJSONString appends s as a quoted JSON string. Invalid UTF-8 is
+// replaced by U+FFFD.
+func appendJSONString(b []byte, s string) []byte {
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				b = append(b, '\\', c)
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			default:
+				b = append(b, '\\', 'u', '0', '0',
+					hexDigits[c>>4], hexDigits[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, s[start:i]...)
+			b = append(b, `\ufffd`...)
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
@@ -0,0 +1,73 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestJSONWriter(t *testing.T) {
+	Convey("Test JSON writer", t, func() {
+		var buf bytes.Buffer
+		jw := NewJSONWriter(NewSimpWriter(&buf))
+		lw := NewLevelWriter(jw, jw, jw, jw, jw, jw, LLDebug)
+		lines := func() []map[string]interface{} {
+			var ret []map[string]interface{}
+			out := strings.TrimSuffix(buf.String(), "\n")
+			for _, l := range strings.Split(out, "\n") {
+				var v map[string]interface{}
+				So(json.Unmarshal([]byte(l), &v), ShouldBeNil)
+				ret = append(ret, v)
+			}
+			return ret
+		}
+
+		Convey("Records of a logger with trace", func() {
+			l := NewSimpleLogger("jsontest", "", lw)
+			ctx := WithTrace(WithTrace(context.Background(), "outer"), "inner")
+			tl, err := l.FromTrace(ctx)
+			So(err, ShouldBeNil)
+			l.Warn("plain")
+			tl.Info("line 1\nline 2 \"quoted\"\t", 42)
+
+			recs := lines()
+			So(recs, ShouldHaveLength, 2)
+			So(recs[0]["level"], ShouldEqual, "warn")
+			So(recs[0]["module"], ShouldEqual, "jsontest")
+			So(recs[0]["file"], ShouldEqual, "jsonwriter_test.go")
+			So(recs[0]["line"], ShouldBeGreaterThan, 0)
+			So(recs[0]["msg"], ShouldEqual, "plain")
+			So(recs[0], ShouldNotContainKey, "trace")
+			ts, err := time.Parse(time.RFC3339Nano, recs[0]["ts"].(string))
+			So(err, ShouldBeNil)
+			So(time.Since(ts), ShouldBeLessThan, time.Minute)
+
+			So(recs[1]["level"], ShouldEqual, "info")
+			So(recs[1]["msg"], ShouldEqual, "line 1\nline 2 \"quoted\"\t42")
+			trace := GetTrace(ctx)
+			So(recs[1]["trace"], ShouldResemble, []interface{}{
+				map[string]interface{}{
+					"id": trace[0].ID.String(), "name": "outer"},
+				map[string]interface{}{
+					"id": trace[1].ID.String(), "name": "inner"},
+			})
+		})
+
+		Convey("Records without a separated message", func() {
+			m := logMeta{ts: time.Now(), lv: LLError, module: "raw"}
+			So(jw.WriteItem(&m, func(w io.Writer) {
+				io.WriteString(w, "bad \xff\x01 bytes")
+			}), ShouldBeNil)
+			recs := lines()
+			So(recs, ShouldHaveLength, 1)
+			So(recs[0]["msg"], ShouldEqual, "bad \ufffd\x01 bytes")
+			So(recs[0], ShouldNotContainKey, "file")
+		})
+	})
+}
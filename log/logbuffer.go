@@ -0,0 +1,192 @@
+package log
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultLogBufferSize is the number of records held by a LogBuffer by
+	// default.
+	DefaultLogBufferSize = 1000
+	// size of the channels of followers, records are dropped for followers
+	// falling behind it.
+	followQueueSize = 256
+)
+
+// LogRecord is a record held by a LogBuffer.
+type LogRecord struct {
+	Seq    uint64     `json:"seq"` // increases by one for each record
+	TS     time.Time  `json:"ts"`
+	Level  Level      `json:"level"`
+	Module string     `json:"module"`
+	File   string     `json:"file,omitempty"`
+	Line   int        `json:"line,omitempty"`
+	Trace  TraceScope `json:"trace,omitempty"`
+	Msg    string     `json:"msg"`
+	// Fields is the key-value fields as a JSON object.
+	Fields json.RawMessage `json:"fields,omitempty"`
+	// Text is the whole record as formatted by the logger.
+	Text string `json:"text"`
+}
+
+// LogQuery filters the records of a LogBuffer. The zero value matches all.
+type LogQuery struct {
+	Level    Level     // the lowest level
+	Module   string    // the module name
+	Trace    string    // prefix of a trace ID in the trace scope
+	From, To time.Time // inclusive, zero for unbounded
+	Contains string    // substring of the text
+	After    uint64    // records after the sequence number
+	Limit    int       // the latest records, 0 for no limit
+}
+
+// Match checks whether a record matches the query, regardless of Limit.
+func (q *LogQuery) Match(r *LogRecord) bool {
+	if r.Seq <= q.After || r.Level < q.Level ||
+		(q.Module != "" && r.Module != q.Module) ||
+		(!q.From.IsZero() && r.TS.Before(q.From)) ||
+		(!q.To.IsZero() && r.TS.After(q.To)) ||
+		(q.Contains != "" && !strings.Contains(r.Text, q.Contains)) {
+		return false
+	}
+	if q.Trace == "" {
+		return true
+	}
+	for _, t := range r.Trace {
+		if strings.HasPrefix(t.ID.String(), q.Trace) {
+			return true
+		}
+	}
+	return false
+}
+
+// LogBuffer is a RawWriter holding the latest records in memory.
+type LogBuffer interface {
+	RawWriter
+	// Query returns the matched records in ascending order of Seq.
+	Query(q LogQuery) []LogRecord
+	// Follow sends the matched records written from now on, until ctx is
+	// done, and then the channel is closed. Records are dropped if the
+	// receiver falls behind, which is seen by a gap of Seq.
+	Follow(ctx context.Context, q LogQuery) <-chan LogRecord
+}
+
+// logFollower is a receiver of Follow.
+type logFollower struct {
+	q  LogQuery
+	ch chan LogRecord
+}
+
+// logBuffer implements LogBuffer with a ring.
+type logBuffer struct {
+	mtx       sync.RWMutex
+	records   []LogRecord
+	head      int // index of the oldest record
+	count     int
+	seq       uint64
+	followers map[*logFollower]struct{}
+}
+
+// NewLogBuffer creates a LogBuffer holding the latest size records, or
+// DefaultLogBufferSize if size is not positive.
+func NewLogBuffer(size int) LogBuffer {
+	if size <= 0 {
+		size = DefaultLogBufferSize
+	}
+	return &logBuffer{
+		records:   make([]LogRecord, size),
+		followers: make(map[*logFollower]struct{}),
+	}
+}
+
+func (b *logBuffer) WriteItem(m *logMeta, wproc func(w io.Writer)) error {
+	buf := getBuf()
+	defer putBuf(buf)
+	wproc((*byteWriter)(buf))
+	r := LogRecord{
+		TS:     m.ts,
+		Level:  m.lv,
+		Module: m.module,
+		File:   m.file,
+		Line:   m.line,
+		Trace:  m.trace,
+		Text:   string(*buf),
+	}
+	if m.msg != nil {
+		r.Msg = string(m.msg)
+	} else {
+		r.Msg = r.Text
+	}
+	if len(m.fields) > 0 {
+		// the leading comma is replaced by the brace
+		fields := appendJSONFields(nil, m.fields)
+		fields[0] = '{'
+		r.Fields = append(fields, '}')
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.seq++
+	r.Seq = b.seq
+	if b.count < len(b.records) {
+		b.records[(b.head+b.count)%len(b.records)] = r
+		b.count++
+	} else {
+		b.records[b.head] = r
+		b.head = (b.head + 1) % len(b.records)
+	}
+	for f := range b.followers {
+		if !f.q.Match(&r) {
+			continue
+		}
+		select {
+		case f.ch <- r:
+		default:
+		}
+	}
+	return nil
+}
+
+func (b *logBuffer) Query(q LogQuery) []LogRecord {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+	var ret []LogRecord
+	// from the latest to apply the limit
+	for i := b.count - 1; i >= 0; i-- {
+		r := &b.records[(b.head+i)%len(b.records)]
+		if r.Seq <= q.After {
+			break
+		}
+		if !q.Match(r) {
+			continue
+		}
+		ret = append(ret, *r)
+		if q.Limit > 0 && len(ret) == q.Limit {
+			break
+		}
+	}
+	for i, j := 0, len(ret)-1; i < j; i, j = i+1, j-1 {
+		ret[i], ret[j] = ret[j], ret[i]
+	}
+	return ret
+}
+
+func (b *logBuffer) Follow(ctx context.Context, q LogQuery) <-chan LogRecord {
+	f := &logFollower{q: q, ch: make(chan LogRecord, followQueueSize)}
+	b.mtx.Lock()
+	b.followers[f] = struct{}{}
+	b.mtx.Unlock()
+	go func() {
+		<-ctx.Done()
+		b.mtx.Lock()
+		delete(b.followers, f)
+		b.mtx.Unlock()
+		close(f.ch)
+	}()
+	return f.ch
+}
@@ -0,0 +1,112 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLogBuffer(t *testing.T) {
+	Convey("Test log buffer", t, func() {
+		buf := NewLogBuffer(5)
+		var text bytes.Buffer
+		out := NewMultiWriter(NewSimpWriter(&text), buf)
+		lw := NewLevelWriter(out, out, out, out, out, out, LLDebug)
+		app := NewSimpleLogger("app", "", lw)
+		db := NewSimpleLogger("db", "", lw)
+		ctx := WithTrace(context.Background(), "req")
+		tapp, _ := app.FromTrace(ctx)
+		traceID := GetTrace(ctx)[0].ID.String()
+
+		app.Debug("debug 1")
+		db.Info("query slow")
+		tapp.With("player", "p1").Warnw("player kicked")
+		db.Error("connection lost\nretrying")
+
+		Convey("Records keep the metadata", func() {
+			recs := buf.Query(LogQuery{})
+			So(recs, ShouldHaveLength, 4)
+			So(recs[0].Seq, ShouldEqual, 1)
+			So(recs[3].Seq, ShouldEqual, 4)
+			r := recs[2]
+			So(r.Level, ShouldEqual, LLWarn)
+			So(r.Module, ShouldEqual, "app")
+			So(r.File, ShouldEqual, "logbuffer_test.go")
+			So(r.Msg, ShouldEqual, "player kicked")
+			So(string(r.Fields), ShouldEqual, `{"player":"p1"}`)
+			So(r.Trace, ShouldResemble, GetTrace(ctx))
+			So(r.Text, ShouldContainSubstring, "player kicked player=p1")
+			So(recs[3].Msg, ShouldEqual, "connection lost\nretrying")
+			So(text.String(), ShouldContainSubstring, "player kicked")
+
+			data, err := json.Marshal(r)
+			So(err, ShouldBeNil)
+			var back LogRecord
+			So(json.Unmarshal(data, &back), ShouldBeNil)
+			So(back.Level, ShouldEqual, LLWarn)
+			So(back.Trace, ShouldResemble, r.Trace)
+			So(string(data), ShouldContainSubstring,
+				`"trace":[{"id":"`+traceID+`","name":"req"}]`)
+		})
+
+		Convey("Query by filters", func() {
+			seqs := func(q LogQuery) []uint64 {
+				var ret []uint64
+				for _, r := range buf.Query(q) {
+					ret = append(ret, r.Seq)
+				}
+				return ret
+			}
+			So(seqs(LogQuery{Level: LLWarn}), ShouldResemble, []uint64{3, 4})
+			So(seqs(LogQuery{Module: "db"}), ShouldResemble, []uint64{2, 4})
+			So(seqs(LogQuery{Trace: traceID[:8]}), ShouldResemble,
+				[]uint64{3})
+			So(seqs(LogQuery{Contains: "slow"}), ShouldResemble, []uint64{2})
+			So(seqs(LogQuery{After: 2}), ShouldResemble, []uint64{3, 4})
+			So(seqs(LogQuery{Limit: 3}), ShouldResemble, []uint64{2, 3, 4})
+			So(seqs(LogQuery{From: time.Now().Add(time.Minute)}),
+				ShouldBeEmpty)
+			So(seqs(LogQuery{To: time.Now()}), ShouldHaveLength, 4)
+		})
+
+		Convey("Only the latest records are held", func() {
+			for i := 0; i < 3; i++ {
+				app.Info(fmt.Sprint("more ", i))
+			}
+			recs := buf.Query(LogQuery{})
+			So(recs, ShouldHaveLength, 5)
+			So(recs[0].Seq, ShouldEqual, 3)
+			So(recs[4].Msg, ShouldEqual, "more 2")
+		})
+
+		Convey("Follow the new records", func() {
+			fctx, cancel := context.WithCancel(context.Background())
+			ch := buf.Follow(fctx, LogQuery{Level: LLWarn})
+			app.Info("ignored")
+			app.Error("followed")
+			r := <-ch
+			So(r.Msg, ShouldEqual, "followed")
+			So(r.Seq, ShouldEqual, 6)
+			cancel()
+			_, ok := <-ch
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("Parse levels", func() {
+			for s, lv := range map[string]Level{"DEBUG": LLDebug,
+				"info": LLInfo, "WARNING": LLWarn, "warn": LLWarn,
+				"Error": LLError} {
+				got, err := ParseLevel(s)
+				So(err, ShouldBeNil)
+				So(got, ShouldEqual, lv)
+			}
+			_, err := ParseLevel("fatal")
+			So(err, ShouldWrap, ErrLevelName)
+		})
+	})
+}
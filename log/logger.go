@@ -2,6 +2,9 @@ package log
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"sync"
 )
 
@@ -19,7 +22,15 @@ const (
 	llFatal
 )
 
+var (
+	ErrLevelName = errors.New("unknown log level")
+)
+
 // LevelLogger represents a leveled logger.
+//
+// Debugw, Infow, Warnw, Errorw and With were added along with structured
+// fields. Implementations of LevelLogger outside of this package must add
+// them, or embed a LevelLogger from NewSimpleLogger to get them.
 type LevelLogger interface {
 	Debug(args ...interface{})
 	// The method with suffix "xt" returns log function if the log level is
@@ -33,6 +44,12 @@ type LevelLogger interface {
 	Warnxt() func(args ...interface{})
 	Error(args ...interface{})
 	Errorxt() func(args ...interface{})
+	// The method with suffix "w" logs a message with key-value fields given
+	// as alternating keys and values, such as Infow("joined", "player", id).
+	Debugw(msg string, keyvals ...interface{})
+	Infow(msg string, keyvals ...interface{})
+	Warnw(msg string, keyvals ...interface{})
+	Errorw(msg string, keyvals ...interface{})
 	// Fatal logs a message at fatal level and exits the application os.Exit(1).
 	Fatal(args ...interface{})
 	// Panic logs a message at panic level and panics the application.
@@ -42,6 +59,11 @@ type LevelLogger interface {
 	// method.
 	// The TraceID will be logged in the log message.
 	FromTrace(ctx context.Context) (LevelLogger, error)
+	// With derivatively creates a new logger with key-value fields, given as
+	// alternating keys and values. The fields are logged with every message
+	// as k=v in text, or as properties by structured writers like
+	// NewJSONWriter.
+	With(keyvals ...interface{}) LevelLogger
 	// SetLevel sets the log level.
 	SetLevel(level Level)
 }
@@ -83,3 +105,35 @@ func levelName(level Level) string {
 		return "UNKNOWN"
 	}
 }
+
+// ParseLevel parses a level by the name, such as "info" or "WARNING",
+// case insensitively.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return LLDebug, nil
+	case "info":
+		return LLInfo, nil
+	case "warn", "warning":
+		return LLWarn, nil
+	case "error":
+		return LLError, nil
+	}
+	return 0, fmt.Errorf("%w: %q", ErrLevelName, s)
+}
+
+// MarshalText implements encoding.TextMarshaler, levels are written in lower
+// case as by NewJSONWriter.
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(levelTag(l)), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (l *Level) UnmarshalText(text []byte) error {
+	lv, err := ParseLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*l = lv
+	return nil
+}
@@ -18,11 +18,16 @@ var (
 
 // logMeta represents the metadata of a log record.
 type logMeta struct {
-	ts     time.Time // timestamp
-	lv     Level     // log level
-	file   string    // source code file
-	line   int       // source code line
-	module string    // module name or logger name
+	ts     time.Time  // timestamp
+	lv     Level      // log level
+	file   string     // source code file
+	line   int        // source code line
+	module string     // module name or logger name
+	trace  TraceScope // trace scope of the logger, if any
+	fields []field    // key-value fields of the logger and the call
+	// msg is the message without the formatted prefix. It is only valid
+	// during WriteItem, and may be nil if the caller does not separate it.
+	msg []byte
 }
 
 // RawWriter represents a writer that writes raw log data.
@@ -38,10 +43,17 @@ type RawWriter interface {
 	WriteItem(*logMeta, func(w io.Writer)) error
 }
 
+// RawWriteCloser is a RawWriter which needs to be closed, such as the
+// writers of sockets.
+type RawWriteCloser interface {
+	RawWriter
+	io.Closer
+}
+
 // simpWriter implements a very simple RawWriter.
 // It writes the log data to the given io.Writer. It assume the IO never be
 // close, also, it does not support any additional features like log rotation,
-// limitaion, etc.
+// limitaion, etc. See NewRotateWriter for files with rotation.
 type simpWriter struct {
 	mtx sync.Mutex
 	w   io.Writer
@@ -67,3 +79,24 @@ func (w *simpWriter) WriteItem(m *logMeta, wproc func(w io.Writer)) error {
 	w.w.Write([]byte{'\n'})
 	return nil
 }
+
+// multiWriter implements a RawWriter duplicating records to writers.
+type multiWriter struct {
+	writers []RawWriter
+}
+
+// NewMultiWriter creates a RawWriter which writes each record to all the
+// writers in order, and returns the errors of them joined.
+func NewMultiWriter(writers ...RawWriter) RawWriter {
+	return &multiWriter{writers: writers}
+}
+
+func (w *multiWriter) WriteItem(m *logMeta, wproc func(w io.Writer)) error {
+	var errs []error
+	for _, rw := range w.writers {
+		if err := rw.WriteItem(m, wproc); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -10,12 +10,17 @@ import (
 	"time"
 )
 
+// defaultTimeFormat is the time format of text records by default.
+const defaultTimeFormat = "01-02,2006 15:04:05.000"
+
 // simpLogger provides a simple LevelLogger implementation.
 type simpLogger struct {
 	timefmt    string
 	modulename string
 	writer     LevelWriter
 	traceinfo  string
+	trace      TraceScope
+	fields     []field
 }
 
 // NewSimpleLogger returns a new simple LevelLogger.
@@ -26,7 +31,7 @@ func NewSimpleLogger(
 ) LevelLogger {
 	tfmt := timefmt
 	if tfmt == "" {
-		tfmt = "01-02,2006 15:04:05.000"
+		tfmt = defaultTimeFormat
 	}
 	return &simpLogger{
 		timefmt:    tfmt,
@@ -37,12 +42,15 @@ func NewSimpleLogger(
 
 // format the log message.
 func (l *simpLogger) formatter(
-	rww RawWriter, lv Level, cdp int, bfunc func([]byte), args ...interface{},
+	rww RawWriter, lv Level, cdp int, fields []field, bfunc func([]byte),
+	args ...interface{},
 ) {
 	m := logMeta{
 		ts:     time.Now(),
 		lv:     lv,
 		module: l.modulename,
+		trace:  l.trace,
+		fields: fields,
 	}
 	_, file, line, ok := runtime.Caller(cdp)
 	if ok {
@@ -50,23 +58,35 @@ func (l *simpLogger) formatter(
 		m.line = line
 	}
 
-	levelname := levelName(lv)
-	time := m.ts.Format(l.timefmt)
+	writeTextRecord(rww, &m, l.timefmt, l.traceinfo, bfunc, args...)
+}
+
+// writeTextRecord formats a record in text with the message of args and the
+// fields of m, and writes it to rww.
+func writeTextRecord(
+	rww RawWriter, m *logMeta, timefmt, traceinfo string, bfunc func([]byte),
+	args ...interface{},
+) {
+	levelname := levelName(m.lv)
+	time := m.ts.Format(timefmt)
 
 	buf := getBuf()
 	defer putBuf(buf)
 	*buf = fmt.Appendf(*buf, "%s % 7s %s (%s:%d)",
-		time, levelname, l.modulename, m.file, m.line)
-	if l.traceinfo != "" {
-		*buf = fmt.Append(*buf, " [#T:", l.traceinfo, "] - ")
+		time, levelname, m.module, m.file, m.line)
+	if traceinfo != "" {
+		*buf = fmt.Append(*buf, " [#T:", traceinfo, "] - ")
 	} else {
 		*buf = fmt.Append(*buf, " - ")
 	}
+	msgStart := len(*buf)
 	*buf = fmt.Append(*buf, args...)
+	m.msg = (*buf)[msgStart:]
+	*buf = appendTextFields(*buf, m.fields)
 	if bfunc != nil {
 		bfunc(*buf)
 	}
-	rww.WriteItem(&m, func(w io.Writer) {
+	rww.WriteItem(m, func(w io.Writer) {
 		w.Write(*buf)
 	})
 }
@@ -77,7 +97,16 @@ func (l *simpLogger) tolog(level Level, args ...interface{}) {
 	if rww == nil {
 		return
 	}
-	l.formatter(rww, level, 3, nil, args...)
+	l.formatter(rww, level, 3, l.fields, nil, args...)
+}
+
+// direct log with fields to writer.
+func (l *simpLogger) tologw(level Level, msg string, keyvals []interface{}) {
+	rww := l.writer.Write(level)
+	if rww == nil {
+		return
+	}
+	l.formatter(rww, level, 3, appendFields(l.fields, keyvals), nil, msg)
 }
 
 // getPrinter returns log printer if the level is enabled.
@@ -87,7 +116,7 @@ func (l *simpLogger) getPrinter(level Level) func(args ...interface{}) {
 		return nil
 	}
 	return func(args ...interface{}) {
-		l.formatter(rww, level, 2, nil, args...)
+		l.formatter(rww, level, 2, l.fields, nil, args...)
 	}
 }
 
@@ -99,6 +128,10 @@ func (l *simpLogger) Debugxt() func(args ...interface{}) {
 	return l.getPrinter(LLDebug)
 }
 
+func (l *simpLogger) Debugw(msg string, keyvals ...interface{}) {
+	l.tologw(LLDebug, msg, keyvals)
+}
+
 func (l *simpLogger) Info(args ...interface{}) {
 	l.tolog(LLInfo, args...)
 }
@@ -107,6 +140,10 @@ func (l *simpLogger) Infoxt() func(args ...interface{}) {
 	return l.getPrinter(LLInfo)
 }
 
+func (l *simpLogger) Infow(msg string, keyvals ...interface{}) {
+	l.tologw(LLInfo, msg, keyvals)
+}
+
 func (l *simpLogger) Warn(args ...interface{}) {
 	l.tolog(LLWarn, args...)
 }
@@ -115,6 +152,10 @@ func (l *simpLogger) Warnxt() func(args ...interface{}) {
 	return l.getPrinter(LLWarn)
 }
 
+func (l *simpLogger) Warnw(msg string, keyvals ...interface{}) {
+	l.tologw(LLWarn, msg, keyvals)
+}
+
 func (l *simpLogger) Error(args ...interface{}) {
 	l.tolog(LLError, args...)
 }
@@ -123,6 +164,10 @@ func (l *simpLogger) Errorxt() func(args ...interface{}) {
 	return l.getPrinter(LLError)
 }
 
+func (l *simpLogger) Errorw(msg string, keyvals ...interface{}) {
+	l.tologw(LLError, msg, keyvals)
+}
+
 func (l *simpLogger) Fatal(args ...interface{}) {
 	l.tolog(llFatal, args...)
 	os.Exit(1)
@@ -143,10 +188,23 @@ func (l *simpLogger) FromTrace(ctx context.Context) (LevelLogger, error) {
 		modulename: l.modulename,
 		writer:     l.writer.Clone(),
 		traceinfo:  t.String(),
+		trace:      t,
+		fields:     l.fields,
 	}
 	return nl, nil
 }
 
+func (l *simpLogger) With(keyvals ...interface{}) LevelLogger {
+	return &simpLogger{
+		timefmt:    l.timefmt,
+		modulename: l.modulename,
+		writer:     l.writer.Clone(),
+		traceinfo:  l.traceinfo,
+		trace:      l.trace,
+		fields:     appendFields(l.fields, keyvals),
+	}
+}
+
 func (l *simpLogger) SetLevel(level Level) {
 	l.writer.SetLevel(level)
 }
@@ -0,0 +1,315 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// slog levels of the internal levels, above slog.LevelError.
+const (
+	slogLevelFatal = slog.LevelError + 4
+	slogLevelPanic = slog.LevelError + 8
+)
+
+// fromSlogLevel maps a slog level to the nearest level not above it.
+func fromSlogLevel(level slog.Level) Level {
+	switch {
+	case level >= slogLevelPanic:
+		return llPanic
+	case level >= slogLevelFatal:
+		return llFatal
+	case level >= slog.LevelError:
+		return LLError
+	case level >= slog.LevelWarn:
+		return LLWarn
+	case level >= slog.LevelInfo:
+		return LLInfo
+	default:
+		return LLDebug
+	}
+}
+
+// toSlogLevel maps a level to slog.
+func toSlogLevel(level Level) slog.Level {
+	switch level {
+	case LLDebug:
+		return slog.LevelDebug
+	case LLInfo:
+		return slog.LevelInfo
+	case LLWarn:
+		return slog.LevelWarn
+	case llFatal:
+		return slogLevelFatal
+	case llPanic:
+		return slogLevelPanic
+	default:
+		return slog.LevelError
+	}
+}
+
+// slogHandler implements slog.Handler over a LevelWriter.
+type slogHandler struct {
+	module  string
+	timefmt string
+	writer  LevelWriter
+	fields  []field
+	group   string // prefix of the keys of attributes, such as "req."
+}
+
+// NewSlogHandler creates a slog.Handler which writes records to writer in
+// the same form as NewSimpleLogger. Attributes become key-value fields,
+// with keys in groups prefixed like "req.method", the trace of the context
+// given by WithTrace is logged as well.
+func NewSlogHandler(
+	modulename string,
+	timefmt string,
+	writer LevelWriter,
+) slog.Handler {
+	if timefmt == "" {
+		timefmt = defaultTimeFormat
+	}
+	return &slogHandler{
+		module:  modulename,
+		timefmt: timefmt,
+		writer:  writer,
+	}
+}
+
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.writer.Write(fromSlogLevel(level)) != nil
+}
+
+func (h *slogHandler) Handle(ctx context.Context, r slog.Record) error {
+	lv := fromSlogLevel(r.Level)
+	rww := h.writer.Write(lv)
+	if rww == nil {
+		return nil
+	}
+	m := logMeta{
+		ts:     r.Time,
+		lv:     lv,
+		module: h.module,
+		trace:  GetTrace(ctx),
+		fields: h.fields,
+	}
+	if m.ts.IsZero() {
+		m.ts = time.Now()
+	}
+	if r.PC != 0 {
+		f, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		m.file = path.Base(f.File)
+		m.line = f.Line
+	}
+	if r.NumAttrs() > 0 {
+		fields := make([]field, len(h.fields), len(h.fields)+r.NumAttrs())
+		copy(fields, h.fields)
+		r.Attrs(func(a slog.Attr) bool {
+			fields = appendSlogAttr(fields, h.group, a)
+			return true
+		})
+		m.fields = fields
+	}
+	writeTextRecord(rww, &m, h.timefmt, m.trace.String(), nil, r.Message)
+	return nil
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	nh := *h
+	nh.fields = make([]field, len(h.fields), len(h.fields)+len(attrs))
+	copy(nh.fields, h.fields)
+	for _, a := range attrs {
+		nh.fields = appendSlogAttr(nh.fields, h.group, a)
+	}
+	return &nh
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	nh := *h
+	nh.group = h.group + name + "."
+	return &nh
+}
+
+// appendSlogAttr appends an attribute as fields, groups are flattened with
+// prefixed keys.
+func appendSlogAttr(fields []field, prefix string, a slog.Attr) []field {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		attrs := v.Group()
+		if len(attrs) == 0 {
+			return fields
+		}
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range attrs {
+			fields = appendSlogAttr(fields, prefix, ga)
+		}
+		return fields
+	}
+	if a.Key == "" {
+		return fields
+	}
+	return append(fields, field{key: prefix + a.Key, value: v.Any()})
+}
+
+// slogLogger implements LevelLogger over a slog.Logger.
+type slogLogger struct {
+	handler slog.Handler
+	ctx     context.Context
+	level   *atomic.Int32
+}
+
+// NewSlogLogger wraps a slog.Logger as a LevelLogger. Messages are logged
+// with the source of the caller, and the trace given by FromTrace is passed
+// in the context, which is logged by handlers of NewSlogHandler, or as the
+// "trace" attribute by other handlers. SetLevel filters the messages before
+// the level of the handler.
+func NewSlogLogger(l *slog.Logger) LevelLogger {
+	return &slogLogger{
+		handler: l.Handler(),
+		ctx:     context.Background(),
+		level:   new(atomic.Int32),
+	}
+}
+
+// enabled checks whether the level is enabled by both the logger and the
+// handler.
+func (l *slogLogger) enabled(level Level) bool {
+	if level <= LLError && level < Level(l.level.Load()) {
+		return false
+	}
+	return l.handler.Enabled(l.ctx, toSlogLevel(level))
+}
+
+// log sends a record to the handler, cdp is the depth of the caller.
+func (l *slogLogger) log(
+	level Level, cdp int, msg string, keyvals []interface{},
+) {
+	var pcs [1]uintptr
+	runtime.Callers(cdp+2, pcs[:])
+	r := slog.NewRecord(time.Now(), toSlogLevel(level), msg, pcs[0])
+	r.Add(keyvals...)
+	l.handler.Handle(l.ctx, r)
+}
+
+// tolog logs the message of args if the level is enabled.
+func (l *slogLogger) tolog(level Level, args ...interface{}) {
+	if l.enabled(level) {
+		l.log(level, 2, fmt.Sprint(args...), nil)
+	}
+}
+
+// tologw logs msg with fields if the level is enabled.
+func (l *slogLogger) tologw(level Level, msg string, keyvals []interface{}) {
+	if l.enabled(level) {
+		l.log(level, 2, msg, keyvals)
+	}
+}
+
+// getPrinter returns log printer if the level is enabled.
+func (l *slogLogger) getPrinter(level Level) func(args ...interface{}) {
+	if !l.enabled(level) {
+		return nil
+	}
+	return func(args ...interface{}) {
+		l.log(level, 1, fmt.Sprint(args...), nil)
+	}
+}
+
+func (l *slogLogger) Debug(args ...interface{}) {
+	l.tolog(LLDebug, args...)
+}
+
+func (l *slogLogger) Debugxt() func(args ...interface{}) {
+	return l.getPrinter(LLDebug)
+}
+
+func (l *slogLogger) Debugw(msg string, keyvals ...interface{}) {
+	l.tologw(LLDebug, msg, keyvals)
+}
+
+func (l *slogLogger) Info(args ...interface{}) {
+	l.tolog(LLInfo, args...)
+}
+
+func (l *slogLogger) Infoxt() func(args ...interface{}) {
+	return l.getPrinter(LLInfo)
+}
+
+func (l *slogLogger) Infow(msg string, keyvals ...interface{}) {
+	l.tologw(LLInfo, msg, keyvals)
+}
+
+func (l *slogLogger) Warn(args ...interface{}) {
+	l.tolog(LLWarn, args...)
+}
+
+func (l *slogLogger) Warnxt() func(args ...interface{}) {
+	return l.getPrinter(LLWarn)
+}
+
+func (l *slogLogger) Warnw(msg string, keyvals ...interface{}) {
+	l.tologw(LLWarn, msg, keyvals)
+}
+
+func (l *slogLogger) Error(args ...interface{}) {
+	l.tolog(LLError, args...)
+}
+
+func (l *slogLogger) Errorxt() func(args ...interface{}) {
+	return l.getPrinter(LLError)
+}
+
+func (l *slogLogger) Errorw(msg string, keyvals ...interface{}) {
+	l.tologw(LLError, msg, keyvals)
+}
+
+func (l *slogLogger) Fatal(args ...interface{}) {
+	l.tolog(llFatal, args...)
+	os.Exit(1)
+}
+
+func (l *slogLogger) Panic(args ...interface{}) {
+	l.tolog(llPanic, args...)
+	panic(fmt.Sprint(args...))
+}
+
+func (l *slogLogger) FromTrace(ctx context.Context) (LevelLogger, error) {
+	t := GetTrace(ctx)
+	if t == nil {
+		return nil, fmt.Errorf("no trace info found")
+	}
+	h := l.handler
+	if _, ok := h.(*slogHandler); !ok {
+		h = h.WithAttrs([]slog.Attr{slog.String("trace", t.String())})
+	}
+	level := new(atomic.Int32)
+	level.Store(l.level.Load())
+	return &slogLogger{handler: h, ctx: ctx, level: level}, nil
+}
+
+func (l *slogLogger) With(keyvals ...interface{}) LevelLogger {
+	level := new(atomic.Int32)
+	level.Store(l.level.Load())
+	return &slogLogger{
+		handler: slog.New(l.handler).With(keyvals...).Handler(),
+		ctx:     l.ctx,
+		level:   level,
+	}
+}
+
+func (l *slogLogger) SetLevel(level Level) {
+	l.level.Store(int32(checkLevel(level)))
+}
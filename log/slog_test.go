@@ -0,0 +1,124 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSlogBridge(t *testing.T) {
+	Convey("Test slog handler", t, func() {
+		var buf bytes.Buffer
+		jw := NewJSONWriter(NewSimpWriter(&buf))
+		lw := NewLevelWriter(jw, jw, jw, jw, jw, jw, LLInfo)
+		sl := slog.New(NewSlogHandler("slogtest", "", lw))
+		records := func() []map[string]interface{} {
+			var ret []map[string]interface{}
+			out := strings.TrimSpace(buf.String())
+			for _, l := range strings.Split(out, "\n") {
+				var v map[string]interface{}
+				So(json.Unmarshal([]byte(l), &v), ShouldBeNil)
+				ret = append(ret, v)
+			}
+			return ret
+		}
+
+		ctx := WithTrace(context.Background(), "req")
+		sl.Debug("hidden")
+		So(sl.Enabled(ctx, slog.LevelDebug), ShouldBeFalse)
+		sl.With("server", "palworld").WithGroup("req").
+			InfoContext(ctx, "handled", "method", "GET",
+				slog.Group("user", "id", 7), slog.Group("empty"))
+		sl.Log(ctx, slog.LevelWarn+2, "warn+2")
+		sl.Error("failed")
+
+		recs := records()
+		So(recs, ShouldHaveLength, 3)
+		So(recs[0]["level"], ShouldEqual, "info")
+		So(recs[0]["module"], ShouldEqual, "slogtest")
+		So(recs[0]["file"], ShouldEqual, "slog_test.go")
+		So(recs[0]["msg"], ShouldEqual, "handled")
+		So(recs[0]["server"], ShouldEqual, "palworld")
+		So(recs[0]["req.method"], ShouldEqual, "GET")
+		So(recs[0]["req.user.id"], ShouldEqual, 7)
+		So(recs[0]["trace"], ShouldResemble, []interface{}{
+			map[string]interface{}{
+				"id": GetTrace(ctx)[0].ID.String(), "name": "req"},
+		})
+		So(recs[1]["level"], ShouldEqual, "warn")
+		So(recs[2]["level"], ShouldEqual, "error")
+		So(recs[2], ShouldNotContainKey, "trace")
+	})
+
+	Convey("Test slog logger as LevelLogger", t, func() {
+		var buf bytes.Buffer
+		l := NewSlogLogger(slog.New(slog.NewJSONHandler(&buf,
+			&slog.HandlerOptions{AddSource: true, Level: slog.LevelDebug})))
+		record := func() map[string]interface{} {
+			var v map[string]interface{}
+			So(json.Unmarshal(buf.Bytes(), &v), ShouldBeNil)
+			buf.Reset()
+			return v
+		}
+
+		l.Info("hello ", 42)
+		rec := record()
+		So(rec["level"], ShouldEqual, "INFO")
+		So(rec["msg"], ShouldEqual, "hello 42")
+		So(rec["source"].(map[string]interface{})["file"], ShouldEndWith,
+			"slog_test.go")
+
+		ctx := WithTrace(context.Background(), "task")
+		tl, err := l.With("server", "palworld").FromTrace(ctx)
+		So(err, ShouldBeNil)
+		tl.Warnw("slow", "took", 3)
+		rec = record()
+		So(rec["level"], ShouldEqual, "WARN")
+		So(rec["server"], ShouldEqual, "palworld")
+		So(rec["took"], ShouldEqual, 3)
+		So(rec["trace"], ShouldEqual, GetTrace(ctx).String())
+
+		l.SetLevel(LLWarn)
+		So(l.Infoxt(), ShouldBeNil)
+		l.Info("filtered")
+		So(buf.Len(), ShouldEqual, 0)
+		l.Errorxt()("via printer")
+		rec = record()
+		So(rec["level"], ShouldEqual, "ERROR")
+		So(rec["source"].(map[string]interface{})["file"], ShouldEndWith,
+			"slog_test.go")
+
+		Convey("Round trip through both bridges keeps the trace", func() {
+			var out bytes.Buffer
+			jw := NewJSONWriter(NewSimpWriter(&out))
+			lw := NewLevelWriter(jw, jw, jw, jw, jw, jw, LLDebug)
+			bl := NewSlogLogger(slog.New(NewSlogHandler("rt", "", lw)))
+			tl, err := bl.FromTrace(ctx)
+			So(err, ShouldBeNil)
+			tl.Infow("done", "n", 1)
+			var v map[string]interface{}
+			So(json.Unmarshal(out.Bytes(), &v), ShouldBeNil)
+			So(v["file"], ShouldEqual, "slog_test.go")
+			So(v["n"], ShouldEqual, 1)
+			So(v["trace"], ShouldHaveLength, 1)
+			So(v, ShouldNotContainKey, "_trace")
+		})
+
+		Convey("Text records are formatted as NewSimpleLogger", func() {
+			var out bytes.Buffer
+			tw := NewSimpWriter(&out)
+			lw := NewLevelWriter(tw, tw, tw, tw, tw, tw, LLDebug)
+			slog.New(NewSlogHandler("rt", "", lw)).InfoContext(ctx,
+				"multi\nline", "k", "v w")
+			So(out.String(), ShouldContainSubstring,
+				" INFO rt (slog_test.go:")
+			So(out.String(), ShouldEndWith, "[#T:"+GetTrace(ctx).String()+
+				"] - multi\nline k=\"v w\"\n")
+		})
+	})
+}
@@ -0,0 +1,239 @@
+package log
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	ErrSyslogNetwork = errors.New("unsupported syslog network")
+)
+
+const (
+	// DefaultSyslogSocket is the socket of the local syslog daemon.
+	DefaultSyslogSocket = "/dev/log"
+	// FacilityUser is the syslog facility of user-level messages.
+	FacilityUser = 1
+	// FacilityLocal0 is the first of the local use facilities, local0 to
+	// local7.
+	FacilityLocal0 = 16
+	// syslogSDID is the ID of the structured data element of the metadata,
+	// under the enterprise number reserved for documentation by RFC 5612.
+	syslogSDID = "meta@32473"
+	// syslogTimeLayout is RFC 3339 with microseconds as RFC 5424 allows.
+	syslogTimeLayout = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+// SyslogConfig configures a syslog writer.
+type SyslogConfig struct {
+	// Network is "unixgram", "unix", "udp" or "tcp". The local syslog
+	// daemon at DefaultSyslogSocket is used if both Network and Addr are
+	// empty.
+	Network string
+	Addr    string
+	// Facility is FacilityUser by default.
+	Facility int
+	// AppName is the name of the program by default.
+	AppName string
+	// Hostname is the name of the host by default.
+	Hostname string
+}
+
+// syslogWriter implements RawWriteCloser of syslog.
+type syslogWriter struct {
+	cfg    SyslogConfig
+	stream bool // frames messages by octet counting
+	pid    string
+	mtx    sync.Mutex
+	conn   net.Conn // nil after a failed redial
+	closed bool
+}
+
+// NewSyslogWriter creates a RawWriter which sends records to a syslog
+// server in the format of RFC 5424. Datagram sockets get one message per
+// datagram, stream sockets use octet counting of RFC 6587. Stream sockets
+// are reconnected once on a failed write, and datagram sockets once the
+// server is found gone, such as a restarted local daemon. The module,
+// source and trace of a record are in the structured data element
+// "meta@32473", with the key-value fields following them.
+func NewSyslogWriter(cfg SyslogConfig) (RawWriteCloser, error) {
+	if cfg.Network == "" && cfg.Addr == "" {
+		cfg.Network, cfg.Addr = "unixgram", DefaultSyslogSocket
+	}
+	w := &syslogWriter{cfg: cfg, pid: strconv.Itoa(os.Getpid())}
+	switch cfg.Network {
+	case "unixgram", "udp", "udp4", "udp6":
+	case "unix", "tcp", "tcp4", "tcp6":
+		w.stream = true
+	default:
+		return nil, ErrSyslogNetwork
+	}
+	if w.cfg.Facility == 0 {
+		w.cfg.Facility = FacilityUser
+	}
+	if w.cfg.AppName == "" {
+		w.cfg.AppName = identifier
+	}
+	if w.cfg.Hostname == "" {
+		w.cfg.Hostname, _ = os.Hostname()
+	}
+	if err := w.dial(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// dial connects to the server, with the lock held.
+func (w *syslogWriter) dial() error {
+	conn, err := net.Dial(w.cfg.Network, w.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	return nil
+}
+
+// appendSyslogHeaderValue appends a header field, which is printable
+// US-ASCII up to limit characters, or "-" if empty.
+func appendSyslogHeaderValue(b []byte, s string, limit int) []byte {
+	n := 0
+	for i := 0; i < len(s) && n < limit; i++ {
+		if s[i] > ' ' && s[i] < 0x7f {
+			b = append(b, s[i])
+			n++
+		}
+	}
+	if n == 0 {
+		b = append(b, '-')
+	}
+	return b
+}
+
+// appendSDParam appends a parameter of structured data. Names are printable
+// US-ASCII except '=', ' ', ']' and '"', up to 32 characters, and '"',
+// '\' and ']' in values are escaped.
+func appendSDParam(b []byte, name, value string) []byte {
+	start := len(b)
+	b = append(b, ' ')
+	n := 0
+	for i := 0; i < len(name) && n < 32; i++ {
+		c := name[i]
+		if c > ' ' && c < 0x7f && c != '=' && c != ']' && c != '"' {
+			b = append(b, c)
+			n++
+		}
+	}
+	if n == 0 {
+		return b[:start]
+	}
+	b = append(b, '=', '"')
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '"', '\\', ']':
+			b = append(b, '\\', c)
+		default:
+			b = append(b, c)
+		}
+	}
+	return append(b, '"')
+}
+
+func (w *syslogWriter) WriteItem(m *logMeta, wproc func(w io.Writer)) error {
+	buf := getBuf()
+	defer putBuf(buf)
+	msg := m.msg
+	if msg == nil {
+		wproc((*byteWriter)(buf))
+		msg = *buf
+	}
+
+	// <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [SD] MSG
+	dbuf := getBuf()
+	defer putBuf(dbuf)
+	b := append(*dbuf, '<')
+	b = strconv.AppendInt(b,
+		int64(w.cfg.Facility*8+syslogSeverity(m.lv)), 10)
+	b = append(b, ">1 "...)
+	ts := m.ts
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	b = ts.AppendFormat(b, syslogTimeLayout)
+	b = append(b, ' ')
+	b = appendSyslogHeaderValue(b, w.cfg.Hostname, 255)
+	b = append(b, ' ')
+	b = appendSyslogHeaderValue(b, w.cfg.AppName, 48)
+	b = append(b, ' ')
+	b = append(b, w.pid...)
+	b = append(b, " - ["...)
+	b = append(b, syslogSDID...)
+	if m.module != "" {
+		b = appendSDParam(b, "module", m.module)
+	}
+	if m.file != "" {
+		b = appendSDParam(b, "file", m.file)
+		b = appendSDParam(b, "line", strconv.Itoa(m.line))
+	}
+	if len(m.trace) > 0 {
+		b = appendSDParam(b, "trace_id",
+			m.trace[len(m.trace)-1].ID.String())
+		b = appendSDParam(b, "trace", m.trace.String())
+	}
+	for _, f := range m.fields {
+		b = appendSDParam(b, f.key, fieldText(f.value))
+	}
+	b = append(b, "] "...)
+	b = append(b, msg...)
+	*dbuf = b
+
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if w.closed {
+		return net.ErrClosed
+	}
+	if w.conn == nil {
+		// the last redial failed, the server may be back by now
+		if err := w.dial(); err != nil {
+			return err
+		}
+	}
+	err := w.send(b)
+	if err != nil && (w.stream || isConnError(err)) {
+		// the server may have closed the connection or restarted
+		w.conn.Close()
+		w.conn = nil
+		if err = w.dial(); err == nil {
+			err = w.send(b)
+		}
+	}
+	return err
+}
+
+// send writes a message to the connection, with the lock held.
+func (w *syslogWriter) send(msg []byte) error {
+	if !w.stream {
+		_, err := w.conn.Write(msg)
+		return err
+	}
+	var frame [24]byte
+	f := strconv.AppendInt(frame[:0], int64(len(msg)), 10)
+	f = append(f, ' ')
+	bufs := net.Buffers{f, msg}
+	_, err := bufs.WriteTo(w.conn)
+	return err
+}
+
+func (w *syslogWriter) Close() error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	w.closed = true
+	if w.conn == nil {
+		return nil
+	}
+	return w.conn.Close()
+}
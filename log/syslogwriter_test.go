@@ -0,0 +1,172 @@
+package log
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// syslogPattern matches a message of RFC 5424 written by syslogWriter.
+var syslogPattern = regexp.MustCompile(`^<(\d+)>1 (\S+) (\S+) (\S+) (\d+) - ` +
+	`\[meta@32473((?: [^=]+="(?:[^"\\]|\\.)*")*)\] (?s:(.*))$`)
+
+func TestSyslogWriter(t *testing.T) {
+	Convey("Test syslog writer", t, func() {
+		ctx := WithTrace(context.Background(), "req")
+		trace := GetTrace(ctx)
+		logWith := func(w RawWriter) {
+			lw := NewLevelWriter(w, w, w, w, w, w, LLDebug)
+			l, _ := NewSimpleLogger("syslogtest", "", lw).FromTrace(ctx)
+			l.With("player", `a "quoted" ]name`).Errorw("kicked\nby admin")
+			l.Info("second")
+		}
+		check := func(msgs []string) {
+			So(msgs, ShouldHaveLength, 2)
+			m := syslogPattern.FindStringSubmatch(msgs[0])
+			So(m, ShouldNotBeNil)
+			So(m[1], ShouldEqual, strconv.Itoa(FacilityLocal0*8+3))
+			ts, err := time.Parse(time.RFC3339Nano, m[2])
+			So(err, ShouldBeNil)
+			So(time.Since(ts), ShouldBeLessThan, time.Minute)
+			So(m[3], ShouldEqual, "host-1")
+			So(m[4], ShouldEqual, "mra")
+			So(m[5], ShouldEqual, strconv.Itoa(os.Getpid()))
+			So(m[6], ShouldStartWith, ` module="syslogtest"`+
+				` file="syslogwriter_test.go" line="`)
+			So(m[6], ShouldEndWith, fmt.Sprintf(` trace_id="%s" trace="%s"`+
+				` player="a \"quoted\" \]name"`,
+				trace[0].ID.String(), trace.String()))
+			So(m[7], ShouldEqual, "kicked\nby admin")
+			m = syslogPattern.FindStringSubmatch(msgs[1])
+			So(m, ShouldNotBeNil)
+			So(m[1], ShouldEqual, strconv.Itoa(FacilityLocal0*8+6))
+			So(m[7], ShouldEqual, "second")
+		}
+		cfg := SyslogConfig{
+			Facility: FacilityLocal0, AppName: "mra", Hostname: "host-1",
+		}
+
+		Convey("Over UDP", func() {
+			ln, err := net.ListenPacket("udp", "127.0.0.1:0")
+			So(err, ShouldBeNil)
+			defer ln.Close()
+			cfg.Network, cfg.Addr = "udp", ln.LocalAddr().String()
+			w, err := NewSyslogWriter(cfg)
+			So(err, ShouldBeNil)
+			defer w.Close()
+			logWith(w)
+			var msgs []string
+			buf := make([]byte, 64<<10)
+			for len(msgs) < 2 {
+				ln.SetReadDeadline(time.Now().Add(5 * time.Second))
+				n, _, err := ln.ReadFrom(buf)
+				So(err, ShouldBeNil)
+				msgs = append(msgs, string(buf[:n]))
+			}
+			check(msgs)
+		})
+
+		Convey("Over unix datagram", func() {
+			socket := filepath.Join(t.TempDir(), "log")
+			ln, err := net.ListenPacket("unixgram", socket)
+			So(err, ShouldBeNil)
+			defer ln.Close()
+			cfg.Network, cfg.Addr = "unixgram", socket
+			w, err := NewSyslogWriter(cfg)
+			So(err, ShouldBeNil)
+			defer w.Close()
+			logWith(w)
+			var msgs []string
+			buf := make([]byte, 64<<10)
+			for len(msgs) < 2 {
+				ln.SetReadDeadline(time.Now().Add(5 * time.Second))
+				n, _, err := ln.ReadFrom(buf)
+				So(err, ShouldBeNil)
+				msgs = append(msgs, string(buf[:n]))
+			}
+			check(msgs)
+
+			// the daemon is restarted with a new socket
+			ln.Close()
+			os.Remove(socket)
+			m := &logMeta{lv: LLInfo, msg: []byte("lost")}
+			So(w.WriteItem(m, nil), ShouldNotBeNil)
+			So(w.WriteItem(m, nil), ShouldNotBeNil)
+			ln, err = net.ListenPacket("unixgram", socket)
+			So(err, ShouldBeNil)
+			defer ln.Close()
+			m.msg = []byte("back")
+			So(w.WriteItem(m, nil), ShouldBeNil)
+			ln.SetReadDeadline(time.Now().Add(5 * time.Second))
+			n, _, err := ln.ReadFrom(buf)
+			So(err, ShouldBeNil)
+			So(string(buf[:n]), ShouldEndWith, "] back")
+		})
+
+		Convey("Over TCP with octet counting and reconnection", func() {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			So(err, ShouldBeNil)
+			defer ln.Close()
+			frames := make(chan string, 16)
+			conns := make(chan net.Conn, 4)
+			go func() {
+				for {
+					conn, err := ln.Accept()
+					if err != nil {
+						return
+					}
+					conns <- conn
+					go func() {
+						r := bufio.NewReader(conn)
+						for {
+							var n int
+							if _, err := fmt.Fscanf(r, "%d ", &n); err != nil {
+								return
+							}
+							buf := make([]byte, n)
+							if _, err := io.ReadFull(r, buf); err != nil {
+								return
+							}
+							frames <- string(buf)
+						}
+					}()
+				}
+			}()
+			cfg.Network, cfg.Addr = "tcp", ln.Addr().String()
+			w, err := NewSyslogWriter(cfg)
+			So(err, ShouldBeNil)
+			defer w.Close()
+			logWith(w)
+			check([]string{<-frames, <-frames})
+
+			// records may be lost until the closed connection is noticed
+			(<-conns).Close()
+			m := logMeta{lv: LLInfo, msg: []byte("again")}
+			var got string
+			for i := 0; i < 50 && got == ""; i++ {
+				w.WriteItem(&m, nil)
+				select {
+				case got = <-frames:
+				case <-time.After(20 * time.Millisecond):
+				}
+			}
+			So(got, ShouldEndWith, "] again")
+			So(conns, ShouldHaveLength, 1)
+		})
+
+		Convey("Unsupported network", func() {
+			_, err := NewSyslogWriter(SyslogConfig{Network: "sctp", Addr: "x"})
+			So(err, ShouldEqual, ErrSyslogNetwork)
+		})
+	})
+}
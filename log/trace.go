@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/md5"
 	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"math/rand/v2"
 	"os"
@@ -17,8 +18,8 @@ type TraceID [32]byte
 
 // TraceValue represents a trace value.
 type TraceValue struct {
-	ID   TraceID
-	Name string
+	ID   TraceID `json:"id"`
+	Name string  `json:"name,omitempty"`
 }
 
 // TraceScope represents a trace chain. which includes a sequence of trace
@@ -119,6 +120,25 @@ func (t TraceID) String() string {
 	return fmt.Sprintf("%016x-%032x-%016x", t[:8], t[8:24], t[24:])
 }
 
+// MarshalText implements encoding.TextMarshaler, in the form of String.
+func (t TraceID) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, in the form of String
+// or Hex.
+func (t *TraceID) UnmarshalText(text []byte) error {
+	b, err := hex.DecodeString(strings.ReplaceAll(string(text), "-", ""))
+	if err != nil {
+		return err
+	}
+	if len(b) != len(t) {
+		return fmt.Errorf("invalid trace ID %q", text)
+	}
+	copy(t[:], b)
+	return nil
+}
+
 // Sum returns the first 8 bytes summary of the trace ID.
 func (t TraceID) Sum() string {
 	return fmt.Sprintf("%016x", t[:8])
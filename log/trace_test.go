@@ -37,7 +37,8 @@ func TestTraceCtx(t *testing.T) {
 			t.Logf("trace value L1: %s", t1val)
 			t.Logf("trace detail L1: %s", t1val.Format("ID-", "-END", ">"))
 			l2ctx := WithTrace(l1ctx, "test2")
-			l2ctxwc, _ := context.WithCancel(l2ctx)
+			l2ctxwc, cancel := context.WithCancel(l2ctx)
+			defer cancel()
 			l3ctx := WithTrace(l2ctxwc, "test3")
 			So(l3ctx, ShouldNotBeNil)
 			tval := GetTrace(l3ctx)
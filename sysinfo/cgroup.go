@@ -0,0 +1,238 @@
+package sysinfo
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultCgroupRoot is the mount point of the cgroup v2 unified hierarchy
+const DefaultCgroupRoot = "/sys/fs/cgroup"
+
+var (
+	ErrCgroupV2 = errors.New("not a cgroup v2 hierarchy")
+)
+
+// patterns of container cgroups, the first submatch is the ID
+var cgroupPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^docker-([0-9a-f]{64})\.scope$`),
+	regexp.MustCompile(`^libpod-([0-9a-f]{64})\.scope$`),
+	regexp.MustCompile(`^systemd-nspawn@(.+)\.service$`),
+	regexp.MustCompile(`^machine-(.+)\.scope$`),
+}
+
+// cgroupfs driver of docker puts containers at docker/<id>
+var cgroupDockerID = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// cgroupCounters keeps the cumulative counters of a cgroup for rates
+type cgroupCounters struct {
+	ts        time.Time
+	usageUsec uint64
+	readBytes uint64
+	writBytes uint64
+}
+
+// cgroupSampler samples containers and services from cgroup v2 files
+type cgroupSampler struct {
+	root     string
+	services map[string]bool
+	known    map[string]ContianerInfo
+	last     map[string]cgroupCounters
+}
+
+// NewCgroupSampler creates a Sampler which discovers the cgroups of Docker,
+// Podman and systemd-nspawn containers under root, as well as the systemd
+// services given by unit name (such as "palworld.service"), and fills
+// PerfStat.CStat without the help of any container daemon. Containers
+// appearing or disappearing are reported in PerfStat.CEvent.
+// If root is empty, DefaultCgroupRoot is used. ErrCgroupV2 is returned if
+// root is missing or not the root of a cgroup v2 hierarchy, such as on
+// hosts with cgroup v1.
+func NewCgroupSampler(root string, services ...string) (Sampler, error) {
+	if root == "" {
+		root = DefaultCgroupRoot
+	}
+	// only the root of the unified hierarchy has cgroup.controllers
+	_, err := os.Stat(filepath.Join(root, "cgroup.controllers"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrCgroupV2, root)
+	}
+	s := &cgroupSampler{
+		root:     root,
+		services: make(map[string]bool, len(services)),
+		known:    make(map[string]ContianerInfo),
+		last:     make(map[string]cgroupCounters),
+	}
+	for _, v := range services {
+		s.services[v] = true
+	}
+	return s, nil
+}
+
+// unescapeUnit decodes the "\xNN" escapes of systemd unit names
+func unescapeUnit(s string) string {
+	if !strings.Contains(s, `\x`) {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if i+3 < len(s) && s[i] == '\\' && s[i+1] == 'x' {
+			if b, err := strconv.ParseUint(s[i+2:i+4], 16, 8); err == nil {
+				sb.WriteByte(byte(b))
+				i += 3
+				continue
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// match checks whether a cgroup directory is a container or a watched
+// service, and returns its info
+func (s *cgroupSampler) match(path string) (ContianerInfo, bool) {
+	base := filepath.Base(path)
+	if s.services[base] {
+		return ContianerInfo{ID: base, Name: base, Runing: true}, true
+	}
+	for _, re := range cgroupPatterns {
+		if m := re.FindStringSubmatch(base); m != nil {
+			id := unescapeUnit(m[1])
+			info := ContianerInfo{ID: id, Name: id, Runing: true}
+			if len(info.Name) == 64 {
+				info.Name = info.Name[:12]
+			}
+			return info, true
+		}
+	}
+	if cgroupDockerID.MatchString(base) &&
+		filepath.Base(filepath.Dir(path)) == "docker" {
+		return ContianerInfo{ID: base, Name: base[:12], Runing: true}, true
+	}
+	return ContianerInfo{}, false
+}
+
+// discover walks the cgroup tree and returns the paths and info of the
+// matched cgroups keyed by ID
+func (s *cgroupSampler) discover() (
+	map[string]string, map[string]ContianerInfo, error,
+) {
+	paths := make(map[string]string)
+	infos := make(map[string]ContianerInfo)
+	walk := func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == s.root {
+				return err
+			}
+			return nil // cgroups can vanish while walking
+		}
+		if !d.IsDir() || p == s.root {
+			return nil
+		}
+		if info, ok := s.match(p); ok {
+			paths[info.ID] = p
+			infos[info.ID] = info
+			return filepath.SkipDir
+		}
+		return nil
+	}
+	err := filepath.WalkDir(s.root, walk)
+	return paths, infos, err
+}
+
+// Sample implements Sampler
+func (s *cgroupSampler) Sample(stat *PerfStat) error {
+	paths, infos, err := s.discover()
+	if err != nil {
+		return err
+	}
+	now := sampleTime(stat)
+	cstat := make(map[string]ContainerStat, len(paths))
+	last := make(map[string]cgroupCounters, len(paths))
+	for id, p := range paths {
+		cs, cnt := readCgroupStat(p)
+		cnt.ts = now
+		if prev, ok := s.last[id]; ok {
+			sec := now.Sub(prev.ts).Seconds()
+			if sec > 0 {
+				if cnt.usageUsec >= prev.usageUsec {
+					cs.CPU = float32(float64(cnt.usageUsec-prev.usageUsec) /
+						1e6 / sec * 100)
+				}
+				if cnt.readBytes >= prev.readBytes {
+					cs.IORead = uint64(
+						float64(cnt.readBytes-prev.readBytes) / sec)
+				}
+				if cnt.writBytes >= prev.writBytes {
+					cs.IOWrite = uint64(
+						float64(cnt.writBytes-prev.writBytes) / sec)
+				}
+			}
+		}
+		last[id] = cnt
+		cstat[id] = cs
+	}
+	s.last = last
+	stat.CStat = cstat
+
+	// report containers started or stopped since the last sample
+	for id, info := range infos {
+		if _, ok := s.known[id]; !ok {
+			stat.CEvent = append(stat.CEvent, info)
+		}
+	}
+	for id, info := range s.known {
+		if _, ok := infos[id]; !ok {
+			info.Runing = false
+			stat.CEvent = append(stat.CEvent, info)
+		}
+	}
+	s.known = infos
+	return nil
+}
+
+// readCgroupStat reads the gauges and cumulative counters of a cgroup.
+// Missing files are left zero since controllers may not be enabled.
+func readCgroupStat(dir string) (ContainerStat, cgroupCounters) {
+	var cs ContainerStat
+	var cnt cgroupCounters
+	if f, err := readProcFields(filepath.Join(dir, "cpu.stat")); err == nil {
+		cnt.usageUsec = parseUint(f["usage_usec"])
+	}
+	cs.MemUsed = readCgroupUint(dir, "memory.current")
+	// "max" means no limit and is parsed as zero
+	cs.MemLimit = readCgroupUint(dir, "memory.max")
+	if data, err := os.ReadFile(filepath.Join(dir, "io.stat")); err == nil {
+		// 8:0 rbytes=1 wbytes=2 rios=3 wios=4 dbytes=0 dios=0
+		sc := bufio.NewScanner(bytes.NewReader(data))
+		for sc.Scan() {
+			for _, kv := range strings.Fields(sc.Text()) {
+				k, v, _ := strings.Cut(kv, "=")
+				switch k {
+				case "rbytes":
+					cnt.readBytes += parseUint(v)
+				case "wbytes":
+					cnt.writBytes += parseUint(v)
+				}
+			}
+		}
+	}
+	return cs, cnt
+}
+
+// readCgroupUint reads a single value cgroup file, returns 0 on error
+func readCgroupUint(dir, name string) uint64 {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return 0
+	}
+	return parseUint(strings.TrimSpace(string(data)))
+}
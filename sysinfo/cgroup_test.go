@@ -0,0 +1,87 @@
+package sysinfo
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// writeCgroupFixture writes the stat files of a fake cgroup
+func writeCgroupFixture(root, dir string, usec, mem, rbytes uint64) {
+	writeFixture(root, dir+"/cpu.stat", fmt.Sprintf(
+		"usage_usec %d\nuser_usec %d\nsystem_usec 0\n", usec, usec))
+	writeFixture(root, dir+"/memory.current", fmt.Sprintf("%d\n", mem))
+	writeFixture(root, dir+"/memory.max", "max\n")
+	writeFixture(root, dir+"/io.stat", fmt.Sprintf(
+		"8:0 rbytes=%d wbytes=0 rios=1 wios=0 dbytes=0 dios=0\n"+
+			"8:16 rbytes=%d wbytes=0 rios=1 wios=0 dbytes=0 dios=0\n",
+		rbytes, rbytes))
+}
+
+func TestCgroupSampler(t *testing.T) {
+	Convey("Test cgroup sampler", t, func() {
+		root := t.TempDir()
+		dockerID := strings.Repeat("ab", 32)
+		podmanID := strings.Repeat("cd", 32)
+		docker := "system.slice/docker-" + dockerID + ".scope"
+		podman := "user.slice/user-1000.slice/user@1000.service/" +
+			"user.slice/libpod-" + podmanID + ".scope"
+		nspawn := `machine.slice/machine-pal\x2dworld.scope`
+		service := "system.slice/palworld.service"
+		writeCgroupFixture(root, docker, 1000000, 1<<30, 4096)
+		writeCgroupFixture(root, podman, 0, 1<<20, 0)
+		writeCgroupFixture(root, nspawn+"/payload", 0, 1<<20, 0)
+		writeCgroupFixture(root, nspawn, 0, 2<<20, 0)
+		writeCgroupFixture(root, service, 0, 3<<20, 0)
+		writeCgroupFixture(root, "system.slice/sshd.service", 0, 1, 0)
+		writeFixture(root, service+"/memory.max", "8589934592\n")
+
+		_, err := NewCgroupSampler(root)
+		So(errors.Is(err, ErrCgroupV2), ShouldBeTrue)
+		writeFixture(root, "cgroup.controllers", "cpu io memory pids\n")
+		s, err := NewCgroupSampler(root, "palworld.service")
+		So(err, ShouldBeNil)
+		stat := PerfStat{TS: 1760000000000}
+		So(s.Sample(&stat), ShouldBeNil)
+		So(stat.CStat, ShouldHaveLength, 4)
+		So(stat.CStat, ShouldContainKey, dockerID)
+		So(stat.CStat, ShouldContainKey, podmanID)
+		So(stat.CStat, ShouldContainKey, "pal-world")
+		So(stat.CStat, ShouldContainKey, "palworld.service")
+		So(stat.CStat["pal-world"].MemUsed, ShouldEqual, 2<<20)
+		So(stat.CStat["palworld.service"].MemLimit, ShouldEqual, 8<<30)
+		So(stat.CStat[dockerID].MemLimit, ShouldEqual, 0)
+		So(stat.CEvent, ShouldHaveLength, 4)
+		for _, v := range stat.CEvent {
+			So(v.Runing, ShouldBeTrue)
+			if v.ID == dockerID {
+				So(v.Name, ShouldEqual, dockerID[:12])
+			}
+		}
+
+		// rates are computed by the time of sampling
+		writeCgroupFixture(root, docker, 3000000, 1<<30, 4096+2048)
+		So(os.RemoveAll(filepath.Join(root, podman)), ShouldBeNil)
+		stat = PerfStat{TS: 1760000002000}
+		So(s.Sample(&stat), ShouldBeNil)
+		So(stat.CStat, ShouldHaveLength, 3)
+		So(stat.CStat[dockerID].CPU, ShouldAlmostEqual, 100, 1)
+		So(stat.CStat[dockerID].IORead, ShouldAlmostEqual, 2048, 20)
+		So(stat.CEvent, ShouldResemble, []ContianerInfo{
+			{ID: podmanID, Name: podmanID[:12], Runing: false},
+		})
+
+		Convey("Missing root", func() {
+			_, err := NewCgroupSampler(filepath.Join(root, "none"))
+			So(errors.Is(err, ErrCgroupV2), ShouldBeTrue)
+			// the root vanishes after the check
+			So(os.RemoveAll(root), ShouldBeNil)
+			So(s.Sample(&PerfStat{}), ShouldNotBeNil)
+		})
+	})
+}
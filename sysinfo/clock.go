@@ -0,0 +1,139 @@
+package sysinfo
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of time and ticks of a PerfTimelineMgr, so that it
+// can be driven by a fake time in tests
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks of a Clock
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// SystemClock is the Clock of the system time
+var SystemClock Clock = systemClock{}
+
+// systemClock implements Clock with the time package
+type systemClock struct{}
+
+// Now implements Clock
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// NewTicker implements Clock
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+// systemTicker wraps time.Ticker as Ticker
+type systemTicker struct {
+	*time.Ticker
+}
+
+// C implements Ticker
+func (t systemTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// ManualClock is a Clock which only moves when told to. Tickers created by
+// it fire when the clock is advanced past their next tick, and like
+// time.Ticker they drop ticks for slow receivers.
+type ManualClock struct {
+	mtx     sync.Mutex
+	now     time.Time
+	tickers map[*manualTicker]struct{}
+}
+
+// NewManualClock creates a ManualClock starting at the given time
+func NewManualClock(start time.Time) *ManualClock {
+	return &ManualClock{
+		now:     start,
+		tickers: make(map[*manualTicker]struct{}),
+	}
+}
+
+// Now implements Clock
+func (c *ManualClock) Now() time.Time {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.now
+}
+
+// NewTicker implements Clock
+func (c *ManualClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for ManualClock.NewTicker")
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	t := &manualTicker{
+		clock:  c,
+		period: d,
+		next:   c.now.Add(d),
+		ch:     make(chan time.Time, 1),
+	}
+	c.tickers[t] = struct{}{}
+	return t
+}
+
+// Advance moves the clock forward by d and fires the due tickers
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.set(c.now.Add(d))
+}
+
+// Set moves the clock to t and fires the due tickers. Moving backward does
+// not fire any ticker.
+func (c *ManualClock) Set(t time.Time) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.set(t)
+}
+
+// set moves the clock with the lock held
+func (c *ManualClock) set(t time.Time) {
+	c.now = t
+	for tk := range c.tickers {
+		if tk.next.After(t) {
+			continue
+		}
+		select {
+		case tk.ch <- tk.next:
+		default:
+		}
+		// skip the ticks missed in between
+		for !tk.next.After(t) {
+			tk.next = tk.next.Add(tk.period)
+		}
+	}
+}
+
+// manualTicker is a Ticker of ManualClock
+type manualTicker struct {
+	clock  *ManualClock
+	period time.Duration
+	next   time.Time
+	ch     chan time.Time
+}
+
+// C implements Ticker
+func (t *manualTicker) C() <-chan time.Time {
+	return t.ch
+}
+
+// Stop implements Ticker
+func (t *manualTicker) Stop() {
+	t.clock.mtx.Lock()
+	defer t.clock.mtx.Unlock()
+	delete(t.clock.tickers, t)
+}
@@ -0,0 +1,161 @@
+package sysinfo
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestManualClock(t *testing.T) {
+	Convey("Test manual clock", t, func() {
+		start := time.UnixMilli(1760000000000)
+		clock := NewManualClock(start)
+		tk := clock.NewTicker(time.Second)
+		defer tk.Stop()
+
+		clock.Advance(999 * time.Millisecond)
+		So(tk.C(), ShouldHaveLength, 0)
+		clock.Advance(time.Millisecond)
+		So(clock.Now(), ShouldEqual, start.Add(time.Second))
+		So(<-tk.C(), ShouldEqual, start.Add(time.Second))
+
+		// missed ticks are dropped
+		clock.Advance(3500 * time.Millisecond)
+		So(<-tk.C(), ShouldEqual, start.Add(2*time.Second))
+		So(tk.C(), ShouldHaveLength, 0)
+		clock.Advance(500 * time.Millisecond)
+		So(<-tk.C(), ShouldEqual, start.Add(5*time.Second))
+
+		tk.Stop()
+		clock.Advance(time.Hour)
+		So(tk.C(), ShouldHaveLength, 0)
+	})
+
+	Convey("Test manager driven by a manual clock", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		clock := NewManualClock(time.UnixMilli(1760000000000))
+		mgr := CreatePerfTimelineMgrWithClock(ctx, 1000, 10,
+			PerfStat{Load: &LoadStat{Load1: 1}}, clock)
+		clock.Advance(time.Second)
+		deadline := time.Now().Add(5 * time.Second)
+		for mgr.CountStats() == 0 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		tl := mgr.Export()
+		So(tl.Stats, ShouldHaveLength, 1)
+		So(tl.Stats[0].TS, ShouldEqual, 1760000001000)
+	})
+
+	Convey("Test manager in manual mode", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		clock := NewManualClock(time.UnixMilli(1760000000000))
+		mgr := CreateManualPerfTimelineMgr(ctx, 1000, 2, PerfStat{}, clock)
+		for i := 1; i <= 3; i++ {
+			clock.Advance(time.Second)
+			So(mgr.Update(PerfStat{Load: &LoadStat{Load1: float32(i)}}),
+				ShouldBeNil)
+			So(mgr.Snapshot(), ShouldBeNil)
+		}
+		So(mgr.Annotate(Annotation{Type: "operation"}), ShouldBeNil)
+		tl := mgr.Export()
+		So(tl.Stats, ShouldHaveLength, 2)
+		So(tl.Stats[0].TS, ShouldEqual, 1760000003000)
+		So(tl.Stats[0].Load.Load1, ShouldEqual, 3)
+		So(tl.Stats[1].Load.Load1, ShouldEqual, 2)
+		So(tl.Annotations[0].TS, ShouldEqual, 1760000003000)
+
+		cancel()
+		So(mgr.Snapshot(), ShouldEqual, ErrPerfTimelineMgrClosed)
+	})
+}
+
+// advanceUntil advances the clock by d until cond holds, or gives up after
+// 5 seconds of real time. The ticker of a goroutine may not be created yet
+// when the clock is first advanced.
+func advanceUntil(clock *ManualClock, d time.Duration, cond func() bool) bool {
+	for deadline := time.Now().Add(5 * time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			return false
+		}
+		clock.Advance(d)
+		time.Sleep(time.Millisecond)
+	}
+	return true
+}
+
+// countSampler counts its samples in the 1 minute load average, and keeps
+// the time of the first sample
+type countSampler struct {
+	n     atomic.Int32
+	first atomic.Int64
+}
+
+func (s *countSampler) Sample(stat *PerfStat) error {
+	s.first.CompareAndSwap(0, stat.TS)
+	stat.Load = &LoadStat{Load1: float32(s.n.Add(1))}
+	return nil
+}
+
+func TestRunSamplers(t *testing.T) {
+	Convey("Test samplers driven by a manual clock", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		clock := NewManualClock(time.UnixMilli(1760000000000))
+		mgr := CreateManualPerfTimelineMgr(ctx, 1000, 10, PerfStat{}, clock)
+		s := &countSampler{}
+		go RunSamplersWithClock(ctx, mgr, time.Second, clock, nil, s)
+
+		// sampled once at start, then on the ticks of the clock
+		So(advanceUntil(clock, time.Second, func() bool {
+			return s.n.Load() >= 3
+		}), ShouldBeTrue)
+		So(mgr.Current().Load.Load1, ShouldBeGreaterThanOrEqualTo, 2)
+		// samplers take the time from the clock
+		So(s.first.Load(), ShouldBeBetweenOrEqual, 1760000000000,
+			clock.Now().UnixMilli())
+	})
+}
+
+func TestReplayTimeline(t *testing.T) {
+	Convey("Test replaying a recorded timeline", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		rec := genTimeline(60, 2, 2)
+		// containers running since the first snapshot
+		first := rec.Stats[len(rec.Stats)-1].TS
+		for id, info := range rec.CInfo {
+			info.FirstSeen = first
+			info.History = []ContainerState{{TS: first, Runing: true}}
+			rec.CInfo[id] = info
+		}
+		rec.Annotations = []Annotation{
+			{TS: rec.Stats[0].TS + 500, Type: "operation", Text: "late"},
+			{TS: rec.Stats[30].TS, Type: "task_start", Text: "restart"},
+		}
+		clock := NewManualClock(time.Time{})
+		mgr := CreateManualPerfTimelineMgr(ctx, rec.Interval, len(rec.Stats),
+			PerfStat{}, clock)
+
+		So(ReplayTimeline(mgr, clock, rec), ShouldBeNil)
+		So(clock.Now().UnixMilli(), ShouldEqual, rec.Stats[0].TS)
+
+		tl := mgr.Export()
+		So(tl.Stats, ShouldHaveLength, len(rec.Stats))
+		for i := range tl.Stats {
+			So(tl.Stats[i].TS, ShouldEqual, rec.Stats[i].TS)
+			So(tl.Stats[i].CPU, ShouldResemble, rec.Stats[i].CPU)
+			So(tl.Stats[i].CStat, ShouldResemble, rec.Stats[i].CStat)
+			So(tl.Stats[i].Custom, ShouldResemble, rec.Stats[i].Custom)
+		}
+		So(tl.Annotations, ShouldResemble, rec.Annotations)
+		So(tl.CInfo, ShouldHaveLength, 2)
+		for id, info := range tl.CInfo {
+			So(info.Name, ShouldEqual, rec.CInfo[id].Name)
+			So(info.Runing, ShouldBeTrue)
+		}
+	})
+}
@@ -0,0 +1,357 @@
+package sysinfo
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// perfCollector exposes the current snapshot of a PerfTimelineMgr as
+// prometheus metrics. Values are read from the manager at scrape time.
+type perfCollector struct {
+	mgr PerfTimelineMgr
+
+	// the CPU summary observes the snapshots taken since the last scrape
+	mtx        sync.Mutex
+	cpuSummary prometheus.Summary
+	lastTS     int64
+
+	cpuTotal   *prometheus.Desc
+	cpuCore    *prometheus.Desc
+	cpuMode    *prometheus.Desc
+	memTotal   *prometheus.Desc
+	memUsed    *prometheus.Desc
+	memFree    *prometheus.Desc
+	memAvail   *prometheus.Desc
+	swapTotal  *prometheus.Desc
+	swapUsed   *prometheus.Desc
+	load       *prometheus.Desc
+	pressure   *prometheus.Desc
+	netBytes   *prometheus.Desc
+	netPackets *prometheus.Desc
+	diskTotal  *prometheus.Desc
+	diskUsed   *prometheus.Desc
+	diskInoT   *prometheus.Desc
+	diskInoU   *prometheus.Desc
+	dioBytes   *prometheus.Desc
+	dioIOPS    *prometheus.Desc
+	dioAwait   *prometheus.Desc
+	dioUtil    *prometheus.Desc
+	cCPU       *prometheus.Desc
+	cMemUsed   *prometheus.Desc
+	cMemLimit  *prometheus.Desc
+	cIOBytes   *prometheus.Desc
+	pCPU       *prometheus.Desc
+	pRSS       *prometheus.Desc
+	pVMS       *prometheus.Desc
+	pThreads   *prometheus.Desc
+	pFDs       *prometheus.Desc
+	pCtxSw     *prometheus.Desc
+	pIOBytes   *prometheus.Desc
+	sockTotal  *prometheus.Desc
+	sockTCP    *prometheus.Desc
+	sockRxQ    *prometheus.Desc
+	sockDrops  *prometheus.Desc
+	udpRate    *prometheus.Desc
+	custom     *prometheus.Desc
+}
+
+// NewPerfCollector creates a prometheus.Collector backed by the given
+// PerfTimelineMgr.
+func NewPerfCollector(mgr PerfTimelineMgr) prometheus.Collector {
+	return &perfCollector{
+		mgr: mgr,
+		cpuSummary: prometheus.NewSummary(prometheus.SummaryOpts{
+			Name: "cpu_usage_summary",
+			Help: "Summary of overall CPU usage percentage over time",
+			Objectives: map[float64]float64{
+				0.5: 0.05, 0.9: 0.01, 0.99: 0.001,
+			},
+			MaxAge: 5 * time.Minute,
+		}),
+		cpuTotal: prometheus.NewDesc("cpu_usage_total",
+			"Overall CPU usage percentage", nil, nil),
+		cpuCore: prometheus.NewDesc("cpu_usage_per_core",
+			"CPU usage percentage per core", []string{"core"}, nil),
+		cpuMode: prometheus.NewDesc("cpu_usage_mode",
+			"Overall CPU usage percentage by mode", []string{"mode"}, nil),
+		memTotal: prometheus.NewDesc("memory_total_bytes",
+			"Total memory in bytes", nil, nil),
+		memUsed: prometheus.NewDesc("memory_used_bytes",
+			"Used memory in bytes", nil, nil),
+		memFree: prometheus.NewDesc("memory_free_bytes",
+			"Free memory in bytes", nil, nil),
+		memAvail: prometheus.NewDesc("memory_available_bytes",
+			"Available memory in bytes", nil, nil),
+		swapTotal: prometheus.NewDesc("memory_swap_total_bytes",
+			"Total swap space in bytes", nil, nil),
+		swapUsed: prometheus.NewDesc("memory_swap_used_bytes",
+			"Used swap space in bytes", nil, nil),
+		load: prometheus.NewDesc("load_average",
+			"System load average", []string{"period"}, nil),
+		pressure: prometheus.NewDesc("pressure_stall_percent",
+			"Percentage of time tasks stalled on the resource",
+			[]string{"resource", "type", "window"}, nil),
+		netBytes: prometheus.NewDesc("network_bytes_per_second",
+			"Network I/O in bytes per second",
+			[]string{"interface", "direction"}, nil),
+		netPackets: prometheus.NewDesc("network_packets_per_second",
+			"Network I/O in packets per second",
+			[]string{"interface", "direction"}, nil),
+		diskTotal: prometheus.NewDesc("disk_total_bytes",
+			"Total disk space in bytes",
+			[]string{"mountpoint", "fstype"}, nil),
+		diskUsed: prometheus.NewDesc("disk_used_bytes",
+			"Used disk space in bytes",
+			[]string{"mountpoint", "fstype"}, nil),
+		diskInoT: prometheus.NewDesc("disk_inodes_total",
+			"Total number of inodes",
+			[]string{"mountpoint", "fstype"}, nil),
+		diskInoU: prometheus.NewDesc("disk_inodes_used",
+			"Number of used inodes",
+			[]string{"mountpoint", "fstype"}, nil),
+		dioBytes: prometheus.NewDesc("disk_io_bytes_per_second",
+			"Disk I/O in bytes per second",
+			[]string{"device", "direction"}, nil),
+		dioIOPS: prometheus.NewDesc("disk_io_operations_per_second",
+			"Disk I/O operations per second",
+			[]string{"device", "direction"}, nil),
+		dioAwait: prometheus.NewDesc("disk_io_await_milliseconds",
+			"Average time of disk I/O requests including queueing",
+			[]string{"device"}, nil),
+		dioUtil: prometheus.NewDesc("disk_io_utilization",
+			"Percentage of time the device is busy",
+			[]string{"device"}, nil),
+		cCPU: prometheus.NewDesc("container_cpu_usage",
+			"CPU usage percentage of container",
+			[]string{"id", "name", "image"}, nil),
+		cMemUsed: prometheus.NewDesc("container_memory_used_bytes",
+			"Used memory of container in bytes",
+			[]string{"id", "name", "image"}, nil),
+		cMemLimit: prometheus.NewDesc("container_memory_limit_bytes",
+			"Memory limit of container in bytes",
+			[]string{"id", "name", "image"}, nil),
+		cIOBytes: prometheus.NewDesc("container_io_bytes_per_second",
+			"Storage I/O of container in bytes per second",
+			[]string{"id", "name", "image", "direction"}, nil),
+		pCPU: prometheus.NewDesc("proc_cpu_usage",
+			"CPU usage percentage of process",
+			[]string{"name", "pid"}, nil),
+		pRSS: prometheus.NewDesc("proc_resident_memory_bytes",
+			"Resident memory of process in bytes",
+			[]string{"name", "pid"}, nil),
+		pVMS: prometheus.NewDesc("proc_virtual_memory_bytes",
+			"Virtual memory of process in bytes",
+			[]string{"name", "pid"}, nil),
+		pThreads: prometheus.NewDesc("proc_threads",
+			"Number of threads of process",
+			[]string{"name", "pid"}, nil),
+		pFDs: prometheus.NewDesc("proc_open_fds",
+			"Number of open file descriptors of process",
+			[]string{"name", "pid"}, nil),
+		pCtxSw: prometheus.NewDesc("proc_context_switches_per_second",
+			"Context switches of process per second",
+			[]string{"name", "pid", "type"}, nil),
+		pIOBytes: prometheus.NewDesc("proc_io_bytes_per_second",
+			"Storage I/O of process in bytes per second",
+			[]string{"name", "pid", "direction"}, nil),
+		sockTotal: prometheus.NewDesc("port_sockets",
+			"Number of sockets bound to the local port",
+			[]string{"port"}, nil),
+		sockTCP: prometheus.NewDesc("port_tcp_sockets",
+			"Number of TCP sockets bound to the local port by state",
+			[]string{"port", "state"}, nil),
+		sockRxQ: prometheus.NewDesc("port_receive_queue_bytes",
+			"Bytes waiting in the receive queues of the port",
+			[]string{"port"}, nil),
+		sockDrops: prometheus.NewDesc("port_udp_drops",
+			"Datagrams dropped by the UDP sockets of the port",
+			[]string{"port"}, nil),
+		udpRate: prometheus.NewDesc("udp_datagrams_per_second",
+			"UDP datagrams and errors of the host per second",
+			[]string{"type"}, nil),
+		custom: prometheus.NewDesc("custom_metric",
+			"Metric reported by a custom collector",
+			[]string{"series"}, nil),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *perfCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.cpuSummary.Describe(ch)
+	ch <- c.cpuTotal
+	ch <- c.cpuCore
+	ch <- c.cpuMode
+	ch <- c.memTotal
+	ch <- c.memUsed
+	ch <- c.memFree
+	ch <- c.memAvail
+	ch <- c.swapTotal
+	ch <- c.swapUsed
+	ch <- c.load
+	ch <- c.pressure
+	ch <- c.netBytes
+	ch <- c.netPackets
+	ch <- c.diskTotal
+	ch <- c.diskUsed
+	ch <- c.diskInoT
+	ch <- c.diskInoU
+	ch <- c.dioBytes
+	ch <- c.dioIOPS
+	ch <- c.dioAwait
+	ch <- c.dioUtil
+	ch <- c.cCPU
+	ch <- c.cMemUsed
+	ch <- c.cMemLimit
+	ch <- c.cIOBytes
+	ch <- c.pCPU
+	ch <- c.pRSS
+	ch <- c.pVMS
+	ch <- c.pThreads
+	ch <- c.pFDs
+	ch <- c.pCtxSw
+	ch <- c.pIOBytes
+	ch <- c.sockTotal
+	ch <- c.sockTCP
+	ch <- c.sockRxQ
+	ch <- c.sockDrops
+	ch <- c.udpRate
+	ch <- c.custom
+}
+
+// Collect implements prometheus.Collector
+func (c *perfCollector) Collect(ch chan<- prometheus.Metric) {
+	c.collectCPUSummary(ch)
+	stat := c.mgr.Current()
+	gauge := func(d *prometheus.Desc, v float64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, v,
+			labels...)
+	}
+
+	if stat.CPU != nil {
+		gauge(c.cpuTotal, float64(stat.CPU.Total))
+		for i, v := range stat.CPU.Core {
+			gauge(c.cpuCore, float64(v), strconv.Itoa(i))
+		}
+		gauge(c.cpuMode, float64(stat.CPU.User), "user")
+		gauge(c.cpuMode, float64(stat.CPU.System), "system")
+		gauge(c.cpuMode, float64(stat.CPU.IOWait), "iowait")
+		gauge(c.cpuMode, float64(stat.CPU.Steal), "steal")
+	}
+	if stat.Mem != nil {
+		gauge(c.memTotal, float64(stat.Mem.Total))
+		gauge(c.memUsed, float64(stat.Mem.Used))
+		gauge(c.memFree, float64(stat.Mem.Free))
+		gauge(c.memAvail, float64(stat.Mem.Available))
+		gauge(c.swapTotal, float64(stat.Mem.SwapTotal))
+		gauge(c.swapUsed, float64(stat.Mem.SwapUsed))
+	}
+	if stat.Load != nil {
+		gauge(c.load, float64(stat.Load.Load1), "1m")
+		gauge(c.load, float64(stat.Load.Load5), "5m")
+		gauge(c.load, float64(stat.Load.Load15), "15m")
+	}
+	for k, v := range stat.Pressure {
+		gauge(c.pressure, float64(v.Some10), k, "some", "10s")
+		gauge(c.pressure, float64(v.Some60), k, "some", "60s")
+		gauge(c.pressure, float64(v.Some300), k, "some", "300s")
+		gauge(c.pressure, float64(v.Full10), k, "full", "10s")
+		gauge(c.pressure, float64(v.Full60), k, "full", "60s")
+		gauge(c.pressure, float64(v.Full300), k, "full", "300s")
+	}
+	for k, v := range stat.NetIOPSec {
+		gauge(c.netBytes, float64(v.BytesSend), k, "send")
+		gauge(c.netBytes, float64(v.BytesRecv), k, "recv")
+		gauge(c.netPackets, float64(v.PacketsSend), k, "send")
+		gauge(c.netPackets, float64(v.PacketsRecv), k, "recv")
+	}
+	for k, v := range stat.DiskUsage {
+		gauge(c.diskTotal, float64(v.Total), k, v.FSType)
+		gauge(c.diskUsed, float64(v.Used), k, v.FSType)
+		gauge(c.diskInoT, float64(v.InodesTotal), k, v.FSType)
+		gauge(c.diskInoU, float64(v.InodesUsed), k, v.FSType)
+	}
+	for k, v := range stat.DiskIO {
+		gauge(c.dioBytes, float64(v.ReadBytes), k, "read")
+		gauge(c.dioBytes, float64(v.WriteBytes), k, "write")
+		gauge(c.dioIOPS, float64(v.ReadIOPS), k, "read")
+		gauge(c.dioIOPS, float64(v.WriteIOPS), k, "write")
+		gauge(c.dioAwait, float64(v.AwaitMs), k)
+		gauge(c.dioUtil, float64(v.Util), k)
+	}
+	if len(stat.CStat) > 0 {
+		cinfo := c.mgr.Containers()
+		for k, v := range stat.CStat {
+			info := cinfo[k]
+			gauge(c.cCPU, float64(v.CPU), k, info.Name, info.Image)
+			gauge(c.cMemUsed, float64(v.MemUsed), k, info.Name, info.Image)
+			if v.MemLimit > 0 {
+				gauge(c.cMemLimit, float64(v.MemLimit), k, info.Name,
+					info.Image)
+			}
+			gauge(c.cIOBytes, float64(v.IORead), k, info.Name, info.Image,
+				"read")
+			gauge(c.cIOBytes, float64(v.IOWrite), k, info.Name, info.Image,
+				"write")
+		}
+	}
+	for k, v := range stat.Proc {
+		pid := strconv.Itoa(v.Pid)
+		gauge(c.pCPU, float64(v.CPU), k, pid)
+		gauge(c.pRSS, float64(v.RSS), k, pid)
+		gauge(c.pVMS, float64(v.VMS), k, pid)
+		gauge(c.pThreads, float64(v.Threads), k, pid)
+		gauge(c.pFDs, float64(v.FDs), k, pid)
+		gauge(c.pCtxSw, float64(v.VolCtxSw), k, pid, "voluntary")
+		gauge(c.pCtxSw, float64(v.InvolCtxSw), k, pid, "involuntary")
+		gauge(c.pIOBytes, float64(v.ReadBytes), k, pid, "read")
+		gauge(c.pIOBytes, float64(v.WrittenBytes), k, pid, "write")
+	}
+	for k, v := range stat.Sockets {
+		gauge(c.sockTotal, float64(v.Total), k)
+		gauge(c.sockRxQ, float64(v.RxQueue), k)
+		if strings.HasPrefix(k, "udp/") {
+			gauge(c.sockDrops, float64(v.Drops), k)
+			continue
+		}
+		gauge(c.sockTCP, float64(v.Listen), k, "listen")
+		gauge(c.sockTCP, float64(v.Established), k, "established")
+		gauge(c.sockTCP, float64(v.SynRecv), k, "syn_recv")
+		gauge(c.sockTCP, float64(v.TimeWait), k, "time_wait")
+		gauge(c.sockTCP, float64(v.CloseWait), k, "close_wait")
+		gauge(c.sockTCP, float64(v.Other), k, "other")
+	}
+	if stat.UDP != nil {
+		gauge(c.udpRate, float64(stat.UDP.InDatagrams), "in")
+		gauge(c.udpRate, float64(stat.UDP.OutDatagrams), "out")
+		gauge(c.udpRate, float64(stat.UDP.NoPorts), "no_ports")
+		gauge(c.udpRate, float64(stat.UDP.InErrors), "in_errors")
+		gauge(c.udpRate, float64(stat.UDP.RcvbufErrors), "rcvbuf_errors")
+		gauge(c.udpRate, float64(stat.UDP.SndbufErrors), "sndbuf_errors")
+	}
+	for k, v := range stat.Custom {
+		gauge(c.custom, v, k)
+	}
+}
+
+// collectCPUSummary observes the overall CPU usage of the snapshots taken
+// since the last scrape, and collects the summary
+func (c *perfCollector) collectCPUSummary(ch chan<- prometheus.Metric) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	last := c.lastTS
+	for _, s := range c.mgr.Export().Stats {
+		if s.TS <= c.lastTS || s.CPU == nil {
+			continue
+		}
+		c.cpuSummary.Observe(float64(s.CPU.Total))
+		if s.TS > last {
+			last = s.TS
+		}
+	}
+	c.lastTS = last
+	c.cpuSummary.Collect(ch)
+}
@@ -0,0 +1,84 @@
+package sysinfo
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPerfCollector(t *testing.T) {
+	Convey("Test PerfCollector", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		clock := NewManualClock(time.UnixMilli(1760000000000))
+		mgr := CreateManualPerfTimelineMgr(ctx, 1000, 10, PerfStat{
+			CPU: &CPUStat{Total: 50, Core: []float32{40, 60}},
+			Mem: &MemStat{Total: 1000, Used: 400, Available: 600, Free: 300},
+			CStat: map[string]ContainerStat{
+				"c1": {CPU: 12.5, MemUsed: 2048},
+			},
+			CEvent: []ContianerInfo{
+				{ID: "c1", Name: "palworld", Image: "pal:latest", Runing: true},
+			},
+			Custom: map[string]float64{"players": 12},
+		}, clock)
+		col := NewPerfCollector(mgr)
+
+		So(testutil.CollectAndCount(col), ShouldEqual, 19)
+		expected := `
+# HELP container_memory_used_bytes Used memory of container in bytes
+# TYPE container_memory_used_bytes gauge
+container_memory_used_bytes{id="c1",image="pal:latest",name="palworld"} 2048
+# HELP cpu_usage_per_core CPU usage percentage per core
+# TYPE cpu_usage_per_core gauge
+cpu_usage_per_core{core="0"} 40
+cpu_usage_per_core{core="1"} 60
+# HELP custom_metric Metric reported by a custom collector
+# TYPE custom_metric gauge
+custom_metric{series="players"} 12
+`
+		err := testutil.CollectAndCompare(col, strings.NewReader(expected),
+			"container_memory_used_bytes", "cpu_usage_per_core",
+			"custom_metric")
+		So(err, ShouldBeNil)
+
+		// the summary observes each snapshot once
+		So(mgr.Snapshot(), ShouldBeNil)
+		clock.Advance(time.Second)
+		So(mgr.Update(PerfStat{CPU: &CPUStat{Total: 70}}), ShouldBeNil)
+		So(mgr.Snapshot(), ShouldBeNil)
+		expected = `
+# HELP cpu_usage_summary Summary of overall CPU usage percentage over time
+# TYPE cpu_usage_summary summary
+cpu_usage_summary{quantile="0.5"} 50
+cpu_usage_summary{quantile="0.9"} 70
+cpu_usage_summary{quantile="0.99"} 70
+cpu_usage_summary_sum 120
+cpu_usage_summary_count 2
+# HELP memory_free_bytes Free memory in bytes
+# TYPE memory_free_bytes gauge
+memory_free_bytes 300
+`
+		for i := 0; i < 2; i++ {
+			err = testutil.CollectAndCompare(col,
+				strings.NewReader(expected),
+				"cpu_usage_summary", "memory_free_bytes")
+			So(err, ShouldBeNil)
+		}
+
+		So(mgr.Update(PerfStat{Mem: &MemStat{Total: 1000, Used: 900}}),
+			ShouldBeNil)
+		expected = `
+# HELP memory_used_bytes Used memory in bytes
+# TYPE memory_used_bytes gauge
+memory_used_bytes 900
+`
+		err = testutil.CollectAndCompare(col, strings.NewReader(expected),
+			"memory_used_bytes")
+		So(err, ShouldBeNil)
+	})
+}
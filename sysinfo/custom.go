@@ -0,0 +1,225 @@
+package sysinfo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrCustomFormat = errors.New("invalid custom metric format")
+)
+
+const (
+	// DefaultCustomInterval is the interval of running a custom command if
+	// none is given
+	DefaultCustomInterval = 30 * time.Second
+	// DefaultCustomTimeout is the timeout of a custom command if none is
+	// given
+	DefaultCustomTimeout = 10 * time.Second
+)
+
+// parseCustomMetrics parses metrics in the Prometheus text format, or plain
+// "key value" lines. Comments and blank lines are skipped, and an optional
+// timestamp after the value is ignored. Series with labels are keyed by the
+// name and labels as written, such as `players{world="main"}`. Series of
+// NaN or infinite values are skipped, as JSON cannot represent them.
+func parseCustomMetrics(r io.Reader) (map[string]float64, error) {
+	ret := make(map[string]float64)
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		var key string
+		var rest []string
+		if i := strings.IndexByte(line, '{'); i >= 0 {
+			// label values may contain spaces
+			j := strings.LastIndexByte(line, '}')
+			if j < i {
+				return nil, fmt.Errorf("line %d: %w", n, ErrCustomFormat)
+			}
+			key = strings.TrimSpace(line[:i]) + line[i:j+1]
+			rest = strings.Fields(line[j+1:])
+		} else {
+			f := strings.Fields(line)
+			key, rest = f[0], f[1:]
+		}
+		if len(rest) < 1 || len(rest) > 2 {
+			return nil, fmt.Errorf("line %d: %w", n, ErrCustomFormat)
+		}
+		v, err := strconv.ParseFloat(rest[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, ErrCustomFormat)
+		}
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		ret[key] = v
+	}
+	return ret, sc.Err()
+}
+
+// mergeCustom adds the values to the custom section of the snapshot. The
+// section is set even if there are no values, since a nil section keeps the
+// values of the last update in PerfTimelineMgr.
+func mergeCustom(stat *PerfStat, values map[string]float64) {
+	if stat.Custom == nil {
+		stat.Custom = make(map[string]float64, len(values))
+	}
+	for k, v := range values {
+		stat.Custom[k] = v
+	}
+}
+
+// execSampler runs a command in the background and parses its output as
+// custom metrics
+type execSampler struct {
+	ctx      context.Context
+	name     string
+	args     []string
+	interval time.Duration
+	timeout  time.Duration
+	mtx      sync.Mutex
+	running  bool
+	started  time.Time // sampling time the last run is started at
+	last     map[string]float64
+	err      error // error of the last run, reported once
+}
+
+// NewExecSampler creates a Sampler which runs a command and parses its
+// stdout as custom metrics, see PerfStat.Custom. Sample starts the command
+// in the background once the interval has passed in the time of sampling,
+// and only copies the result of the last run, so slow scripts never delay
+// the other samplers. DefaultCustomInterval is used if interval is zero.
+// The command is killed after timeout or when ctx is done,
+// DefaultCustomTimeout is used if timeout is zero. Errors are reported once
+// by the next Sample with the name of the collector, and the values of a
+// failed run are dropped.
+func NewExecSampler(
+	ctx context.Context,
+	name string,
+	interval, timeout time.Duration,
+	command string,
+	args ...string,
+) Sampler {
+	if interval <= 0 {
+		interval = DefaultCustomInterval
+	}
+	if timeout <= 0 {
+		timeout = DefaultCustomTimeout
+	}
+	return &execSampler{
+		ctx:      ctx,
+		name:     name,
+		args:     append([]string{command}, args...),
+		interval: interval,
+		timeout:  timeout,
+	}
+}
+
+// runBackground runs the command and records the result
+func (s *execSampler) runBackground() {
+	values, err := s.run(s.ctx)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.running = false
+	if s.ctx.Err() == nil {
+		s.last, s.err = values, err
+	}
+}
+
+// Sample implements Sampler
+func (s *execSampler) Sample(stat *PerfStat) error {
+	now := sampleTime(stat)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if !s.running && s.ctx.Err() == nil &&
+		(s.started.IsZero() || now.Sub(s.started) >= s.interval) {
+		s.running = true
+		s.started = now
+		go s.runBackground()
+	}
+	mergeCustom(stat, s.last)
+	err := s.err
+	s.err = nil
+	if err != nil {
+		return fmt.Errorf("custom collector %s: %w", s.name, err)
+	}
+	return nil
+}
+
+// run runs the command once
+func (s *execSampler) run(ctx context.Context) (map[string]float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, s.args[0], s.args[1:]...)
+	// children holding the pipes must not block us after the timeout
+	cmd.WaitDelay = time.Second
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("timed out after %s", s.timeout)
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+	return parseCustomMetrics(bytes.NewReader(out))
+}
+
+// textfileSampler reads custom metrics from *.prom files of a directory
+type textfileSampler struct {
+	dir string
+}
+
+// NewTextfileSampler creates a Sampler which reads custom metrics from the
+// *.prom files of a directory, like the textfile collector of
+// node_exporter. Files are expected to be written atomically by renaming.
+// A file which fails to parse is skipped and reported, the others are still
+// sampled.
+func NewTextfileSampler(dir string) Sampler {
+	return &textfileSampler{dir: dir}
+}
+
+// Sample implements Sampler
+func (s *textfileSampler) Sample(stat *PerfStat) error {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.prom"))
+	if err != nil {
+		return fmt.Errorf("custom textfile %s: %w", s.dir, err)
+	}
+	// later files override the series of earlier ones
+	sort.Strings(files)
+	mergeCustom(stat, nil)
+	var errs []error
+	for _, name := range files {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("custom textfile %s: %w", name, err))
+			continue
+		}
+		values, err := parseCustomMetrics(bytes.NewReader(data))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("custom textfile %s: %w", name, err))
+			continue
+		}
+		mergeCustom(stat, values)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,182 @@
+package sysinfo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCustomSampler(t *testing.T) {
+	Convey("Test parsing custom metrics", t, func() {
+		m, err := parseCustomMetrics(strings.NewReader(`
+# HELP players Number of online players
+# TYPE players gauge
+players 12
+tick_rate{world="main", mode="pvp {x}"} 29.5 1760000000000
+save_size_bytes 1.5e+09
+broken NaN
+overflow +Inf
+underflow -Inf
+`))
+		So(err, ShouldBeNil)
+		So(m, ShouldHaveLength, 3)
+		So(m["players"], ShouldEqual, 12)
+		So(m[`tick_rate{world="main", mode="pvp {x}"}`], ShouldEqual, 29.5)
+		So(m["save_size_bytes"], ShouldEqual, 1.5e9)
+		// non-finite values would break the JSON of the timeline
+		So(m, ShouldNotContainKey, "broken")
+		So(m, ShouldNotContainKey, "overflow")
+		So(m, ShouldNotContainKey, "underflow")
+		_, err = json.Marshal(m)
+		So(err, ShouldBeNil)
+
+		_, err = parseCustomMetrics(strings.NewReader("players\n"))
+		So(errors.Is(err, ErrCustomFormat), ShouldBeTrue)
+		_, err = parseCustomMetrics(strings.NewReader("ok 1\nplayers many\n"))
+		So(err.Error(), ShouldContainSubstring, "line 2")
+	})
+
+	Convey("Test textfile sampler", t, func() {
+		dir := t.TempDir()
+		writeFixture(dir, "game.prom", "players 3\nworld_size_bytes 4096\n")
+		writeFixture(dir, "save.prom", "last_save_timestamp 1760000000\n")
+		writeFixture(dir, "ignored.txt", "ignored 1\n")
+		s := NewTextfileSampler(dir)
+
+		stat := PerfStat{Custom: map[string]float64{"other": 1}}
+		So(s.Sample(&stat), ShouldBeNil)
+		So(stat.Custom, ShouldResemble, map[string]float64{
+			"other":               1,
+			"players":             3,
+			"world_size_bytes":    4096,
+			"last_save_timestamp": 1760000000,
+		})
+
+		writeFixture(dir, "bad.prom", "players\n")
+		stat = PerfStat{}
+		err := s.Sample(&stat)
+		So(errors.Is(err, ErrCustomFormat), ShouldBeTrue)
+		So(err.Error(), ShouldContainSubstring, "bad.prom")
+		So(stat.Custom["players"], ShouldEqual, 3)
+
+		// a directory without values clears the section
+		for _, name := range []string{"game", "save", "bad"} {
+			So(os.Remove(filepath.Join(dir, name+".prom")), ShouldBeNil)
+		}
+		stat = PerfStat{}
+		So(s.Sample(&stat), ShouldBeNil)
+		So(stat.Custom, ShouldNotBeNil)
+		So(stat.Custom, ShouldBeEmpty)
+	})
+
+	Convey("Test exec sampler", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		s := NewExecSampler(ctx, "game", time.Hour, time.Second,
+			"sh", "-c", "echo players 7")
+		stat, err := sampleUntilRun(s)
+		So(err, ShouldBeNil)
+		So(stat.Custom["players"], ShouldEqual, 7)
+
+		// the last result is reused until the next run
+		stat = PerfStat{}
+		So(s.Sample(&stat), ShouldBeNil)
+		So(stat.Custom["players"], ShouldEqual, 7)
+
+		s = NewExecSampler(ctx, "fail", time.Hour, time.Second,
+			"sh", "-c", "echo oops >&2; exit 3")
+		stat, err = sampleUntilRun(s)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "custom collector fail")
+		So(err.Error(), ShouldContainSubstring, "oops")
+		So(stat.Custom, ShouldNotBeNil)
+		So(stat.Custom, ShouldBeEmpty)
+		// errors are reported once
+		So(s.Sample(&stat), ShouldBeNil)
+
+		s = NewExecSampler(ctx, "slow", time.Hour, 100*time.Millisecond,
+			"sleep", "5")
+		// sampling does not wait for the running script
+		start := time.Now()
+		So(s.Sample(&stat), ShouldBeNil)
+		So(time.Since(start), ShouldBeLessThan, 50*time.Millisecond)
+		_, err = sampleUntilRun(s)
+		So(err.Error(), ShouldContainSubstring, "timed out")
+		So(time.Since(start), ShouldBeLessThan, 2*time.Second)
+	})
+
+	Convey("Test exec sampler runs by the time of sampling", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		runs := filepath.Join(t.TempDir(), "runs")
+		s := NewExecSampler(ctx, "game", time.Minute, time.Second,
+			"sh", "-c", `echo >> "$0"; echo runs $(wc -l < "$0")`, runs)
+		// runsAt samples at ts until the number of runs is reported
+		runsAt := func(ts int64, want float64) bool {
+			for deadline := time.Now().Add(5 * time.Second); ; {
+				stat := PerfStat{TS: ts}
+				s.Sample(&stat)
+				if stat.Custom["runs"] == want {
+					return true
+				}
+				if time.Now().After(deadline) {
+					return false
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+		So(runsAt(1760000000000, 1), ShouldBeTrue)
+		So(runsAt(1760000030000, 1), ShouldBeTrue)
+		started := func() time.Time {
+			es := s.(*execSampler)
+			es.mtx.Lock()
+			defer es.mtx.Unlock()
+			return es.started
+		}
+		So(started(), ShouldEqual, time.UnixMilli(1760000000000))
+		So(runsAt(1760000060000, 2), ShouldBeTrue)
+		So(started(), ShouldEqual, time.UnixMilli(1760000060000))
+	})
+
+	Convey("Test values of a failed run are dropped", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		fail := filepath.Join(t.TempDir(), "fail")
+		s := NewExecSampler(ctx, "game", 10*time.Millisecond, time.Second,
+			"sh", "-c", `test -e "$0" && exit 1; echo players 7`, fail)
+		clock := NewManualClock(time.UnixMilli(1760000000000))
+		mgr := CreateManualPerfTimelineMgr(ctx, 1000, 10, PerfStat{}, clock)
+		var errs atomic.Int32
+		go RunSamplersWithClock(ctx, mgr, time.Second, clock,
+			func(error) { errs.Add(1) }, s)
+
+		So(advanceUntil(clock, time.Second, func() bool {
+			return mgr.Current().Custom["players"] == 7
+		}), ShouldBeTrue)
+		writeFixture(filepath.Dir(fail), "fail", "")
+		So(advanceUntil(clock, time.Second, func() bool {
+			return errs.Load() > 0 && len(mgr.Current().Custom) == 0
+		}), ShouldBeTrue)
+		So(mgr.Current().Custom, ShouldNotBeNil)
+	})
+}
+
+// sampleUntilRun samples s until the first run of the command has finished
+func sampleUntilRun(s Sampler) (PerfStat, error) {
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		var stat PerfStat
+		err := s.Sample(&stat)
+		if err != nil || len(stat.Custom) > 0 || time.Now().After(deadline) {
+			return stat, err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
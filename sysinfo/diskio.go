@@ -0,0 +1,236 @@
+package sysinfo
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/disk"
+)
+
+// DiskIOStat represents the I/O throughput and latency of a block device.
+// Rates are per second.
+type DiskIOStat struct {
+	ReadBytes  uint64  `json:"read_bytes"`
+	WriteBytes uint64  `json:"write_bytes"`
+	ReadIOPS   float32 `json:"read_iops"`
+	WriteIOPS  float32 `json:"write_iops"`
+	// AwaitMs is the average time in milliseconds of requests, including
+	// the time spent in the queue
+	AwaitMs float32 `json:"await_ms"`
+	// Util is the percentage of time the device is busy
+	Util float32 `json:"util"`
+}
+
+// PseudoFSTypes lists the filesystem types which are not backed by storage.
+// Mounts of these types are skipped unless the disk sampler is created with
+// all set to true.
+var PseudoFSTypes = map[string]bool{
+	"autofs": true, "binfmt_misc": true, "bpf": true, "cgroup": true,
+	"cgroup2": true, "configfs": true, "debugfs": true, "devpts": true,
+	"devtmpfs": true, "efivarfs": true, "fusectl": true, "hugetlbfs": true,
+	"mqueue": true, "nsfs": true, "proc": true, "pstore": true, "ramfs": true,
+	"rpc_pipefs": true, "securityfs": true, "selinuxfs": true, "sysfs": true,
+	"tmpfs": true, "tracefs": true,
+}
+
+// diskCounters is a line of /proc/diskstats
+type diskCounters struct {
+	reads     uint64 // reads completed
+	readSect  uint64 // sectors read
+	readMs    uint64 // time spent reading
+	writes    uint64 // writes completed
+	writeSect uint64 // sectors written
+	writeMs   uint64 // time spent writing
+	ioMs      uint64 // time spent doing I/O
+}
+
+// size of a sector in /proc/diskstats, regardless of the device
+const diskSectorSize = 512
+
+// readDiskstats reads /proc/diskstats
+func readDiskstats() (map[string]diskCounters, error) {
+	data, err := os.ReadFile(procPath("diskstats"))
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]diskCounters)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		f := strings.Fields(sc.Text())
+		if len(f) < 14 {
+			continue
+		}
+		ret[f[2]] = diskCounters{
+			reads:     parseUint(f[3]),
+			readSect:  parseUint(f[5]),
+			readMs:    parseUint(f[6]),
+			writes:    parseUint(f[7]),
+			writeSect: parseUint(f[9]),
+			writeMs:   parseUint(f[10]),
+			ioMs:      parseUint(f[12]),
+		}
+	}
+	return ret, nil
+}
+
+// mountEntry is a line of /proc/self/mounts
+type mountEntry struct {
+	device string
+	point  string
+	fstype string
+}
+
+// unescapeMount decodes the octal escapes (such as \040 for space) used in
+// /proc/self/mounts
+func unescapeMount(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				sb.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// readMounts reads /proc/self/mounts, later mounts on the same mountpoint
+// hide the earlier ones.
+func readMounts() ([]mountEntry, error) {
+	data, err := os.ReadFile(procPath("self", "mounts"))
+	if err != nil {
+		return nil, err
+	}
+	var ret []mountEntry
+	index := make(map[string]int)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		f := strings.Fields(sc.Text())
+		if len(f) < 3 {
+			continue
+		}
+		m := mountEntry{
+			device: unescapeMount(f[0]),
+			point:  unescapeMount(f[1]),
+			fstype: f[2],
+		}
+		if i, ok := index[m.point]; ok {
+			ret[i] = m
+			continue
+		}
+		index[m.point] = len(ret)
+		ret = append(ret, m)
+	}
+	return ret, nil
+}
+
+// isPseudoDevice reports block devices without storage behind
+func isPseudoDevice(name string) bool {
+	return strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram")
+}
+
+// diskSampler samples disk usage of mounts and I/O of block devices
+type diskSampler struct {
+	all    bool
+	lastTs time.Time
+	last   map[string]diskCounters
+}
+
+// NewDiskSampler creates a Sampler which fills PerfStat.DiskUsage and
+// PerfStat.DiskIO. Pseudo filesystems and devices are skipped unless all is
+// true.
+func NewDiskSampler(all bool) Sampler {
+	return &diskSampler{all: all}
+}
+
+// Sample implements Sampler
+func (s *diskSampler) Sample(stat *PerfStat) error {
+	var errs []error
+	if mounts, err := readMounts(); err != nil {
+		errs = append(errs, err)
+	} else {
+		du := make(map[string]DiskUsage, len(mounts))
+		for _, m := range mounts {
+			if !s.all && PseudoFSTypes[m.fstype] {
+				continue
+			}
+			u, err := disk.Usage(m.point)
+			if err != nil {
+				continue
+			}
+			du[m.point] = DiskUsage{
+				Total:       u.Total,
+				Used:        u.Used,
+				InodesTotal: u.InodesTotal,
+				InodesUsed:  u.InodesUsed,
+				FSType:      m.fstype,
+			}
+		}
+		stat.DiskUsage = du
+	}
+
+	if cur, err := readDiskstats(); err != nil {
+		errs = append(errs, err)
+	} else {
+		now := sampleTime(stat)
+		if s.last != nil {
+			stat.DiskIO = s.rates(cur, now.Sub(s.lastTs))
+		}
+		s.last = cur
+		s.lastTs = now
+	}
+	return errors.Join(errs...)
+}
+
+// rates calculates the I/O rates of block devices since the last sample
+func (s *diskSampler) rates(
+	cur map[string]diskCounters,
+	elapsed time.Duration,
+) map[string]DiskIOStat {
+	ret := make(map[string]DiskIOStat, len(cur))
+	sec := elapsed.Seconds()
+	if sec <= 0 {
+		return ret
+	}
+	delta := func(c, p uint64) uint64 {
+		if c < p {
+			return 0 // counter reset
+		}
+		return c - p
+	}
+	for k, c := range cur {
+		p, ok := s.last[k]
+		if !ok || (!s.all && isPseudoDevice(k)) {
+			continue
+		}
+		reads := delta(c.reads, p.reads)
+		writes := delta(c.writes, p.writes)
+		v := DiskIOStat{
+			ReadBytes: uint64(float64(delta(c.readSect, p.readSect)) *
+				diskSectorSize / sec),
+			WriteBytes: uint64(float64(delta(c.writeSect, p.writeSect)) *
+				diskSectorSize / sec),
+			ReadIOPS:  float32(float64(reads) / sec),
+			WriteIOPS: float32(float64(writes) / sec),
+			Util: float32(min(100,
+				float64(delta(c.ioMs, p.ioMs))/(sec*1000)*100)),
+		}
+		if ios := reads + writes; ios > 0 {
+			v.AwaitMs = float32(delta(c.readMs, p.readMs)+
+				delta(c.writeMs, p.writeMs)) / float32(ios)
+		}
+		ret[k] = v
+	}
+	return ret
+}
@@ -0,0 +1,63 @@
+package sysinfo
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDiskSampler(t *testing.T) {
+	Convey("Test disk sampler", t, func() {
+		root := t.TempDir()
+		data := t.TempDir()
+		defer func(old string) { ProcfsRoot = old }(ProcfsRoot)
+		ProcfsRoot = root
+
+		escaped := strings.ReplaceAll(data, " ", `\040`)
+		writeFixture(root, "self/mounts", fmt.Sprintf(
+			"proc /proc proc rw 0 0\n"+
+				"tmpfs /run tmpfs rw 0 0\n"+
+				"/dev/sda1 %s ext4 rw,relatime 0 0\n", escaped))
+		diskstats := func(reads, sectors, ms, ioms uint64) string {
+			return fmt.Sprintf(
+				"   7       0 loop0 1 0 2 0 0 0 0 0 0 0 0 0 0 0 0 0 0\n"+
+					"   8       0 sda %d 0 %d %d %d 0 %d %d 0 %d %d 0 0 0 0 0 0\n",
+				reads, sectors, ms, reads, sectors, ms, ioms, ioms)
+		}
+		writeFixture(root, "diskstats", diskstats(100, 800, 50, 100))
+
+		s := NewDiskSampler(false)
+		var stat PerfStat
+		So(s.Sample(&stat), ShouldBeNil)
+		So(stat.DiskUsage, ShouldContainKey, data)
+		So(stat.DiskUsage, ShouldNotContainKey, "/run")
+		So(stat.DiskUsage, ShouldNotContainKey, "/proc")
+		So(stat.DiskUsage[data].FSType, ShouldEqual, "ext4")
+		So(stat.DiskUsage[data].Total, ShouldBeGreaterThan, 0)
+		So(stat.DiskIO, ShouldBeNil)
+
+		// pretend the last sample was taken 2 seconds ago
+		ds := s.(*diskSampler)
+		ds.lastTs = ds.lastTs.Add(-2 * time.Second)
+		writeFixture(root, "diskstats", diskstats(300, 4800, 450, 1100))
+		stat = PerfStat{}
+		So(s.Sample(&stat), ShouldBeNil)
+		So(stat.DiskIO, ShouldNotContainKey, "loop0")
+		io := stat.DiskIO["sda"]
+		So(io.ReadBytes, ShouldAlmostEqual, 4000*512/2, 2048)
+		So(io.WriteBytes, ShouldAlmostEqual, 4000*512/2, 2048)
+		So(io.ReadIOPS, ShouldAlmostEqual, 100, 1)
+		So(io.WriteIOPS, ShouldAlmostEqual, 100, 1)
+		So(io.AwaitMs, ShouldAlmostEqual, 2, 0.01)
+		So(io.Util, ShouldAlmostEqual, 50, 1)
+
+		Convey("All filesystems", func() {
+			stat := PerfStat{}
+			So(NewDiskSampler(true).Sample(&stat), ShouldBeNil)
+			So(stat.DiskUsage, ShouldContainKey, "/proc")
+		})
+	})
+}
@@ -0,0 +1,251 @@
+package sysinfo
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// SlicePerfTimeline returns the part of the timeline between from and to,
+// inclusive, in unix milliseconds. A zero bound is unbounded.
+func SlicePerfTimeline(tl PerfTimeline, from, to int64) PerfTimeline {
+	in := func(ts int64) bool {
+		return (from == 0 || ts >= from) && (to == 0 || ts <= to)
+	}
+	ret := PerfTimeline{
+		Interval: tl.Interval,
+		Stats:    make([]PerfStat, 0, len(tl.Stats)),
+		CInfo:    tl.CInfo,
+	}
+	for _, s := range tl.Stats {
+		if in(s.TS) {
+			ret.Stats = append(ret.Stats, s)
+		}
+	}
+	for _, a := range tl.Annotations {
+		if in(a.TS) {
+			ret.Annotations = append(ret.Annotations, a)
+		}
+	}
+	return ret
+}
+
+// sections of flattened columns, in the order of columns
+const (
+	colCPU = iota
+	colMem
+	colLoad
+	colPressure
+	colNet
+	colDisk
+	colDiskIO
+	colContainer
+	colProc
+	colSockets
+	colUDP
+	colCustom
+)
+
+// perfColumn is a column of a flattened snapshot. Columns are ordered by
+// section, key and field.
+type perfColumn struct {
+	section int
+	key     string // such as the interface of the network section
+	field   int    // index of the field in the section
+	name    string
+}
+
+// perfCell is a value of a flattened snapshot
+type perfCell struct {
+	perfColumn
+	value float64
+}
+
+// shortContainerID returns the first 12 characters of a container ID, as
+// shown by docker
+func shortContainerID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// flattenPerfStat flattens a snapshot into cells, containers are named by
+// their names in cinfo with the short ID, such as "palworld@0123456789ab",
+// or by their IDs if unnamed
+func flattenPerfStat(
+	s PerfStat,
+	cinfo map[string]ContianerInfo,
+) []perfCell {
+	var ret []perfCell
+	add := func(section int, key, prefix string, fields []string,
+		values ...float64) {
+		for i, v := range values {
+			name := prefix + fields[i]
+			ret = append(ret, perfCell{perfColumn{section, key, i, name}, v})
+		}
+	}
+	if s.CPU != nil {
+		add(colCPU, "", "cpu.",
+			[]string{"total", "user", "system", "iowait", "steal"},
+			float64(s.CPU.Total), float64(s.CPU.User),
+			float64(s.CPU.System), float64(s.CPU.IOWait),
+			float64(s.CPU.Steal))
+		for i, v := range s.CPU.Core {
+			// zero padded to sort the cores in numeric order
+			add(colCPU, fmt.Sprintf("%05d", i), "cpu.core"+strconv.Itoa(i),
+				[]string{""}, float64(v))
+		}
+	}
+	if s.Mem != nil {
+		add(colMem, "", "mem.",
+			[]string{"total", "used", "available", "swap_total", "swap_used",
+				"free"},
+			float64(s.Mem.Total), float64(s.Mem.Used),
+			float64(s.Mem.Available), float64(s.Mem.SwapTotal),
+			float64(s.Mem.SwapUsed), float64(s.Mem.Free))
+	}
+	if s.Load != nil {
+		add(colLoad, "", "load.", []string{"1m", "5m", "15m"},
+			float64(s.Load.Load1), float64(s.Load.Load5),
+			float64(s.Load.Load15))
+	}
+	for k, v := range s.Pressure {
+		add(colPressure, k, "pressure."+k+".",
+			[]string{"some10", "some60", "some300",
+				"full10", "full60", "full300"},
+			float64(v.Some10), float64(v.Some60), float64(v.Some300),
+			float64(v.Full10), float64(v.Full60), float64(v.Full300))
+	}
+	for k, v := range s.NetIOPSec {
+		add(colNet, k, "net."+k+".",
+			[]string{"bytes_send", "bytes_recv",
+				"packets_send", "packets_recv"},
+			float64(v.BytesSend), float64(v.BytesRecv),
+			float64(v.PacketsSend), float64(v.PacketsRecv))
+	}
+	for k, v := range s.DiskUsage {
+		add(colDisk, k, "disk."+k+".",
+			[]string{"total", "used", "inodes_total", "inodes_used"},
+			float64(v.Total), float64(v.Used),
+			float64(v.InodesTotal), float64(v.InodesUsed))
+	}
+	for k, v := range s.DiskIO {
+		add(colDiskIO, k, "diskio."+k+".",
+			[]string{"read_bytes", "write_bytes", "read_iops",
+				"write_iops", "await_ms", "util"},
+			float64(v.ReadBytes), float64(v.WriteBytes),
+			float64(v.ReadIOPS), float64(v.WriteIOPS),
+			float64(v.AwaitMs), float64(v.Util))
+	}
+	for k, v := range s.CStat {
+		// names may be reused by several containers, so the ID is kept
+		name := k
+		if info, ok := cinfo[k]; ok && info.Name != "" {
+			name = info.Name + "@" + shortContainerID(k)
+		}
+		add(colContainer, name, "container."+name+".",
+			[]string{"cpu", "mem_used", "mem_limit", "io_read", "io_write"},
+			float64(v.CPU), float64(v.MemUsed), float64(v.MemLimit),
+			float64(v.IORead), float64(v.IOWrite))
+	}
+	for k, v := range s.Proc {
+		add(colProc, k, "proc."+k+".",
+			[]string{"pid", "cpu", "rss", "vms", "threads", "fds"},
+			float64(v.Pid), float64(v.CPU), float64(v.RSS),
+			float64(v.VMS), float64(v.Threads), float64(v.FDs))
+	}
+	for k, v := range s.Sockets {
+		add(colSockets, k, "sockets."+k+".",
+			[]string{"total", "established", "rx_queue", "drops"},
+			float64(v.Total), float64(v.Established),
+			float64(v.RxQueue), float64(v.Drops))
+	}
+	if s.UDP != nil {
+		add(colUDP, "", "udp.",
+			[]string{"in", "out", "no_ports", "in_errors",
+				"rcvbuf_errors", "sndbuf_errors"},
+			float64(s.UDP.InDatagrams), float64(s.UDP.OutDatagrams),
+			float64(s.UDP.NoPorts), float64(s.UDP.InErrors),
+			float64(s.UDP.RcvbufErrors), float64(s.UDP.SndbufErrors))
+	}
+	for k, v := range s.Custom {
+		add(colCustom, k, "custom."+k, []string{""}, v)
+	}
+	return ret
+}
+
+// WritePerfCSV writes the timeline as CSV with one row per snapshot in
+// ascending order of time. The first columns are the time in RFC 3339 and
+// the timestamp in unix milliseconds, followed by the flattened sections,
+// such as "cpu.core0" or "net.eth0.bytes_recv". Columns are the union of
+// all snapshots in a stable order, missing values are left empty.
+func WritePerfCSV(w io.Writer, tl PerfTimeline) error {
+	rows := make([]map[string]float64, len(tl.Stats))
+	cols := make(map[string]perfColumn)
+	for i := range tl.Stats {
+		s := tl.Stats[len(tl.Stats)-1-i]
+		cells := flattenPerfStat(s, tl.CInfo)
+		rows[i] = make(map[string]float64, len(cells))
+		for _, c := range cells {
+			rows[i][c.name] = c.value
+			cols[c.name] = c.perfColumn
+		}
+	}
+	order := make([]perfColumn, 0, len(cols))
+	for _, c := range cols {
+		order = append(order, c)
+	}
+	sort.Slice(order, func(i, j int) bool {
+		a, b := order[i], order[j]
+		if a.section != b.section {
+			return a.section < b.section
+		}
+		if a.key != b.key {
+			return a.key < b.key
+		}
+		return a.field < b.field
+	})
+
+	cw := csv.NewWriter(w)
+	record := make([]string, 2+len(order))
+	record[0], record[1] = "time", "ts"
+	for i, c := range order {
+		record[2+i] = c.name
+	}
+	if err := cw.Write(record); err != nil {
+		return err
+	}
+	for i, row := range rows {
+		ts := tl.Stats[len(tl.Stats)-1-i].TS
+		record[0] = time.UnixMilli(ts).UTC().Format(time.RFC3339Nano)
+		record[1] = strconv.FormatInt(ts, 10)
+		for j, c := range order {
+			record[2+j] = ""
+			if v, ok := row[c.name]; ok {
+				record[2+j] = strconv.FormatFloat(v, 'f', -1, 64)
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WritePerfJSONL writes the timeline as JSON Lines with one snapshot per
+// line in ascending order of time, in the same form as PerfStat in JSON
+func WritePerfJSONL(w io.Writer, tl PerfTimeline) error {
+	enc := json.NewEncoder(w)
+	for i := len(tl.Stats) - 1; i >= 0; i-- {
+		if err := enc.Encode(tl.Stats[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package sysinfo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPerfExport(t *testing.T) {
+	Convey("Test exporting timelines", t, func() {
+		tl := PerfTimeline{
+			Interval: 1000,
+			CInfo: map[string]ContianerInfo{
+				"c1": {ID: "c1", Name: "palworld"},
+			},
+			Stats: []PerfStat{
+				{
+					TS:  1760000002000,
+					CPU: &CPUStat{Total: 50, Core: make([]float32, 11)},
+					NetIOPSec: map[string]NetStat{
+						"eth0": {BytesRecv: 100}, "wg0": {BytesSend: 5},
+					},
+					CStat: map[string]ContainerStat{
+						"c1": {CPU: 12.5, MemUsed: 2048},
+						"c2": {CPU: 1},
+					},
+					Custom: map[string]float64{"players": 7},
+				},
+				{
+					TS:        1760000001000,
+					CPU:       &CPUStat{Total: 25, Core: make([]float32, 11)},
+					NetIOPSec: map[string]NetStat{"eth0": {BytesRecv: 90}},
+				},
+			},
+			Annotations: []Annotation{
+				{TS: 1760000001500, Type: "operation", Text: "backup"},
+			},
+		}
+
+		Convey("Slice by time range", func() {
+			s := SlicePerfTimeline(tl, 1760000001500, 0)
+			So(s.Stats, ShouldHaveLength, 1)
+			So(s.Stats[0].TS, ShouldEqual, 1760000002000)
+			So(s.Annotations, ShouldHaveLength, 1)
+			s = SlicePerfTimeline(tl, 0, 1760000001000)
+			So(s.Stats, ShouldHaveLength, 1)
+			So(s.Annotations, ShouldBeEmpty)
+			So(SlicePerfTimeline(tl, 0, 0).Stats, ShouldHaveLength, 2)
+		})
+
+		Convey("CSV with stable columns", func() {
+			var buf bytes.Buffer
+			So(WritePerfCSV(&buf, tl), ShouldBeNil)
+			records, err := csv.NewReader(&buf).ReadAll()
+			So(err, ShouldBeNil)
+			So(records, ShouldHaveLength, 3)
+			head := records[0]
+			So(head[:8], ShouldResemble, []string{"time", "ts", "cpu.total",
+				"cpu.user", "cpu.system", "cpu.iowait", "cpu.steal",
+				"cpu.core0"})
+			So(head[8], ShouldEqual, "cpu.core1")
+			So(head[17], ShouldEqual, "cpu.core10")
+			So(head[18], ShouldEqual, "net.eth0.bytes_send")
+			So(head[22], ShouldEqual, "net.wg0.bytes_send")
+			So(head[26], ShouldEqual, "container.c2.cpu")
+			So(head[31], ShouldEqual, "container.palworld@c1.cpu")
+			So(head[len(head)-1], ShouldEqual, "custom.players")
+
+			// ascending order of time, missing values are empty
+			So(records[1][0], ShouldEqual, "2025-10-09T08:53:21Z")
+			So(records[1][1], ShouldEqual, "1760000001000")
+			So(records[1][2], ShouldEqual, "25")
+			So(records[1][len(head)-1], ShouldEqual, "")
+			So(records[2][2], ShouldEqual, "50")
+			So(records[2][19], ShouldEqual, "100")
+			So(records[2][32], ShouldEqual, "2048")
+			So(records[2][len(head)-1], ShouldEqual, "7")
+
+			// the same timeline always gives the same columns
+			var again bytes.Buffer
+			WritePerfCSV(&again, tl)
+			r, _ := csv.NewReader(&again).Read()
+			So(r, ShouldResemble, head)
+		})
+
+		Convey("Containers with the same name get their own columns", func() {
+			tl.CInfo = map[string]ContianerInfo{
+				"0123456789abcdef": {ID: "0123456789abcdef", Name: "pal"},
+				"fedcba9876543210": {ID: "fedcba9876543210", Name: "pal"},
+			}
+			tl.Stats = []PerfStat{{
+				TS: 1760000001000,
+				CStat: map[string]ContainerStat{
+					"0123456789abcdef": {CPU: 1},
+					"fedcba9876543210": {CPU: 2},
+				},
+			}}
+			var buf bytes.Buffer
+			So(WritePerfCSV(&buf, tl), ShouldBeNil)
+			records, err := csv.NewReader(&buf).ReadAll()
+			So(err, ShouldBeNil)
+			So(records[0][2], ShouldEqual, "container.pal@0123456789ab.cpu")
+			So(records[0][7], ShouldEqual, "container.pal@fedcba987654.cpu")
+			So(records[1][2], ShouldEqual, "1")
+			So(records[1][7], ShouldEqual, "2")
+		})
+
+		Convey("JSON Lines", func() {
+			var buf bytes.Buffer
+			So(WritePerfJSONL(&buf, tl), ShouldBeNil)
+			sc := bufio.NewScanner(&buf)
+			var stats []PerfStat
+			for sc.Scan() {
+				var s PerfStat
+				So(json.Unmarshal(sc.Bytes(), &s), ShouldBeNil)
+				stats = append(stats, s)
+			}
+			So(stats, ShouldHaveLength, 2)
+			So(stats[0].TS, ShouldEqual, 1760000001000)
+			So(stats[1].Custom["players"], ShouldEqual, 7)
+		})
+	})
+}
@@ -0,0 +1,169 @@
+package sysinfo
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/host"
+	"github.com/shirou/gopsutil/mem"
+)
+
+// BuildInfo is the version and build info of mushroomant
+type BuildInfo struct {
+	Version   string `json:"version"`
+	GoVersion string `json:"go_version"`
+	Revision  string `json:"revision,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+}
+
+// HostInfo is the inventory of the host
+type HostInfo struct {
+	Hostname        string `json:"hostname"`
+	OS              string `json:"os"`               // such as "linux"
+	Platform        string `json:"platform"`         // distro, such as "ubuntu"
+	PlatformFamily  string `json:"platform_family"`  // such as "debian"
+	PlatformVersion string `json:"platform_version"` // such as "24.04"
+	KernelVersion   string `json:"kernel_version"`
+	KernelArch      string `json:"kernel_arch"`
+	CPUModel        string `json:"cpu_model"`
+	CPUCores        int    `json:"cpu_cores"`   // physical cores
+	CPUThreads      int    `json:"cpu_threads"` // logical processors
+	MemTotal        uint64 `json:"mem_total"`
+	BootTime        int64  `json:"boot_time"` // unix seconds
+	Uptime          int64  `json:"uptime"`    // seconds
+	// Virtualization is the hypervisor or container system, such as "kvm"
+	// or "docker", and VirtualizationRole is "guest" or "host"
+	Virtualization     string `json:"virtualization,omitempty"`
+	VirtualizationRole string `json:"virtualization_role,omitempty"`
+	// Container is the container runtime mushroomant runs in, if any
+	Container string    `json:"container,omitempty"`
+	Build     BuildInfo `json:"build"`
+	// CollectedAt is the unix time in seconds when the inventory is
+	// collected, the uptime is always up to date
+	CollectedAt int64 `json:"collected_at"`
+}
+
+// HostInfoRefresh is the interval to refresh the cached host inventory
+var HostInfoRefresh = 10 * time.Minute
+
+// cache of GetHostInfo
+var (
+	mtxHostInfo sync.Mutex
+	hostInfo    *HostInfo
+)
+
+// GetHostInfo returns the inventory of the host. The inventory is cached
+// and collected again after HostInfoRefresh, since most of it never
+// changes while running.
+func GetHostInfo() (HostInfo, error) {
+	return getHostInfo(SystemClock)
+}
+
+// getHostInfo implements GetHostInfo by the clock
+func getHostInfo(clock Clock) (HostInfo, error) {
+	mtxHostInfo.Lock()
+	defer mtxHostInfo.Unlock()
+	now := clock.Now()
+	if hostInfo == nil ||
+		now.Sub(time.Unix(hostInfo.CollectedAt, 0)) >= HostInfoRefresh {
+		info, err := collectHostInfo(now)
+		if err != nil {
+			return HostInfo{}, err
+		}
+		hostInfo = &info
+	}
+	ret := *hostInfo
+	ret.Uptime = now.Unix() - ret.BootTime
+	return ret, nil
+}
+
+// collectHostInfo collects the host inventory at now
+func collectHostInfo(now time.Time) (HostInfo, error) {
+	hi, err := host.Info()
+	if err != nil {
+		return HostInfo{}, err
+	}
+	ret := HostInfo{
+		Hostname:           hi.Hostname,
+		OS:                 hi.OS,
+		Platform:           hi.Platform,
+		PlatformFamily:     hi.PlatformFamily,
+		PlatformVersion:    hi.PlatformVersion,
+		KernelVersion:      hi.KernelVersion,
+		KernelArch:         hi.KernelArch,
+		BootTime:           int64(hi.BootTime),
+		Virtualization:     hi.VirtualizationSystem,
+		VirtualizationRole: hi.VirtualizationRole,
+		Container:          detectContainer("/"),
+		Build:              GetBuildInfo(),
+		CollectedAt:        now.Unix(),
+	}
+	// the remaining parts are best effort
+	if ci, err := cpu.Info(); err == nil && len(ci) > 0 {
+		ret.CPUModel = ci[0].ModelName
+	}
+	if n, err := cpu.Counts(false); err == nil {
+		ret.CPUCores = n
+	}
+	ret.CPUThreads = runtime.NumCPU()
+	if n, err := cpu.Counts(true); err == nil {
+		ret.CPUThreads = n
+	}
+	if vm, err := mem.VirtualMemory(); err == nil {
+		ret.MemTotal = vm.Total
+	}
+	return ret, nil
+}
+
+// detectContainer detects the container runtime by the marker files under
+// the root directory and the environment of init under ProcfsRoot, returns
+// "" if not in a container
+func detectContainer(root string) string {
+	if _, err := os.Stat(filepath.Join(root, ".dockerenv")); err == nil {
+		return "docker"
+	}
+	if _, err := os.Stat(filepath.Join(root, "run/.containerenv")); err == nil {
+		return "podman"
+	}
+	// systemd-nspawn, lxc and others set $container of init
+	env, err := os.ReadFile(procPath("1", "environ"))
+	if err != nil {
+		return ""
+	}
+	for _, kv := range strings.Split(string(env), "\x00") {
+		if v, ok := strings.CutPrefix(kv, "container="); ok && v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// GetBuildInfo returns the version and build info of the running binary
+func GetBuildInfo() BuildInfo {
+	ret := BuildInfo{Version: "(devel)", GoVersion: runtime.Version()}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ret
+	}
+	if bi.Main.Version != "" {
+		ret.Version = bi.Main.Version
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			ret.Revision = s.Value
+		case "vcs.time":
+			ret.BuildTime = s.Value
+		case "vcs.modified":
+			ret.Modified = s.Value == "true"
+		}
+	}
+	return ret
+}
@@ -0,0 +1,55 @@
+package sysinfo
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHostInfo(t *testing.T) {
+	Convey("Test host inventory", t, func() {
+		mtxHostInfo.Lock()
+		hostInfo = nil
+		mtxHostInfo.Unlock()
+		clock := NewManualClock(time.Now())
+		info, err := getHostInfo(clock)
+		So(err, ShouldBeNil)
+		So(info.Hostname, ShouldNotBeEmpty)
+		So(info.OS, ShouldNotBeEmpty)
+		So(info.CPUThreads, ShouldBeGreaterThan, 0)
+		So(info.MemTotal, ShouldBeGreaterThan, 0)
+		So(info.BootTime, ShouldBeGreaterThan, 0)
+		So(info.Uptime, ShouldBeGreaterThanOrEqualTo, 0)
+		So(info.Build.GoVersion, ShouldNotBeEmpty)
+
+		// the inventory is cached
+		clock.Advance(HostInfoRefresh - time.Second)
+		again, err := getHostInfo(clock)
+		So(err, ShouldBeNil)
+		So(again.CollectedAt, ShouldEqual, info.CollectedAt)
+		So(again.Uptime, ShouldEqual, info.Uptime+
+			int64((HostInfoRefresh-time.Second).Seconds()))
+
+		clock.Advance(time.Second)
+		again, err = getHostInfo(clock)
+		So(err, ShouldBeNil)
+		So(again.CollectedAt, ShouldEqual, info.CollectedAt+
+			int64(HostInfoRefresh.Seconds()))
+	})
+
+	Convey("Test container detection", t, func() {
+		root := t.TempDir()
+		defer func(old string) { ProcfsRoot = old }(ProcfsRoot)
+		ProcfsRoot = filepath.Join(root, "proc")
+		So(detectContainer(root), ShouldEqual, "")
+		writeFixture(root, "proc/1/environ",
+			"PATH=/bin\x00container=systemd-nspawn\x00")
+		So(detectContainer(root), ShouldEqual, "systemd-nspawn")
+		writeFixture(root, "run/.containerenv", "")
+		So(detectContainer(root), ShouldEqual, "podman")
+		writeFixture(root, ".dockerenv", "")
+		So(detectContainer(root), ShouldEqual, "docker")
+	})
+}
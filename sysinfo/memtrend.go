@@ -0,0 +1,280 @@
+package sysinfo
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// kinds of memory trend targets
+const (
+	MemTargetProc      = "proc"
+	MemTargetContainer = "container"
+)
+
+// MemForecast is the memory trend of a process or a container
+type MemForecast struct {
+	Kind string `json:"kind"` // MemTargetProc or MemTargetContainer
+	Key  string `json:"key"`  // key in PerfStat.Proc or PerfStat.CStat
+	TS   int64  `json:"ts"`   // timestamp of the latest snapshot
+	// Used is the latest memory usage in bytes
+	Used uint64 `json:"used"`
+	// Limit is the memory limit in bytes, which is the cgroup limit of the
+	// container, or the used memory plus the available memory of the host
+	Limit uint64 `json:"limit"`
+	// Slope is the growth of memory in bytes per second
+	Slope float64 `json:"slope"`
+	// TTE is the estimated time to exhaustion, 0 if memory is not growing
+	TTE time.Duration `json:"tte"`
+	// Exhausting is true if TTE is within the horizon
+	Exhausting bool `json:"exhausting"`
+}
+
+// String returns a human readable description of the forecast
+func (f MemForecast) String() string {
+	if f.TTE <= 0 && f.Exhausting {
+		return fmt.Sprintf("%s %s: memory exhausted (used %d of %d bytes)",
+			f.Kind, f.Key, f.Used, f.Limit)
+	}
+	if f.TTE <= 0 {
+		return fmt.Sprintf("%s %s: memory is not growing", f.Kind, f.Key)
+	}
+	return fmt.Sprintf("%s %s: OOM expected in %s (used %d of %d bytes, "+
+		"growing %.0f bytes/s)", f.Kind, f.Key, f.TTE.Round(time.Second),
+		f.Used, f.Limit, f.Slope)
+}
+
+// MemTrendConfig configures a MemTrendAnalyzer
+type MemTrendConfig struct {
+	// Window is the duration of history to fit the trend on
+	Window time.Duration
+	// Horizon is the time to exhaustion under which a forecast is
+	// considered exhausting, for example 2 hours
+	Horizon time.Duration
+	// MinSamples is the minimal number of snapshots in the window to fit
+	// a trend, defaults to 10
+	MinSamples int
+	// OnEvent is called when a target starts or stops exhausting
+	OnEvent func(MemForecast)
+}
+
+// MemTrendAnalyzer fits a linear trend to the memory usage of processes
+// and containers over the data of a PerfTimelineMgr, and forecasts when
+// their memory is exhausted. It also implements prometheus.Collector to
+// expose the latest forecasts.
+type MemTrendAnalyzer struct {
+	mgr PerfTimelineMgr
+	cfg MemTrendConfig
+
+	mtx       sync.Mutex
+	forecasts []MemForecast
+	firing    map[string]bool
+
+	descTTE   *prometheus.Desc
+	descSlope *prometheus.Desc
+}
+
+// NewMemTrendAnalyzer creates a MemTrendAnalyzer over the manager
+func NewMemTrendAnalyzer(
+	mgr PerfTimelineMgr,
+	cfg MemTrendConfig,
+) *MemTrendAnalyzer {
+	if cfg.MinSamples <= 0 {
+		cfg.MinSamples = 10
+	}
+	return &MemTrendAnalyzer{
+		mgr:    mgr,
+		cfg:    cfg,
+		firing: make(map[string]bool),
+		descTTE: prometheus.NewDesc("memory_exhaustion_seconds",
+			"Estimated seconds until memory is exhausted, absent if memory "+
+				"is not growing", []string{"kind", "key"}, nil),
+		descSlope: prometheus.NewDesc("memory_growth_bytes_per_second",
+			"Trend of memory usage in bytes per second",
+			[]string{"kind", "key"}, nil),
+	}
+}
+
+// memSample is a point of a memory series
+type memSample struct {
+	ts    int64 // milliseconds
+	used  uint64
+	limit uint64
+}
+
+// fitSlope returns the least squares slope of the samples in bytes per
+// second
+func fitSlope(samples []memSample) float64 {
+	n := float64(len(samples))
+	if n < 2 {
+		return 0
+	}
+	// use the first timestamp as origin to keep precision
+	t0 := samples[0].ts
+	var sx, sy, sxx, sxy float64
+	for _, s := range samples {
+		x := float64(s.ts-t0) / 1000
+		y := float64(s.used)
+		sx += x
+		sy += y
+		sxx += x * x
+		sxy += x * y
+	}
+	den := n*sxx - sx*sx
+	if den == 0 {
+		return 0
+	}
+	return (n*sxy - sx*sy) / den
+}
+
+// Forecast fits the trend of every process and container of the timeline,
+// the stats of the timeline are in descending order of time
+func (a *MemTrendAnalyzer) Forecast(tl PerfTimeline) []MemForecast {
+	if len(tl.Stats) == 0 {
+		return nil
+	}
+	latest := tl.Stats[0].TS
+	series := make(map[[2]string][]memSample)
+	// iterate in ascending order of time
+	for i := len(tl.Stats) - 1; i >= 0; i-- {
+		s := tl.Stats[i]
+		if a.cfg.Window > 0 && latest-s.TS > a.cfg.Window.Milliseconds() {
+			continue
+		}
+		var avail uint64
+		if s.Mem != nil {
+			avail = s.Mem.Available
+		}
+		for k, v := range s.Proc {
+			key := [2]string{MemTargetProc, k}
+			series[key] = append(series[key],
+				memSample{ts: s.TS, used: v.RSS, limit: v.RSS + avail})
+		}
+		for k, v := range s.CStat {
+			limit := v.MemLimit
+			if limit == 0 {
+				limit = v.MemUsed + avail
+			}
+			key := [2]string{MemTargetContainer, k}
+			series[key] = append(series[key],
+				memSample{ts: s.TS, used: v.MemUsed, limit: limit})
+		}
+	}
+
+	var ret []MemForecast
+	for key, samples := range series {
+		last := samples[len(samples)-1]
+		// only fit targets that are still present in the latest snapshot
+		if len(samples) < a.cfg.MinSamples || last.ts != latest {
+			continue
+		}
+		f := MemForecast{
+			Kind:  key[0],
+			Key:   key[1],
+			TS:    last.ts,
+			Used:  last.used,
+			Limit: last.limit,
+			Slope: fitSlope(samples),
+		}
+		if f.Slope > 0 && f.Limit > f.Used {
+			tte := float64(f.Limit-f.Used) / f.Slope * float64(time.Second)
+			// a very slow growth may overflow the duration
+			f.TTE = math.MaxInt64
+			if tte < math.MaxInt64 {
+				f.TTE = time.Duration(tte)
+			}
+			f.Exhausting = f.TTE <= a.cfg.Horizon
+		} else if f.Slope > 0 {
+			f.Exhausting = true // already at the limit
+		}
+		ret = append(ret, f)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Kind != ret[j].Kind {
+			return ret[i].Kind < ret[j].Kind
+		}
+		return ret[i].Key < ret[j].Key
+	})
+	return ret
+}
+
+// Analyze forecasts the current timeline of the manager, keeps the result
+// for Forecasts and the prometheus metrics, and calls OnEvent for the
+// targets which start or stop exhausting.
+func (a *MemTrendAnalyzer) Analyze() []MemForecast {
+	forecasts := a.Forecast(a.mgr.Export())
+	a.mtx.Lock()
+	var events []MemForecast
+	firing := make(map[string]bool, len(forecasts))
+	for _, f := range forecasts {
+		id := f.Kind + "/" + f.Key
+		if f.Exhausting {
+			firing[id] = true
+		}
+		if f.Exhausting != a.firing[id] {
+			events = append(events, f)
+		}
+	}
+	a.firing = firing
+	a.forecasts = forecasts
+	a.mtx.Unlock()
+
+	if a.cfg.OnEvent != nil {
+		for _, f := range events {
+			a.cfg.OnEvent(f)
+		}
+	}
+	return forecasts
+}
+
+// Forecasts returns the result of the last Analyze
+func (a *MemTrendAnalyzer) Forecasts() []MemForecast {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return copySlice(a.forecasts)
+}
+
+// Run calls Analyze every interval of the clock until the context is done,
+// SystemClock is used if clock is nil
+func (a *MemTrendAnalyzer) Run(
+	ctx context.Context,
+	interval time.Duration,
+	clock Clock,
+) {
+	if clock == nil {
+		clock = SystemClock
+	}
+	ticker := clock.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			a.Analyze()
+		}
+	}
+}
+
+// Describe implements prometheus.Collector
+func (a *MemTrendAnalyzer) Describe(ch chan<- *prometheus.Desc) {
+	ch <- a.descTTE
+	ch <- a.descSlope
+}
+
+// Collect implements prometheus.Collector
+func (a *MemTrendAnalyzer) Collect(ch chan<- prometheus.Metric) {
+	for _, f := range a.Forecasts() {
+		ch <- prometheus.MustNewConstMetric(a.descSlope,
+			prometheus.GaugeValue, f.Slope, f.Kind, f.Key)
+		if f.TTE > 0 {
+			ch <- prometheus.MustNewConstMetric(a.descTTE,
+				prometheus.GaugeValue, f.TTE.Seconds(), f.Kind, f.Key)
+		}
+	}
+}
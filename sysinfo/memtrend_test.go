@@ -0,0 +1,123 @@
+package sysinfo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// timelineMgr is a PerfTimelineMgr which exports a fixed timeline
+type timelineMgr struct {
+	PerfTimelineMgr
+	tl PerfTimeline
+}
+
+func (m *timelineMgr) Export() PerfTimeline {
+	return m.tl
+}
+
+// leakTimeline generates a timeline of n snapshots every second, in which
+// the process leaks procLeak bytes and the container leaks cLeak bytes
+// per second
+func leakTimeline(n int, procLeak, cLeak uint64) PerfTimeline {
+	tl := PerfTimeline{Interval: 1000, Stats: make([]PerfStat, n)}
+	for i := range tl.Stats {
+		age := uint64(n - 1 - i) // seconds since the first snapshot
+		tl.Stats[i] = PerfStat{
+			TS:  1760000000000 + int64(age)*1000,
+			Mem: &MemStat{Total: 16 << 30, Available: 8 << 30},
+			Proc: map[string]ProcStat{
+				"palworld": {RSS: 1<<30 + age*procLeak + age%3*4096},
+			},
+			CStat: map[string]ContainerStat{
+				"c1": {MemUsed: 1<<30 + age*cLeak, MemLimit: 2 << 30},
+			},
+		}
+	}
+	return tl
+}
+
+func TestMemTrend(t *testing.T) {
+	Convey("Test memory trend analyzer", t, func() {
+		mgr := &timelineMgr{}
+		var events []MemForecast
+		a := NewMemTrendAnalyzer(mgr, MemTrendConfig{
+			Window:  10 * time.Minute,
+			Horizon: 2 * time.Hour,
+			OnEvent: func(f MemForecast) { events = append(events, f) },
+		})
+
+		Convey("Not enough samples", func() {
+			mgr.tl = leakTimeline(5, 1<<20, 0)
+			So(a.Analyze(), ShouldBeEmpty)
+		})
+
+		Convey("Leaking process and stable container", func() {
+			mgr.tl = leakTimeline(600, 1<<20, 0)
+			fs := a.Analyze()
+			So(fs, ShouldHaveLength, 2)
+			c, p := fs[0], fs[1]
+			So(c.Kind, ShouldEqual, MemTargetContainer)
+			So(c.Slope, ShouldAlmostEqual, 0, 0.001)
+			So(c.TTE, ShouldEqual, 0)
+			So(c.Exhausting, ShouldBeFalse)
+			So(p.Kind, ShouldEqual, MemTargetProc)
+			So(p.Key, ShouldEqual, "palworld")
+			So(p.Slope, ShouldAlmostEqual, 1<<20, 100)
+			// 8GiB available at 1MiB/s
+			So(p.TTE.Seconds(), ShouldAlmostEqual, 8192, 10)
+			So(p.Exhausting, ShouldBeFalse)
+			So(events, ShouldBeEmpty)
+		})
+
+		Convey("Run analyzes on the ticks of the clock", func() {
+			mgr.tl = leakTimeline(600, 1<<20, 0)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			clock := NewManualClock(time.UnixMilli(1760000000000))
+			go a.Run(ctx, time.Minute, clock)
+			So(advanceUntil(clock, time.Minute, func() bool {
+				return len(a.Forecasts()) > 0
+			}), ShouldBeTrue)
+			So(a.Forecasts(), ShouldHaveLength, 2)
+		})
+
+		Convey("Container leaking towards its limit", func() {
+			mgr.tl = leakTimeline(600, 0, 256<<10)
+			fs := a.Analyze()
+			So(fs[0].Kind, ShouldEqual, MemTargetContainer)
+			So(fs[0].Limit, ShouldEqual, 2<<30)
+			So(fs[0].Exhausting, ShouldBeTrue)
+			So(events, ShouldHaveLength, 1)
+			So(events[0].Key, ShouldEqual, "c1")
+			So(events[0].String(), ShouldStartWith,
+				"container c1: OOM expected in")
+
+			// no duplicated event while still exhausting
+			a.Analyze()
+			So(events, ShouldHaveLength, 1)
+
+			// recovered
+			mgr.tl = leakTimeline(600, 0, 0)
+			a.Analyze()
+			So(events, ShouldHaveLength, 2)
+			So(events[1].Exhausting, ShouldBeFalse)
+			So(a.Forecasts(), ShouldHaveLength, 2)
+		})
+
+		Convey("Window limits the fitted history", func() {
+			tl := leakTimeline(1200, 1<<20, 0)
+			// flat during the latest 10 minutes
+			for i := 0; i <= 600; i++ {
+				p := tl.Stats[i].Proc["palworld"]
+				p.RSS = 2 << 30
+				tl.Stats[i].Proc["palworld"] = p
+			}
+			mgr.tl = tl
+			fs := a.Analyze()
+			So(fs[1].Slope, ShouldAlmostEqual, 0, 0.001)
+		})
+	})
+}
@@ -3,6 +3,8 @@ package sysinfo
 import (
 	"context"
 	"errors"
+	"slices"
+	"sort"
 	"sync"
 	"time"
 )
@@ -15,6 +17,11 @@ var (
 type CPUStat struct {
 	Total float32   `json:"total"`
 	Core  []float32 `json:"core"`
+	// breakdown of the overall CPU time in percent
+	User   float32 `json:"user"`
+	System float32 `json:"system"`
+	IOWait float32 `json:"iowait"`
+	Steal  float32 `json:"steal"`
 }
 
 // MemStat represents the memory usage of the system
@@ -22,6 +29,9 @@ type MemStat struct {
 	Total     uint64 `json:"total"`
 	Used      uint64 `json:"used"`
 	Available uint64 `json:"available"`
+	SwapTotal uint64 `json:"swap_total"`
+	SwapUsed  uint64 `json:"swap_used"`
+	Free      uint64 `json:"free"`
 }
 
 // NetStat represents the network I/O of the system
@@ -34,14 +44,22 @@ type NetStat struct {
 
 // DiskUsage represents the disk usage of the system
 type DiskUsage struct {
-	Total uint64 `json:"total"`
-	Used  uint64 `json:"used"`
+	Total       uint64 `json:"total"`
+	Used        uint64 `json:"used"`
+	InodesTotal uint64 `json:"inodes_total"`
+	InodesUsed  uint64 `json:"inodes_used"`
+	FSType      string `json:"fstype"`
 }
 
 // ContainerStat represents the performance data of a container
 type ContainerStat struct {
 	CPU     float32 `json:"cpu"`
 	MemUsed uint64  `json:"mem_used"`
+	// MemLimit is the memory limit of the container, 0 for no limit
+	MemLimit uint64 `json:"mem_limit,omitempty"`
+	// storage I/O in bytes per second
+	IORead  uint64 `json:"io_read,omitempty"`
+	IOWrite uint64 `json:"io_write,omitempty"`
 }
 
 // ContianerInfo represents the information of a container
@@ -50,17 +68,47 @@ type ContianerInfo struct {
 	Name   string `json:"name"`
 	Image  string `json:"image"`
 	Runing bool   `json:"runing"`
+	// lifecycle of the container kept by PerfTimelineMgr, timestamps are
+	// unix milliseconds
+	FirstSeen int64            `json:"first_seen,omitempty"`
+	LastSeen  int64            `json:"last_seen,omitempty"`
+	History   []ContainerState `json:"history,omitempty"`
+}
+
+// ContainerState is a state change of a container
+type ContainerState struct {
+	TS     int64 `json:"ts"`
+	Runing bool  `json:"runing"`
 }
 
 // PerfStat is a struct that contains all the performance data
 // To be an event, it might only contain the data that is changed
 type PerfStat struct {
+	// TS is the unix timestamp in milliseconds when the snapshot is taken
+	TS        int64                    `json:"ts,omitempty"`
 	CPU       *CPUStat                 `json:"cpu,omitempty"`
 	Mem       *MemStat                 `json:"mem,omitempty"`
 	NetIOPSec map[string]NetStat       `json:"net_io,omitempty"`
 	DiskUsage map[string]DiskUsage     `json:"disk_usage,omitempty"`
+	DiskIO    map[string]DiskIOStat    `json:"disk_io,omitempty"`
 	CStat     map[string]ContainerStat `json:"c_stat,omitempty"`
 	CEvent    []ContianerInfo          `json:"c_event,omitempty"`
+	Proc      map[string]ProcStat      `json:"proc,omitempty"`
+	Load      *LoadStat                `json:"load,omitempty"`
+	Pressure  map[string]PressureStat  `json:"pressure,omitempty"`
+	Sockets   map[string]SocketStat    `json:"sockets,omitempty"`
+	UDP       *UDPStat                 `json:"udp,omitempty"`
+	// Custom is the metrics of custom collectors keyed by series name
+	Custom map[string]float64 `json:"custom,omitempty"`
+}
+
+// Annotation is a timestamped marker of an operational event on the
+// timeline, such as a server restart or a backup
+type Annotation struct {
+	TS      int64  `json:"ts"`   // unix milliseconds
+	Type    string `json:"type"` // such as "task_start", "alert"
+	Text    string `json:"text"`
+	TraceID string `json:"trace_id,omitempty"`
 }
 
 // PerfTimeline is a struct that contains a timeline of performance data
@@ -69,6 +117,8 @@ type PerfTimeline struct {
 	// Stats is a list of performance data, in descending order of time
 	Stats []PerfStat               `json:"stats"`
 	CInfo map[string]ContianerInfo `json:"c_event"`
+	// Annotations is a list of annotations, in descending order of time
+	Annotations []Annotation `json:"annotations,omitempty"`
 }
 
 // PerfTimelineMgr provides an interface to maintain a timeline of performance
@@ -77,11 +127,32 @@ type PerfTimelineMgr interface {
 	CountStats() int
 	Clear()
 	Update(stat PerfStat) error
+	// Snapshot takes a snapshot of the current data immediately
+	Snapshot() error
+	// Annotate records an annotation, the current time is used if the
+	// timestamp is zero
+	Annotate(a Annotation) error
+	// Export exports the timeline with the newest snapshot first, as
+	// documented on PerfTimeline. The snapshots share their sections with
+	// the manager and other exports, and must not be modified.
+	//
+	// Before the binary encoding was added, Export started from the slot
+	// after the newest snapshot, which returned the oldest snapshot first
+	// once the ring was full and empty slots before that. Callers relying
+	// on that order must reverse the stats.
 	Export() PerfTimeline
+	// Current returns the current snapshot, which must not be modified
+	Current() PerfStat
+	// Containers returns a copy of all known container info
+	Containers() map[string]ContianerInfo
 }
 
-// copyObj is a generic function to copy an pointer object
+// copyObj is a generic function to copy an pointer object. The copy is
+// shallow, slices and maps in the object are shared, see copyCPUStat.
 func copyObj[T any](s *T) *T {
+	if s == nil {
+		return nil
+	}
 	var ret T
 	ret = *s
 	return &ret
@@ -89,7 +160,10 @@ func copyObj[T any](s *T) *T {
 
 // copyMap is a generic function to copy a map
 func copyMap[T any](s map[string]T) map[string]T {
-	ret := make(map[string]T)
+	if s == nil {
+		return nil
+	}
+	ret := make(map[string]T, len(s))
 	for k, v := range s {
 		ret[k] = v
 	}
@@ -98,6 +172,9 @@ func copyMap[T any](s map[string]T) map[string]T {
 
 // copySlice is a generic function to copy a slice
 func copySlice[T any](s []T) []T {
+	if s == nil {
+		return nil
+	}
 	ret := make([]T, len(s))
 	for i, v := range s {
 		ret[i] = v
@@ -105,21 +182,58 @@ func copySlice[T any](s []T) []T {
 	return ret
 }
 
+// copyCPUStat is used to copy a CPUStat object with the cores
+func copyCPUStat(s *CPUStat) *CPUStat {
+	ret := copyObj(s)
+	if ret != nil {
+		ret.Core = copySlice(s.Core)
+	}
+	return ret
+}
+
+// copyCEvent is used to copy container events with the history
+func copyCEvent(s []ContianerInfo) []ContianerInfo {
+	ret := copySlice(s)
+	for i := range ret {
+		ret[i].History = copySlice(ret[i].History)
+	}
+	return ret
+}
+
+// copyCInfo is used to copy a container info map with the history
+func copyCInfo(s map[string]ContianerInfo) map[string]ContianerInfo {
+	ret := copyMap(s)
+	for k, v := range ret {
+		v.History = copySlice(v.History)
+		ret[k] = v
+	}
+	return ret
+}
+
 // copyPerfStat is used to copy a PerfStat object
 func copyPerfStat(s PerfStat) PerfStat {
 	return PerfStat{
-		CPU:       copyObj(s.CPU),
+		TS:        s.TS,
+		CPU:       copyCPUStat(s.CPU),
 		Mem:       copyObj(s.Mem),
 		NetIOPSec: copyMap(s.NetIOPSec),
 		DiskUsage: copyMap(s.DiskUsage),
+		DiskIO:    copyMap(s.DiskIO),
 		CStat:     copyMap(s.CStat),
-		CEvent:    copySlice(s.CEvent),
+		CEvent:    copyCEvent(s.CEvent),
+		Proc:      copyMap(s.Proc),
+		Load:      copyObj(s.Load),
+		Pressure:  copyMap(s.Pressure),
+		Sockets:   copyMap(s.Sockets),
+		UDP:       copyObj(s.UDP),
+		Custom:    copyMap(s.Custom),
 	}
 }
 
 // perfTimelineMgr is an implementation of PerfTimelineMgr
 type perfTimelineMgr struct {
 	ctx      context.Context          // context
+	clock    Clock                    // source of time
 	mtx      sync.RWMutex             // mutex
 	interval int64                    // interval of each snapshot
 	current  PerfStat                 // current snapshot
@@ -127,6 +241,7 @@ type perfTimelineMgr struct {
 	datashot []PerfStat               // a list of datashot
 	rotate   int                      // current index of datashot
 	used     int                      // used capacity of datashot
+	annots   []Annotation             // annotations in ascending order
 }
 
 // CreatePerfTimelineMgr creates a PerfTimelineMgr object
@@ -136,40 +251,32 @@ func CreatePerfTimelineMgr(
 	capacity int,
 	init PerfStat,
 ) PerfTimelineMgr {
-	ret := &perfTimelineMgr{
-		ctx:      ctx,
-		interval: interval,
-		current: PerfStat{
-			CPU:       copyObj(init.CPU),
-			Mem:       copyObj(init.Mem),
-			NetIOPSec: copyMap(init.NetIOPSec),
-			DiskUsage: copyMap(init.DiskUsage),
-			CStat:     copyMap(init.CStat),
-		},
-		cinfo: make(map[string]ContianerInfo),
-	}
-	for _, v := range init.CEvent {
-		ret.cinfo[v.ID] = v
-	}
+	return CreatePerfTimelineMgrWithClock(ctx, interval, capacity, init,
+		SystemClock)
+}
+
+// CreatePerfTimelineMgrWithClock creates a PerfTimelineMgr which takes
+// snapshots on the ticks of the clock
+func CreatePerfTimelineMgrWithClock(
+	ctx context.Context,
+	interval int64,
+	capacity int,
+	init PerfStat,
+	clock Clock,
+) PerfTimelineMgr {
+	ret := newPerfTimelineMgr(ctx, interval, capacity, init, clock)
 
-	// start time line snapshot
+	// start time line snapshot, the ticker is created before returning so
+	// that a fake clock advanced right away is not missed
+	ticker := clock.NewTicker(time.Duration(interval) * time.Millisecond)
 	go func() {
-		ticker := time.NewTicker(time.Duration(interval) * time.Millisecond)
 		defer ticker.Stop()
 		for {
 			select {
 			case <-ret.ctx.Done():
 				return
-			case <-ticker.C:
-				func() {
-					ret.mtx.Lock()
-					defer ret.mtx.Unlock()
-					ret.datashot[ret.rotate] = copyPerfStat(ret.current)
-					ret.rotate = (ret.rotate + 1) % capacity
-					if ret.used < capacity {
-						ret.used++
-					}
-				}()
+			case t := <-ticker.C():
+				ret.snapshot(t.UnixMilli())
 			}
 		}
 	}()
@@ -177,6 +284,133 @@ func CreatePerfTimelineMgr(
 	return ret
 }
 
+// CreateManualPerfTimelineMgr creates a PerfTimelineMgr in manual mode,
+// which never takes snapshots by itself. The caller triggers snapshots with
+// Snapshot, which are timestamped by the clock. The interval is only
+// reported in exports.
+func CreateManualPerfTimelineMgr(
+	ctx context.Context,
+	interval int64,
+	capacity int,
+	init PerfStat,
+	clock Clock,
+) PerfTimelineMgr {
+	return newPerfTimelineMgr(ctx, interval, capacity, init, clock)
+}
+
+// newPerfTimelineMgr creates a perfTimelineMgr without starting the ticker
+func newPerfTimelineMgr(
+	ctx context.Context,
+	interval int64,
+	capacity int,
+	init PerfStat,
+	clock Clock,
+) *perfTimelineMgr {
+	ret := &perfTimelineMgr{
+		ctx:      ctx,
+		clock:    clock,
+		interval: interval,
+		current:  copyPerfStat(init),
+		cinfo:    make(map[string]ContianerInfo),
+		datashot: make([]PerfStat, capacity),
+	}
+	// snapshots are timestamped when taken, and the initial events are
+	// recorded with the first snapshot
+	ret.current.TS = 0
+	return ret
+}
+
+// snapshot appends the current snapshot to the timeline
+func (m *perfTimelineMgr) snapshot(ts int64) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	// sections are immutable once stored, so the snapshot shares them with
+	// the current data, Update replaces a section instead of modifying it
+	snap := m.current
+	snap.TS = ts
+	size := len(m.datashot)
+	m.datashot[m.rotate] = snap
+	m.rotate = (m.rotate + 1) % size
+	if m.used < size {
+		m.used++
+	}
+	// events only belong to the snapshot they are taken in
+	m.current.CEvent = nil
+
+	for _, v := range snap.CEvent {
+		m.recordCEvent(v, ts)
+	}
+	for id := range snap.CStat {
+		info, ok := m.cinfo[id]
+		if !ok {
+			// stats without any event, the container must be running
+			m.recordCEvent(ContianerInfo{ID: id, Runing: true}, ts)
+			continue
+		}
+		info.LastSeen = ts
+		m.cinfo[id] = info
+	}
+	oldest := m.datashot[(m.rotate-m.used+size)%size].TS
+	m.pruneCInfo(oldest)
+	// annotations made before the first snapshot stay until the ring is
+	// full, then they are older than any snapshot being dropped
+	if m.used == size {
+		m.pruneAnnotations(oldest)
+	}
+}
+
+// pruneAnnotations removes the annotations before the oldest snapshot
+func (m *perfTimelineMgr) pruneAnnotations(oldest int64) {
+	n := sort.Search(len(m.annots), func(i int) bool {
+		return m.annots[i].TS >= oldest
+	})
+	if n > 0 {
+		m.annots = copySlice(m.annots[n:])
+	}
+}
+
+// recordCEvent records a container event in the container info
+func (m *perfTimelineMgr) recordCEvent(v ContianerInfo, ts int64) {
+	info, ok := m.cinfo[v.ID]
+	if !ok {
+		info = ContianerInfo{ID: v.ID, FirstSeen: ts}
+	}
+	if v.Name != "" {
+		info.Name = v.Name
+	}
+	if v.Image != "" {
+		info.Image = v.Image
+	}
+	if !ok || info.Runing != v.Runing {
+		info.History = append(info.History,
+			ContainerState{TS: ts, Runing: v.Runing})
+	}
+	info.Runing = v.Runing
+	info.LastSeen = ts
+	m.cinfo[v.ID] = info
+}
+
+// pruneCInfo removes the containers which are not seen since the oldest
+// retained snapshot, and the history before it. Running containers expire
+// as well, since a removed container may never report a stop event. The
+// last state before the oldest snapshot is kept as the initial state.
+func (m *perfTimelineMgr) pruneCInfo(oldest int64) {
+	for id, info := range m.cinfo {
+		if info.LastSeen < oldest {
+			delete(m.cinfo, id)
+			continue
+		}
+		n := 0
+		for n+1 < len(info.History) && info.History[n+1].TS <= oldest {
+			n++
+		}
+		if n > 0 {
+			info.History = copySlice(info.History[n:])
+			m.cinfo[id] = info
+		}
+	}
+}
+
 // Active returns true if the manager is still active
 func (m *perfTimelineMgr) Active() bool {
 	select {
@@ -200,9 +434,11 @@ func (m *perfTimelineMgr) Clear() {
 	defer m.mtx.Unlock()
 	m.used = 0
 	m.rotate = 0
+	m.annots = nil
 }
 
-// Update updates the current snapshot
+// Update updates the current snapshot, the sections given are copied so
+// that stored snapshots are never modified
 func (m *perfTimelineMgr) Update(stat PerfStat) error {
 	if !m.Active() {
 		return ErrPerfTimelineMgrClosed
@@ -210,7 +446,7 @@ func (m *perfTimelineMgr) Update(stat PerfStat) error {
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
 	if stat.CPU != nil {
-		m.current.CPU = copyObj(stat.CPU)
+		m.current.CPU = copyCPUStat(stat.CPU)
 	}
 	if stat.Mem != nil {
 		m.current.Mem = copyObj(stat.Mem)
@@ -221,29 +457,152 @@ func (m *perfTimelineMgr) Update(stat PerfStat) error {
 	if stat.DiskUsage != nil {
 		m.current.DiskUsage = copyMap(stat.DiskUsage)
 	}
+	if stat.DiskIO != nil {
+		m.current.DiskIO = copyMap(stat.DiskIO)
+	}
 	if stat.CStat != nil {
 		m.current.CStat = copyMap(stat.CStat)
 	}
+	if stat.Proc != nil {
+		m.current.Proc = copyMap(stat.Proc)
+	}
+	if stat.Load != nil {
+		m.current.Load = copyObj(stat.Load)
+	}
+	if stat.Pressure != nil {
+		m.current.Pressure = copyMap(stat.Pressure)
+	}
+	if stat.Sockets != nil {
+		m.current.Sockets = copyMap(stat.Sockets)
+	}
+	if stat.UDP != nil {
+		m.current.UDP = copyObj(stat.UDP)
+	}
+	if stat.Custom != nil {
+		m.current.Custom = copyMap(stat.Custom)
+	}
 	if stat.CEvent != nil {
-		m.current.CEvent = copySlice(stat.CEvent)
-		for _, v := range stat.CEvent {
-			m.cinfo[v.ID] = v
-		}
+		// keep the events not yet taken in a snapshot, they are recorded
+		// in the container info when the snapshot is taken
+		m.current.CEvent = append(m.current.CEvent,
+			copyCEvent(stat.CEvent)...)
+	}
+	return nil
+}
+
+// Snapshot takes a snapshot timestamped by the clock
+func (m *perfTimelineMgr) Snapshot() error {
+	if !m.Active() {
+		return ErrPerfTimelineMgrClosed
 	}
+	m.snapshot(m.clock.Now().UnixMilli())
 	return nil
 }
 
-// Export exports the timeline data
+// Annotate records an annotation
+func (m *perfTimelineMgr) Annotate(a Annotation) error {
+	if !m.Active() {
+		return ErrPerfTimelineMgrClosed
+	}
+	if a.TS == 0 {
+		a.TS = m.clock.Now().UnixMilli()
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	// keep in ascending order, annotations mostly come in order
+	i := sort.Search(len(m.annots), func(i int) bool {
+		return m.annots[i].TS > a.TS
+	})
+	m.annots = slices.Insert(m.annots, i, a)
+	return nil
+}
+
+// Export exports the timeline data without copying the snapshots, newest
+// first
 func (m *perfTimelineMgr) Export() PerfTimeline {
 	m.mtx.RLock()
 	defer m.mtx.RUnlock()
 	ret := PerfTimeline{
 		Interval: m.interval,
 		Stats:    make([]PerfStat, m.used),
-		CInfo:    copyMap(m.cinfo),
+		CInfo:    copyCInfo(m.cinfo),
 	}
+	// the latest snapshot is just before the rotate index
+	size := len(m.datashot)
 	for i := 0; i < m.used; i++ {
-		ret.Stats[i] = copyPerfStat(m.datashot[(m.rotate+i)%len(m.datashot)])
+		ret.Stats[i] = m.datashot[(m.rotate-1-i+size)%size]
+	}
+	if len(m.annots) > 0 {
+		ret.Annotations = make([]Annotation, len(m.annots))
+		for i, a := range m.annots {
+			ret.Annotations[len(m.annots)-1-i] = a
+		}
+	}
+	return ret
+}
+
+// Current returns the current snapshot
+func (m *perfTimelineMgr) Current() PerfStat {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	return m.current
+}
+
+// Containers returns a copy of all known container info, including the
+// events not yet taken in a snapshot
+func (m *perfTimelineMgr) Containers() map[string]ContianerInfo {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	ret := copyCInfo(m.cinfo)
+	for _, v := range m.current.CEvent {
+		info, ok := ret[v.ID]
+		if !ok {
+			info.ID = v.ID
+		}
+		if v.Name != "" {
+			info.Name = v.Name
+		}
+		if v.Image != "" {
+			info.Image = v.Image
+		}
+		info.Runing = v.Runing
+		ret[v.ID] = info
+	}
+	return ret
+}
+
+// FilterContainer returns the timeline of a single container, given by ID
+// or name. Snapshots keep only the timestamp and the stats and events of
+// the container, annotations are kept as is.
+func FilterContainer(tl PerfTimeline, container string) PerfTimeline {
+	id := container
+	if _, ok := tl.CInfo[id]; !ok {
+		for k, v := range tl.CInfo {
+			if v.Name == container {
+				id = k
+				break
+			}
+		}
+	}
+	ret := PerfTimeline{
+		Interval:    tl.Interval,
+		Stats:       make([]PerfStat, len(tl.Stats)),
+		CInfo:       make(map[string]ContianerInfo),
+		Annotations: tl.Annotations,
+	}
+	if info, ok := tl.CInfo[id]; ok {
+		ret.CInfo[id] = info
+	}
+	for i, s := range tl.Stats {
+		ret.Stats[i].TS = s.TS
+		if v, ok := s.CStat[id]; ok {
+			ret.Stats[i].CStat = map[string]ContainerStat{id: v}
+		}
+		for _, v := range s.CEvent {
+			if v.ID == id {
+				ret.Stats[i].CEvent = append(ret.Stats[i].CEvent, v)
+			}
+		}
 	}
 	return ret
 }
@@ -0,0 +1,268 @@
+package sysinfo
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPerfTimelineMgr(t *testing.T) {
+	Convey("Test perf timeline manager", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		// the ticker never fires, snapshots are taken by hand
+		mgr := CreatePerfTimelineMgr(ctx, 3600000, 3, PerfStat{})
+		m := mgr.(*perfTimelineMgr)
+
+		Convey("Snapshots are exported in descending order", func() {
+			for i := int64(1); i <= 4; i++ {
+				mgr.Update(PerfStat{Mem: &MemStat{Used: uint64(i)}})
+				m.snapshot(i * 1000)
+			}
+			tl := mgr.Export()
+			So(mgr.CountStats(), ShouldEqual, 3)
+			So(tl.Stats, ShouldHaveLength, 3)
+			So(tl.Stats[0].TS, ShouldEqual, 4000)
+			So(tl.Stats[0].Mem.Used, ShouldEqual, 4)
+			So(tl.Stats[2].TS, ShouldEqual, 2000)
+		})
+
+		Convey("Stored snapshots are never modified", func() {
+			net := map[string]NetStat{"eth0": {BytesSend: 1}}
+			mgr.Update(PerfStat{NetIOPSec: net})
+			net["eth0"] = NetStat{BytesSend: 2}
+			So(mgr.Current().NetIOPSec["eth0"].BytesSend, ShouldEqual, 1)
+			// slices inside sections are copied as well
+			cpu := &CPUStat{Total: 1, Core: []float32{1, 1}}
+			mgr.Update(PerfStat{CPU: cpu})
+			cpu.Core[0] = 2
+			So(mgr.Current().CPU.Core[0], ShouldEqual, 1)
+			dup := copyPerfStat(mgr.Current())
+			dup.CPU.Core[1] = 2
+			So(mgr.Current().CPU.Core[1], ShouldEqual, 1)
+			hist := []ContainerState{{TS: 1, Runing: true}}
+			mgr.Update(PerfStat{CEvent: []ContianerInfo{
+				{ID: "c1", History: hist},
+			}})
+			hist[0].Runing = false
+			So(mgr.Current().CEvent[0].History[0].Runing, ShouldBeTrue)
+			m.snapshot(1000)
+			before := mgr.Export()
+
+			mgr.Update(PerfStat{NetIOPSec: map[string]NetStat{
+				"eth0": {BytesSend: 3},
+			}})
+			m.snapshot(2000)
+			So(before.Stats, ShouldHaveLength, 1)
+			So(before.Stats[0].NetIOPSec["eth0"].BytesSend, ShouldEqual, 1)
+			tl := mgr.Export()
+			So(tl.Stats[0].NetIOPSec["eth0"].BytesSend, ShouldEqual, 3)
+			So(tl.Stats[1].NetIOPSec["eth0"].BytesSend, ShouldEqual, 1)
+		})
+
+		Convey("Annotations are retained alongside snapshots", func() {
+			So(mgr.Annotate(Annotation{TS: 500, Type: "task_start",
+				Text: "server started"}), ShouldBeNil)
+			m.snapshot(1000)
+			// annotations before the first snapshot are kept until the
+			// ring is full
+			So(mgr.Export().Annotations, ShouldHaveLength, 1)
+			So(mgr.Annotate(Annotation{TS: 2500, Type: "operation",
+				Text: "backup started"}), ShouldBeNil)
+			So(mgr.Annotate(Annotation{TS: 1500, Type: "task_start",
+				Text: "server restarted by alice", TraceID: "abc"}), ShouldBeNil)
+			So(mgr.Annotate(Annotation{Type: "task_exit"}), ShouldBeNil)
+			m.snapshot(2000)
+			m.snapshot(3000)
+			tl := mgr.Export()
+			So(tl.Annotations, ShouldHaveLength, 3)
+			So(tl.Annotations[2].TS, ShouldEqual, 1500)
+			So(tl.Annotations[1].Text, ShouldEqual, "backup started")
+			So(tl.Annotations[2].TraceID, ShouldEqual, "abc")
+			So(tl.Annotations[0].TS, ShouldBeGreaterThan, 3000)
+
+			m.snapshot(4000)
+			tl = mgr.Export()
+			So(tl.Annotations, ShouldHaveLength, 2)
+			So(tl.Annotations[1].TS, ShouldEqual, 2500)
+
+			mgr.Clear()
+			So(mgr.Export().Annotations, ShouldBeNil)
+			cancel()
+			So(mgr.Annotate(Annotation{}), ShouldEqual,
+				ErrPerfTimelineMgrClosed)
+		})
+
+		Convey("Container lifecycle", func() {
+			c1 := ContianerInfo{ID: "c1", Name: "palworld", Runing: true}
+			c2 := ContianerInfo{ID: "c2", Name: "backup", Runing: true}
+			mgr.Update(PerfStat{
+				CStat:  map[string]ContainerStat{"c1": {}, "c2": {}},
+				CEvent: []ContianerInfo{c1, c2},
+			})
+			m.snapshot(1000)
+			// events belong to a single snapshot
+			m.snapshot(2000)
+			tl := mgr.Export()
+			So(tl.Stats[1].CEvent, ShouldHaveLength, 2)
+			So(tl.Stats[0].CEvent, ShouldBeNil)
+			So(tl.CInfo["c1"].LastSeen, ShouldEqual, 2000)
+			So(tl.CInfo["c1"].History, ShouldHaveLength, 1)
+
+			c2.Runing = false
+			mgr.Update(PerfStat{
+				CStat:  map[string]ContainerStat{"c1": {}},
+				CEvent: []ContianerInfo{c2},
+			})
+			m.snapshot(3000)
+			info := mgr.Containers()["c2"]
+			So(info.Runing, ShouldBeFalse)
+			So(info.History, ShouldHaveLength, 2)
+			So(info.History[1].Runing, ShouldBeFalse)
+
+			// c2 falls out of the retained timeline
+			m.snapshot(4000)
+			m.snapshot(5000)
+			So(mgr.Containers(), ShouldContainKey, "c2")
+			m.snapshot(6000)
+			cinfo := mgr.Containers()
+			So(cinfo, ShouldNotContainKey, "c2")
+			So(cinfo["c1"].FirstSeen, ShouldEqual, 1000)
+			So(cinfo["c1"].LastSeen, ShouldEqual, 6000)
+
+			Convey("Running containers which disappear expire", func() {
+				mgr.Update(PerfStat{CStat: map[string]ContainerStat{
+					"c1": {}, "c4": {},
+				}})
+				m.snapshot(7000)
+				mgr.Update(PerfStat{CStat: map[string]ContainerStat{"c1": {}}})
+				m.snapshot(8000)
+				m.snapshot(9000)
+				So(mgr.Containers()["c4"].Runing, ShouldBeTrue)
+				m.snapshot(10000)
+				So(mgr.Containers(), ShouldNotContainKey, "c4")
+				So(mgr.Containers(), ShouldContainKey, "c1")
+			})
+
+			Convey("Filter a single container", func() {
+				mgr.Update(PerfStat{CStat: map[string]ContainerStat{
+					"c1": {MemUsed: 10}, "c3": {MemUsed: 20},
+				}})
+				m.snapshot(7000)
+				tl := FilterContainer(mgr.Export(), "palworld")
+				So(tl.CInfo, ShouldHaveLength, 1)
+				So(tl.CInfo, ShouldContainKey, "c1")
+				So(tl.Stats, ShouldHaveLength, 3)
+				So(tl.Stats[0].TS, ShouldEqual, 7000)
+				So(tl.Stats[0].CStat, ShouldResemble,
+					map[string]ContainerStat{"c1": {MemUsed: 10}})
+				So(tl.Stats[0].Mem, ShouldBeNil)
+				// c3 is discovered by stats without any event
+				So(mgr.Containers()["c3"].Runing, ShouldBeTrue)
+			})
+		})
+	})
+}
+
+// benchPerfTimelineMgr runs concurrent exports against a full manager while
+// a writer keeps updating and ticking it. With legacy, the writer and the
+// readers copy every snapshot under the lock as before snapshots were
+// shared, which is measured as the baseline.
+func benchPerfTimelineMgr(b *testing.B, legacy bool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rec := genTimeline(720, 16, 4)
+	mgr := CreateManualPerfTimelineMgr(ctx, rec.Interval, len(rec.Stats),
+		PerfStat{}, NewManualClock(time.UnixMilli(rec.Stats[0].TS)))
+	m := mgr.(*perfTimelineMgr)
+	for i := len(rec.Stats) - 1; i >= 0; i-- {
+		mgr.Update(rec.Stats[i])
+		m.snapshot(rec.Stats[i].TS)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ts := rec.Stats[0].TS
+		for i := 0; ctx.Err() == nil; i++ {
+			mgr.Update(rec.Stats[i%len(rec.Stats)])
+			ts += rec.Interval
+			if legacy {
+				legacySnapshot(m, ts)
+			} else {
+				m.snapshot(ts)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if legacy {
+				legacyExport(m)
+			} else {
+				mgr.Export()
+			}
+		}
+	})
+	b.StopTimer()
+	cancel()
+	wg.Wait()
+}
+
+// legacySnapshot takes a snapshot by a deep copy under the write lock
+func legacySnapshot(m *perfTimelineMgr, ts int64) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	snap := copyPerfStat(m.current)
+	snap.TS = ts
+	size := len(m.datashot)
+	m.datashot[m.rotate] = snap
+	m.rotate = (m.rotate + 1) % size
+	if m.used < size {
+		m.used++
+	}
+}
+
+// legacyExport exports by a deep copy of every snapshot under the read lock
+func legacyExport(m *perfTimelineMgr) PerfTimeline {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	ret := PerfTimeline{
+		Interval: m.interval,
+		Stats:    make([]PerfStat, m.used),
+		CInfo:    copyCInfo(m.cinfo),
+	}
+	size := len(m.datashot)
+	for i := 0; i < m.used; i++ {
+		ret.Stats[i] = copyPerfStat(m.datashot[(m.rotate-1-i+size)%size])
+	}
+	return ret
+}
+
+func BenchmarkPerfTimelineMgr(b *testing.B) {
+	b.Run("ExportShared", func(b *testing.B) {
+		benchPerfTimelineMgr(b, false)
+	})
+	b.Run("ExportDeepCopy", func(b *testing.B) {
+		benchPerfTimelineMgr(b, true)
+	})
+	b.Run("Tick", func(b *testing.B) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		rec := genTimeline(1, 16, 4)
+		mgr := CreateManualPerfTimelineMgr(ctx, 1000, 720, PerfStat{},
+			SystemClock)
+		m := mgr.(*perfTimelineMgr)
+		mgr.Update(rec.Stats[0])
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			m.snapshot(int64(i))
+		}
+	})
+}
@@ -0,0 +1,1243 @@
+package sysinfo
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+)
+
+// PerfTimelineMIME is the content type of the compact binary encoding of
+// PerfTimeline.
+const PerfTimelineMIME = "application/x-mra-perf-timeline"
+
+// The compact encoding of PerfTimeline follows the Gorilla style:
+// timestamps are written as delta-of-delta, values are XOR-compressed
+// against the previous value of the same series, and all map keys
+// (container IDs, interfaces, mountpoints) are coded by a dictionary.
+//
+// Layout:
+//
+//	magic "MRPT" | version | bit stream
+//
+// The bit stream starts with the interval, the string dictionary and the
+// container info, followed by the snapshots in their original order.
+var perfCodecMagic = []byte{'M', 'R', 'P', 'T'}
+
+const perfCodecVersion = 1
+
+var (
+	ErrPerfCodecFormat  = errors.New("invalid perf timeline encoding")
+	ErrPerfCodecVersion = errors.New("unsupported perf timeline encoding version")
+)
+
+// bit flags of the sections present in a snapshot
+const (
+	pcfCPU = 1 << iota
+	pcfMem
+	pcfNet
+	pcfDisk
+	pcfCStat
+	pcfCEvent
+	pcfProc
+	pcfDiskIO
+	pcfLoad
+	pcfPressure
+	pcfCustom
+	pcfSockets
+	pcfUDP
+	pcfAll = pcfCPU | pcfMem | pcfNet | pcfDisk | pcfCStat | pcfCEvent |
+		pcfProc | pcfDiskIO | pcfLoad | pcfPressure | pcfCustom |
+		pcfSockets | pcfUDP
+)
+
+// bitWriter writes bits to a byte buffer, most significant bit first
+type bitWriter struct {
+	buf   []byte
+	nbits uint8 // used bits in the last byte
+}
+
+// writeBit writes a single bit
+func (w *bitWriter) writeBit(b bool) {
+	if w.nbits == 0 || w.nbits == 8 {
+		w.buf = append(w.buf, 0)
+		w.nbits = 0
+	}
+	if b {
+		w.buf[len(w.buf)-1] |= 0x80 >> w.nbits
+	}
+	w.nbits++
+}
+
+// writeBits writes the lowest n bits of v
+func (w *bitWriter) writeBits(v uint64, n int) {
+	for n > 0 {
+		if w.nbits == 0 || w.nbits == 8 {
+			w.buf = append(w.buf, 0)
+			w.nbits = 0
+		}
+		free := 8 - int(w.nbits)
+		take := min(free, n)
+		chunk := byte((v >> (n - take)) & (1<<take - 1))
+		w.buf[len(w.buf)-1] |= chunk << (free - take)
+		w.nbits += uint8(take)
+		n -= take
+	}
+}
+
+// writeUvarint writes v in groups of 7 bits with a continuation bit
+func (w *bitWriter) writeUvarint(v uint64) {
+	for v >= 0x80 {
+		w.writeBits(v&0x7f|0x80, 8)
+		v >>= 7
+	}
+	w.writeBits(v, 8)
+}
+
+// writeVarint writes a signed integer by zigzag encoding
+func (w *bitWriter) writeVarint(v int64) {
+	w.writeUvarint(uint64(v<<1) ^ uint64(v>>63))
+}
+
+// writeString writes a length prefixed string
+func (w *bitWriter) writeString(s string) {
+	w.writeUvarint(uint64(len(s)))
+	for i := 0; i < len(s); i++ {
+		w.writeBits(uint64(s[i]), 8)
+	}
+}
+
+// bitReader reads bits written by bitWriter
+type bitReader struct {
+	buf []byte
+	pos int // position in bits
+}
+
+// readBit reads a single bit
+func (r *bitReader) readBit() (bool, error) {
+	if r.pos >= len(r.buf)*8 {
+		return false, io.ErrUnexpectedEOF
+	}
+	b := r.buf[r.pos/8]&(0x80>>(r.pos%8)) != 0
+	r.pos++
+	return b, nil
+}
+
+// readBits reads n bits as the lowest bits of the result
+func (r *bitReader) readBits(n int) (uint64, error) {
+	if r.pos+n > len(r.buf)*8 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	var v uint64
+	for n > 0 {
+		off := r.pos % 8
+		avail := 8 - off
+		take := min(avail, n)
+		chunk := uint64(r.buf[r.pos/8]>>(avail-take)) & (1<<take - 1)
+		v = v<<take | chunk
+		r.pos += take
+		n -= take
+	}
+	return v, nil
+}
+
+// readUvarint reads an integer written by writeUvarint
+func (r *bitReader) readUvarint() (uint64, error) {
+	var v uint64
+	for shift := 0; shift < 64; shift += 7 {
+		b, err := r.readBits(8)
+		if err != nil {
+			return 0, err
+		}
+		v |= (b & 0x7f) << shift
+		if b < 0x80 {
+			return v, nil
+		}
+	}
+	return 0, ErrPerfCodecFormat
+}
+
+// readVarint reads an integer written by writeVarint
+func (r *bitReader) readVarint() (int64, error) {
+	u, err := r.readUvarint()
+	return int64(u>>1) ^ -int64(u&1), err
+}
+
+// readString reads a string written by writeString
+func (r *bitReader) readString() (string, error) {
+	n, err := r.readUvarint()
+	if err != nil {
+		return "", err
+	}
+	if n > uint64(len(r.buf)) {
+		return "", ErrPerfCodecFormat
+	}
+	b := make([]byte, n)
+	for i := range b {
+		v, err := r.readBits(8)
+		if err != nil {
+			return "", err
+		}
+		b[i] = byte(v)
+	}
+	return string(b), nil
+}
+
+// xorState keeps the previous value of a series for XOR compression
+type xorState struct {
+	prev  uint64
+	lead  int
+	trail int
+	valid bool // true if lead and trail can be reused
+}
+
+// tsState keeps the previous timestamps for delta-of-delta compression
+type tsState struct {
+	count int
+	prev  int64
+	delta int64
+}
+
+// delta-of-delta buckets: prefix bits, prefix length, value bits
+var dodBuckets = []struct {
+	prefix uint64
+	plen   int
+	vbits  int
+}{
+	{0b10, 2, 7},
+	{0b110, 3, 9},
+	{0b1110, 4, 12},
+}
+
+// perfEncoder holds the series states during encoding
+type perfEncoder struct {
+	w      bitWriter
+	dict   map[string]uint64
+	series map[string]*xorState
+	ts     tsState
+}
+
+// perfDecoder holds the series states during decoding
+type perfDecoder struct {
+	r      bitReader
+	dict   []string
+	series map[string]*xorState
+	ts     tsState
+}
+
+// putTS writes a timestamp in delta-of-delta form
+func (e *perfEncoder) putTS(ts int64) {
+	switch e.ts.count {
+	case 0:
+		e.w.writeBits(uint64(ts), 64)
+	case 1:
+		e.ts.delta = ts - e.ts.prev
+		e.w.writeVarint(e.ts.delta)
+	default:
+		delta := ts - e.ts.prev
+		dod := delta - e.ts.delta
+		e.ts.delta = delta
+		e.putDod(dod)
+	}
+	e.ts.prev = ts
+	e.ts.count++
+}
+
+// putDod writes a delta-of-delta value
+func (e *perfEncoder) putDod(dod int64) {
+	if dod == 0 {
+		e.w.writeBit(false)
+		return
+	}
+	for _, b := range dodBuckets {
+		lim := int64(1) << (b.vbits - 1)
+		if dod >= -lim && dod < lim {
+			e.w.writeBits(b.prefix, b.plen)
+			e.w.writeBits(uint64(dod)&(1<<b.vbits-1), b.vbits)
+			return
+		}
+	}
+	e.w.writeBits(0b1111, 4)
+	e.w.writeBits(uint64(dod), 64)
+}
+
+// getTS reads a timestamp written by putTS
+func (d *perfDecoder) getTS() (int64, error) {
+	var ts int64
+	switch d.ts.count {
+	case 0:
+		v, err := d.r.readBits(64)
+		if err != nil {
+			return 0, err
+		}
+		ts = int64(v)
+	case 1:
+		delta, err := d.r.readVarint()
+		if err != nil {
+			return 0, err
+		}
+		d.ts.delta = delta
+		ts = d.ts.prev + delta
+	default:
+		dod, err := d.getDod()
+		if err != nil {
+			return 0, err
+		}
+		d.ts.delta += dod
+		ts = d.ts.prev + d.ts.delta
+	}
+	d.ts.prev = ts
+	d.ts.count++
+	return ts, nil
+}
+
+// getDod reads a delta-of-delta value written by putDod
+func (d *perfDecoder) getDod() (int64, error) {
+	var prefix uint64
+	for plen := 1; plen <= 4; plen++ {
+		b, err := d.r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		prefix <<= 1
+		if b {
+			prefix |= 1
+		}
+		if plen == 1 && !b {
+			return 0, nil
+		}
+		for _, bk := range dodBuckets {
+			if bk.plen == plen && bk.prefix == prefix {
+				v, err := d.r.readBits(bk.vbits)
+				if err != nil {
+					return 0, err
+				}
+				// sign extend
+				shift := 64 - bk.vbits
+				return int64(v<<shift) >> shift, nil
+			}
+		}
+	}
+	v, err := d.r.readBits(64)
+	return int64(v), err
+}
+
+// putValue writes a value XOR-compressed against the previous one of the
+// same series
+func (e *perfEncoder) putValue(series string, v uint64) {
+	s, ok := e.series[series]
+	if !ok {
+		e.series[series] = &xorState{prev: v}
+		e.w.writeBits(v, 64)
+		return
+	}
+	x := v ^ s.prev
+	s.prev = v
+	if x == 0 {
+		e.w.writeBit(false)
+		return
+	}
+	e.w.writeBit(true)
+	lead := bits.LeadingZeros64(x)
+	trail := bits.TrailingZeros64(x)
+	if s.valid && lead >= s.lead && trail >= s.trail {
+		e.w.writeBit(false)
+		e.w.writeBits(x>>s.trail, 64-s.lead-s.trail)
+		return
+	}
+	e.w.writeBit(true)
+	e.w.writeBits(uint64(lead), 6)
+	e.w.writeBits(uint64(64-lead-trail-1), 6)
+	e.w.writeBits(x>>trail, 64-lead-trail)
+	s.lead, s.trail, s.valid = lead, trail, true
+}
+
+// getValue reads a value written by putValue
+func (d *perfDecoder) getValue(series string) (uint64, error) {
+	s, ok := d.series[series]
+	if !ok {
+		v, err := d.r.readBits(64)
+		if err != nil {
+			return 0, err
+		}
+		d.series[series] = &xorState{prev: v}
+		return v, nil
+	}
+	changed, err := d.r.readBit()
+	if err != nil || !changed {
+		return s.prev, err
+	}
+	newWindow, err := d.r.readBit()
+	if err != nil {
+		return 0, err
+	}
+	if newWindow {
+		lead, err := d.r.readBits(6)
+		if err != nil {
+			return 0, err
+		}
+		size, err := d.r.readBits(6)
+		if err != nil {
+			return 0, err
+		}
+		s.lead = int(lead)
+		s.trail = 64 - int(lead) - int(size) - 1
+		s.valid = true
+		if s.trail < 0 {
+			return 0, ErrPerfCodecFormat
+		}
+	} else if !s.valid {
+		return 0, ErrPerfCodecFormat
+	}
+	x, err := d.r.readBits(64 - s.lead - s.trail)
+	if err != nil {
+		return 0, err
+	}
+	s.prev ^= x << s.trail
+	return s.prev, nil
+}
+
+// putF32 writes a float32 value of a series
+func (e *perfEncoder) putF32(series string, v float32) {
+	e.putValue(series, uint64(math.Float32bits(v)))
+}
+
+// getF32 reads a float32 value of a series
+func (d *perfDecoder) getF32(series string) (float32, error) {
+	v, err := d.getValue(series)
+	return math.Float32frombits(uint32(v)), err
+}
+
+// getF32s reads float32 values of several series in order
+func (d *perfDecoder) getF32s(series []string, dst ...*float32) error {
+	for i, k := range series {
+		v, err := d.getF32(k)
+		if err != nil {
+			return err
+		}
+		*dst[i] = v
+	}
+	return nil
+}
+
+// putKey writes a dictionary coded string
+func (e *perfEncoder) putKey(s string) {
+	e.w.writeUvarint(e.dict[s])
+}
+
+// getKey reads a dictionary coded string
+func (d *perfDecoder) getKey() (string, error) {
+	i, err := d.r.readUvarint()
+	if err != nil {
+		return "", err
+	}
+	if i >= uint64(len(d.dict)) {
+		return "", ErrPerfCodecFormat
+	}
+	return d.dict[i], nil
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// buildDict collects all strings to be dictionary coded
+func buildDict(tl PerfTimeline) []string {
+	set := make(map[string]struct{})
+	add := func(s string) { set[s] = struct{}{} }
+	for k, v := range tl.CInfo {
+		add(k)
+		add(v.ID)
+		add(v.Name)
+		add(v.Image)
+	}
+	for _, s := range tl.Stats {
+		for k := range s.NetIOPSec {
+			add(k)
+		}
+		for k, v := range s.DiskUsage {
+			add(k)
+			add(v.FSType)
+		}
+		for k := range s.DiskIO {
+			add(k)
+		}
+		for k := range s.Pressure {
+			add(k)
+		}
+		for k := range s.Custom {
+			add(k)
+		}
+		for k := range s.Sockets {
+			add(k)
+		}
+		for k := range s.CStat {
+			add(k)
+		}
+		for k := range s.Proc {
+			add(k)
+		}
+		for _, v := range s.CEvent {
+			add(v.ID)
+			add(v.Name)
+			add(v.Image)
+		}
+	}
+	for _, a := range tl.Annotations {
+		add(a.Type)
+	}
+	return sortedKeys(set)
+}
+
+// EncodePerfTimeline writes the compact binary form of a timeline to w
+func EncodePerfTimeline(w io.Writer, tl PerfTimeline) error {
+	dict := buildDict(tl)
+	e := &perfEncoder{
+		dict:   make(map[string]uint64, len(dict)),
+		series: make(map[string]*xorState),
+	}
+	e.w.writeVarint(tl.Interval)
+	e.w.writeUvarint(uint64(len(dict)))
+	for i, s := range dict {
+		e.dict[s] = uint64(i)
+		e.w.writeString(s)
+	}
+	e.w.writeUvarint(uint64(len(tl.CInfo)))
+	for _, k := range sortedKeys(tl.CInfo) {
+		e.putKey(k)
+		e.putCInfo(tl.CInfo[k])
+	}
+	e.w.writeUvarint(uint64(len(tl.Stats)))
+	for _, s := range tl.Stats {
+		e.putStat(s)
+	}
+	e.w.writeUvarint(uint64(len(tl.Annotations)))
+	var prev int64
+	for _, a := range tl.Annotations {
+		e.w.writeVarint(a.TS - prev)
+		e.putKey(a.Type)
+		e.w.writeString(a.Text)
+		e.w.writeString(a.TraceID)
+		prev = a.TS
+	}
+
+	if _, err := w.Write(perfCodecMagic); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte{perfCodecVersion}); err != nil {
+		return err
+	}
+	_, err := w.Write(e.w.buf)
+	return err
+}
+
+// putCInfo writes a container info
+func (e *perfEncoder) putCInfo(c ContianerInfo) {
+	e.putKey(c.ID)
+	e.putKey(c.Name)
+	e.putKey(c.Image)
+	e.w.writeBit(c.Runing)
+	e.w.writeVarint(c.FirstSeen)
+	e.w.writeVarint(c.LastSeen - c.FirstSeen)
+	e.w.writeUvarint(uint64(len(c.History)))
+	prev := c.FirstSeen
+	for _, h := range c.History {
+		e.w.writeVarint(h.TS - prev)
+		e.w.writeBit(h.Runing)
+		prev = h.TS
+	}
+}
+
+// putStat writes a single snapshot
+func (e *perfEncoder) putStat(s PerfStat) {
+	var flags uint64
+	if s.CPU != nil {
+		flags |= pcfCPU
+	}
+	if s.Mem != nil {
+		flags |= pcfMem
+	}
+	if s.NetIOPSec != nil {
+		flags |= pcfNet
+	}
+	if s.DiskUsage != nil {
+		flags |= pcfDisk
+	}
+	if s.CStat != nil {
+		flags |= pcfCStat
+	}
+	if s.CEvent != nil {
+		flags |= pcfCEvent
+	}
+	if s.Proc != nil {
+		flags |= pcfProc
+	}
+	if s.DiskIO != nil {
+		flags |= pcfDiskIO
+	}
+	if s.Load != nil {
+		flags |= pcfLoad
+	}
+	if s.Pressure != nil {
+		flags |= pcfPressure
+	}
+	if s.Custom != nil {
+		flags |= pcfCustom
+	}
+	if s.Sockets != nil {
+		flags |= pcfSockets
+	}
+	if s.UDP != nil {
+		flags |= pcfUDP
+	}
+	e.putTS(s.TS)
+	e.putValue("flags", flags)
+
+	if s.CPU != nil {
+		e.putValue("cpu.n", uint64(len(s.CPU.Core)))
+		e.putF32("cpu", s.CPU.Total)
+		for i, v := range s.CPU.Core {
+			e.putF32("cpu."+strconv.Itoa(i), v)
+		}
+		e.putF32("cpu.us", s.CPU.User)
+		e.putF32("cpu.sy", s.CPU.System)
+		e.putF32("cpu.wa", s.CPU.IOWait)
+		e.putF32("cpu.st", s.CPU.Steal)
+	}
+	if s.Mem != nil {
+		e.putValue("mem.t", s.Mem.Total)
+		e.putValue("mem.u", s.Mem.Used)
+		e.putValue("mem.a", s.Mem.Available)
+		e.putValue("mem.st", s.Mem.SwapTotal)
+		e.putValue("mem.su", s.Mem.SwapUsed)
+		e.putValue("mem.f", s.Mem.Free)
+	}
+	if s.Load != nil {
+		e.putF32("load.1", s.Load.Load1)
+		e.putF32("load.5", s.Load.Load5)
+		e.putF32("load.15", s.Load.Load15)
+	}
+	if s.Pressure != nil {
+		e.w.writeUvarint(uint64(len(s.Pressure)))
+		for _, k := range sortedKeys(s.Pressure) {
+			v := s.Pressure[k]
+			e.putKey(k)
+			e.putF32("psi.s10."+k, v.Some10)
+			e.putF32("psi.s60."+k, v.Some60)
+			e.putF32("psi.s300."+k, v.Some300)
+			e.putF32("psi.f10."+k, v.Full10)
+			e.putF32("psi.f60."+k, v.Full60)
+			e.putF32("psi.f300."+k, v.Full300)
+		}
+	}
+	if s.Custom != nil {
+		e.w.writeUvarint(uint64(len(s.Custom)))
+		for _, k := range sortedKeys(s.Custom) {
+			e.putKey(k)
+			e.putValue("custom."+k, math.Float64bits(s.Custom[k]))
+		}
+	}
+	if s.Sockets != nil {
+		e.w.writeUvarint(uint64(len(s.Sockets)))
+		for _, k := range sortedKeys(s.Sockets) {
+			v := s.Sockets[k]
+			e.putKey(k)
+			e.putValue("sock.t."+k, uint64(v.Total))
+			e.putValue("sock.l."+k, uint64(v.Listen))
+			e.putValue("sock.e."+k, uint64(v.Established))
+			e.putValue("sock.sr."+k, uint64(v.SynRecv))
+			e.putValue("sock.tw."+k, uint64(v.TimeWait))
+			e.putValue("sock.cw."+k, uint64(v.CloseWait))
+			e.putValue("sock.o."+k, uint64(v.Other))
+			e.putValue("sock.rq."+k, v.RxQueue)
+			e.putValue("sock.d."+k, v.Drops)
+		}
+	}
+	if s.UDP != nil {
+		e.putF32("udp.in", s.UDP.InDatagrams)
+		e.putF32("udp.out", s.UDP.OutDatagrams)
+		e.putF32("udp.np", s.UDP.NoPorts)
+		e.putF32("udp.ie", s.UDP.InErrors)
+		e.putF32("udp.rb", s.UDP.RcvbufErrors)
+		e.putF32("udp.sb", s.UDP.SndbufErrors)
+	}
+	if s.NetIOPSec != nil {
+		e.w.writeUvarint(uint64(len(s.NetIOPSec)))
+		for _, k := range sortedKeys(s.NetIOPSec) {
+			v := s.NetIOPSec[k]
+			e.putKey(k)
+			e.putValue("net.bs."+k, v.BytesSend)
+			e.putValue("net.br."+k, v.BytesRecv)
+			e.putValue("net.ps."+k, v.PacketsSend)
+			e.putValue("net.pr."+k, v.PacketsRecv)
+		}
+	}
+	if s.DiskUsage != nil {
+		e.w.writeUvarint(uint64(len(s.DiskUsage)))
+		for _, k := range sortedKeys(s.DiskUsage) {
+			v := s.DiskUsage[k]
+			e.putKey(k)
+			e.putValue("disk.t."+k, v.Total)
+			e.putValue("disk.u."+k, v.Used)
+			e.putValue("disk.it."+k, v.InodesTotal)
+			e.putValue("disk.iu."+k, v.InodesUsed)
+			e.putKey(v.FSType)
+		}
+	}
+	if s.DiskIO != nil {
+		e.w.writeUvarint(uint64(len(s.DiskIO)))
+		for _, k := range sortedKeys(s.DiskIO) {
+			v := s.DiskIO[k]
+			e.putKey(k)
+			e.putValue("dio.rb."+k, v.ReadBytes)
+			e.putValue("dio.wb."+k, v.WriteBytes)
+			e.putF32("dio.ri."+k, v.ReadIOPS)
+			e.putF32("dio.wi."+k, v.WriteIOPS)
+			e.putF32("dio.aw."+k, v.AwaitMs)
+			e.putF32("dio.ut."+k, v.Util)
+		}
+	}
+	if s.CStat != nil {
+		e.w.writeUvarint(uint64(len(s.CStat)))
+		for _, k := range sortedKeys(s.CStat) {
+			v := s.CStat[k]
+			e.putKey(k)
+			e.putF32("c.cpu."+k, v.CPU)
+			e.putValue("c.mem."+k, v.MemUsed)
+			e.putValue("c.lim."+k, v.MemLimit)
+			e.putValue("c.ior."+k, v.IORead)
+			e.putValue("c.iow."+k, v.IOWrite)
+		}
+	}
+	if s.CEvent != nil {
+		e.w.writeUvarint(uint64(len(s.CEvent)))
+		for _, v := range s.CEvent {
+			e.putCInfo(v)
+		}
+	}
+	if s.Proc != nil {
+		e.w.writeUvarint(uint64(len(s.Proc)))
+		for _, k := range sortedKeys(s.Proc) {
+			v := s.Proc[k]
+			e.putKey(k)
+			e.putValue("p.pid."+k, uint64(v.Pid))
+			e.putF32("p.cpu."+k, v.CPU)
+			e.putValue("p.rss."+k, v.RSS)
+			e.putValue("p.vms."+k, v.VMS)
+			e.putValue("p.thr."+k, uint64(v.Threads))
+			e.putValue("p.fds."+k, uint64(v.FDs))
+			e.putValue("p.vcs."+k, v.VolCtxSw)
+			e.putValue("p.ics."+k, v.InvolCtxSw)
+			e.putValue("p.rb."+k, v.ReadBytes)
+			e.putValue("p.wb."+k, v.WrittenBytes)
+		}
+	}
+}
+
+// DecodePerfTimeline reads a timeline written by EncodePerfTimeline
+func DecodePerfTimeline(r io.Reader) (PerfTimeline, error) {
+	var tl PerfTimeline
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return tl, err
+	}
+	if len(data) < len(perfCodecMagic)+1 ||
+		!bytes.Equal(data[:len(perfCodecMagic)], perfCodecMagic) {
+		return tl, ErrPerfCodecFormat
+	}
+	if data[len(perfCodecMagic)] != perfCodecVersion {
+		return tl, ErrPerfCodecVersion
+	}
+	d := &perfDecoder{
+		r:      bitReader{buf: data[len(perfCodecMagic)+1:]},
+		series: make(map[string]*xorState),
+	}
+	if err := d.decode(&tl); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = ErrPerfCodecFormat
+		}
+		return PerfTimeline{}, err
+	}
+	return tl, nil
+}
+
+// decode reads the whole timeline from the bit stream
+func (d *perfDecoder) decode(tl *PerfTimeline) error {
+	var err error
+	if tl.Interval, err = d.r.readVarint(); err != nil {
+		return err
+	}
+	n, err := d.getCount()
+	if err != nil {
+		return err
+	}
+	d.dict = make([]string, n)
+	for i := range d.dict {
+		if d.dict[i], err = d.r.readString(); err != nil {
+			return err
+		}
+	}
+	if n, err = d.getCount(); err != nil {
+		return err
+	}
+	tl.CInfo = make(map[string]ContianerInfo, n)
+	for i := 0; i < n; i++ {
+		k, err := d.getKey()
+		if err != nil {
+			return err
+		}
+		if tl.CInfo[k], err = d.getCInfo(); err != nil {
+			return err
+		}
+	}
+	if n, err = d.getCount(); err != nil {
+		return err
+	}
+	tl.Stats = make([]PerfStat, n)
+	for i := range tl.Stats {
+		if tl.Stats[i], err = d.getStat(); err != nil {
+			return err
+		}
+	}
+	if n, err = d.getCount(); err != nil || n == 0 {
+		return err
+	}
+	tl.Annotations = make([]Annotation, n)
+	var prev int64
+	for i := range tl.Annotations {
+		a := &tl.Annotations[i]
+		delta, err := d.r.readVarint()
+		if err != nil {
+			return err
+		}
+		a.TS = prev + delta
+		prev = a.TS
+		if a.Type, err = d.getKey(); err != nil {
+			return err
+		}
+		if a.Text, err = d.r.readString(); err != nil {
+			return err
+		}
+		if a.TraceID, err = d.r.readString(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getCount reads a count and checks it against the remaining data
+func (d *perfDecoder) getCount() (int, error) {
+	n, err := d.r.readUvarint()
+	if err != nil {
+		return 0, err
+	}
+	// every item takes at least one bit
+	if n > uint64(len(d.r.buf)*8-d.r.pos) {
+		return 0, ErrPerfCodecFormat
+	}
+	return int(n), nil
+}
+
+// getCInfo reads a container info written by putCInfo
+func (d *perfDecoder) getCInfo() (ContianerInfo, error) {
+	var c ContianerInfo
+	var err error
+	if c.ID, err = d.getKey(); err != nil {
+		return c, err
+	}
+	if c.Name, err = d.getKey(); err != nil {
+		return c, err
+	}
+	if c.Image, err = d.getKey(); err != nil {
+		return c, err
+	}
+	if c.Runing, err = d.r.readBit(); err != nil {
+		return c, err
+	}
+	if c.FirstSeen, err = d.r.readVarint(); err != nil {
+		return c, err
+	}
+	if c.LastSeen, err = d.r.readVarint(); err != nil {
+		return c, err
+	}
+	c.LastSeen += c.FirstSeen
+	n, err := d.getCount()
+	if err != nil || n == 0 {
+		return c, err
+	}
+	c.History = make([]ContainerState, n)
+	prev := c.FirstSeen
+	for i := range c.History {
+		delta, err := d.r.readVarint()
+		if err != nil {
+			return c, err
+		}
+		prev += delta
+		c.History[i].TS = prev
+		if c.History[i].Runing, err = d.r.readBit(); err != nil {
+			return c, err
+		}
+	}
+	return c, nil
+}
+
+// getStat reads a single snapshot written by putStat
+func (d *perfDecoder) getStat() (PerfStat, error) {
+	var s PerfStat
+	var err error
+	if s.TS, err = d.getTS(); err != nil {
+		return s, err
+	}
+	flags, err := d.getValue("flags")
+	if err != nil {
+		return s, err
+	}
+	if flags&^pcfAll != 0 {
+		return s, ErrPerfCodecFormat
+	}
+
+	if flags&pcfCPU != 0 {
+		n, err := d.getValue("cpu.n")
+		if err != nil {
+			return s, err
+		}
+		if n > uint64(len(d.r.buf)*8-d.r.pos) {
+			return s, ErrPerfCodecFormat
+		}
+		s.CPU = &CPUStat{Core: make([]float32, n)}
+		if s.CPU.Total, err = d.getF32("cpu"); err != nil {
+			return s, err
+		}
+		for i := range s.CPU.Core {
+			if s.CPU.Core[i], err = d.getF32("cpu." + strconv.Itoa(i)); err != nil {
+				return s, err
+			}
+		}
+		if err = d.getF32s([]string{"cpu.us", "cpu.sy", "cpu.wa", "cpu.st"},
+			&s.CPU.User, &s.CPU.System, &s.CPU.IOWait, &s.CPU.Steal,
+		); err != nil {
+			return s, err
+		}
+	}
+	if flags&pcfMem != 0 {
+		s.Mem = &MemStat{}
+		if s.Mem.Total, err = d.getValue("mem.t"); err != nil {
+			return s, err
+		}
+		if s.Mem.Used, err = d.getValue("mem.u"); err != nil {
+			return s, err
+		}
+		if s.Mem.Available, err = d.getValue("mem.a"); err != nil {
+			return s, err
+		}
+		if s.Mem.SwapTotal, err = d.getValue("mem.st"); err != nil {
+			return s, err
+		}
+		if s.Mem.SwapUsed, err = d.getValue("mem.su"); err != nil {
+			return s, err
+		}
+		if s.Mem.Free, err = d.getValue("mem.f"); err != nil {
+			return s, err
+		}
+	}
+	if flags&pcfLoad != 0 {
+		s.Load = &LoadStat{}
+		if err = d.getF32s([]string{"load.1", "load.5", "load.15"},
+			&s.Load.Load1, &s.Load.Load5, &s.Load.Load15,
+		); err != nil {
+			return s, err
+		}
+	}
+	if flags&pcfPressure != 0 {
+		n, err := d.getCount()
+		if err != nil {
+			return s, err
+		}
+		s.Pressure = make(map[string]PressureStat, n)
+		for i := 0; i < n; i++ {
+			var v PressureStat
+			k, err := d.getKey()
+			if err != nil {
+				return s, err
+			}
+			if err = d.getF32s([]string{
+				"psi.s10." + k, "psi.s60." + k, "psi.s300." + k,
+				"psi.f10." + k, "psi.f60." + k, "psi.f300." + k,
+			}, &v.Some10, &v.Some60, &v.Some300,
+				&v.Full10, &v.Full60, &v.Full300,
+			); err != nil {
+				return s, err
+			}
+			s.Pressure[k] = v
+		}
+	}
+	if flags&pcfCustom != 0 {
+		n, err := d.getCount()
+		if err != nil {
+			return s, err
+		}
+		s.Custom = make(map[string]float64, n)
+		for i := 0; i < n; i++ {
+			k, err := d.getKey()
+			if err != nil {
+				return s, err
+			}
+			v, err := d.getValue("custom." + k)
+			if err != nil {
+				return s, err
+			}
+			s.Custom[k] = math.Float64frombits(v)
+		}
+	}
+	if flags&pcfSockets != 0 {
+		n, err := d.getCount()
+		if err != nil {
+			return s, err
+		}
+		s.Sockets = make(map[string]SocketStat, n)
+		for i := 0; i < n; i++ {
+			k, err := d.getKey()
+			if err != nil {
+				return s, err
+			}
+			if s.Sockets[k], err = d.getSocketStat(k); err != nil {
+				return s, err
+			}
+		}
+	}
+	if flags&pcfUDP != 0 {
+		s.UDP = &UDPStat{}
+		if err = d.getF32s([]string{
+			"udp.in", "udp.out", "udp.np", "udp.ie", "udp.rb", "udp.sb",
+		}, &s.UDP.InDatagrams, &s.UDP.OutDatagrams, &s.UDP.NoPorts,
+			&s.UDP.InErrors, &s.UDP.RcvbufErrors, &s.UDP.SndbufErrors,
+		); err != nil {
+			return s, err
+		}
+	}
+	if flags&pcfNet != 0 {
+		n, err := d.getCount()
+		if err != nil {
+			return s, err
+		}
+		s.NetIOPSec = make(map[string]NetStat, n)
+		for i := 0; i < n; i++ {
+			var v NetStat
+			k, err := d.getKey()
+			if err != nil {
+				return s, err
+			}
+			if v.BytesSend, err = d.getValue("net.bs." + k); err != nil {
+				return s, err
+			}
+			if v.BytesRecv, err = d.getValue("net.br." + k); err != nil {
+				return s, err
+			}
+			if v.PacketsSend, err = d.getValue("net.ps." + k); err != nil {
+				return s, err
+			}
+			if v.PacketsRecv, err = d.getValue("net.pr." + k); err != nil {
+				return s, err
+			}
+			s.NetIOPSec[k] = v
+		}
+	}
+	if flags&pcfDisk != 0 {
+		n, err := d.getCount()
+		if err != nil {
+			return s, err
+		}
+		s.DiskUsage = make(map[string]DiskUsage, n)
+		for i := 0; i < n; i++ {
+			var v DiskUsage
+			k, err := d.getKey()
+			if err != nil {
+				return s, err
+			}
+			if v.Total, err = d.getValue("disk.t." + k); err != nil {
+				return s, err
+			}
+			if v.Used, err = d.getValue("disk.u." + k); err != nil {
+				return s, err
+			}
+			if v.InodesTotal, err = d.getValue("disk.it." + k); err != nil {
+				return s, err
+			}
+			if v.InodesUsed, err = d.getValue("disk.iu." + k); err != nil {
+				return s, err
+			}
+			if v.FSType, err = d.getKey(); err != nil {
+				return s, err
+			}
+			s.DiskUsage[k] = v
+		}
+	}
+	if flags&pcfDiskIO != 0 {
+		n, err := d.getCount()
+		if err != nil {
+			return s, err
+		}
+		s.DiskIO = make(map[string]DiskIOStat, n)
+		for i := 0; i < n; i++ {
+			k, err := d.getKey()
+			if err != nil {
+				return s, err
+			}
+			if s.DiskIO[k], err = d.getDiskIOStat(k); err != nil {
+				return s, err
+			}
+		}
+	}
+	if flags&pcfCStat != 0 {
+		n, err := d.getCount()
+		if err != nil {
+			return s, err
+		}
+		s.CStat = make(map[string]ContainerStat, n)
+		for i := 0; i < n; i++ {
+			var v ContainerStat
+			k, err := d.getKey()
+			if err != nil {
+				return s, err
+			}
+			if v.CPU, err = d.getF32("c.cpu." + k); err != nil {
+				return s, err
+			}
+			if v.MemUsed, err = d.getValue("c.mem." + k); err != nil {
+				return s, err
+			}
+			if v.MemLimit, err = d.getValue("c.lim." + k); err != nil {
+				return s, err
+			}
+			if v.IORead, err = d.getValue("c.ior." + k); err != nil {
+				return s, err
+			}
+			if v.IOWrite, err = d.getValue("c.iow." + k); err != nil {
+				return s, err
+			}
+			s.CStat[k] = v
+		}
+	}
+	if flags&pcfCEvent != 0 {
+		n, err := d.getCount()
+		if err != nil {
+			return s, err
+		}
+		s.CEvent = make([]ContianerInfo, n)
+		for i := range s.CEvent {
+			if s.CEvent[i], err = d.getCInfo(); err != nil {
+				return s, err
+			}
+		}
+	}
+	if flags&pcfProc != 0 {
+		n, err := d.getCount()
+		if err != nil {
+			return s, err
+		}
+		s.Proc = make(map[string]ProcStat, n)
+		for i := 0; i < n; i++ {
+			k, err := d.getKey()
+			if err != nil {
+				return s, err
+			}
+			if s.Proc[k], err = d.getProcStat(k); err != nil {
+				return s, err
+			}
+		}
+	}
+	return s, nil
+}
+
+// getDiskIOStat reads a disk I/O stat of the given key
+func (d *perfDecoder) getDiskIOStat(k string) (DiskIOStat, error) {
+	var v DiskIOStat
+	var err error
+	if v.ReadBytes, err = d.getValue("dio.rb." + k); err != nil {
+		return v, err
+	}
+	if v.WriteBytes, err = d.getValue("dio.wb." + k); err != nil {
+		return v, err
+	}
+	if v.ReadIOPS, err = d.getF32("dio.ri." + k); err != nil {
+		return v, err
+	}
+	if v.WriteIOPS, err = d.getF32("dio.wi." + k); err != nil {
+		return v, err
+	}
+	if v.AwaitMs, err = d.getF32("dio.aw." + k); err != nil {
+		return v, err
+	}
+	v.Util, err = d.getF32("dio.ut." + k)
+	return v, err
+}
+
+// getProcStat reads a process stat of the given key
+func (d *perfDecoder) getProcStat(k string) (ProcStat, error) {
+	var v ProcStat
+	var err error
+	var u [4]uint64
+	if u[0], err = d.getValue("p.pid." + k); err != nil {
+		return v, err
+	}
+	if v.CPU, err = d.getF32("p.cpu." + k); err != nil {
+		return v, err
+	}
+	if v.RSS, err = d.getValue("p.rss." + k); err != nil {
+		return v, err
+	}
+	if v.VMS, err = d.getValue("p.vms." + k); err != nil {
+		return v, err
+	}
+	if u[1], err = d.getValue("p.thr." + k); err != nil {
+		return v, err
+	}
+	if u[2], err = d.getValue("p.fds." + k); err != nil {
+		return v, err
+	}
+	if v.VolCtxSw, err = d.getValue("p.vcs." + k); err != nil {
+		return v, err
+	}
+	if v.InvolCtxSw, err = d.getValue("p.ics." + k); err != nil {
+		return v, err
+	}
+	if v.ReadBytes, err = d.getValue("p.rb." + k); err != nil {
+		return v, err
+	}
+	if v.WrittenBytes, err = d.getValue("p.wb." + k); err != nil {
+		return v, err
+	}
+	v.Pid, v.Threads, v.FDs = int(u[0]), int32(u[1]), int32(u[2])
+	return v, nil
+}
+
+// getSocketStat reads a socket stat of the given key
+func (d *perfDecoder) getSocketStat(k string) (SocketStat, error) {
+	var v SocketStat
+	var u [7]uint64
+	for i, p := range []string{"t", "l", "e", "sr", "tw", "cw", "o"} {
+		var err error
+		if u[i], err = d.getValue("sock." + p + "." + k); err != nil {
+			return v, err
+		}
+	}
+	v.Total, v.Listen, v.Established = uint32(u[0]), uint32(u[1]),
+		uint32(u[2])
+	v.SynRecv, v.TimeWait, v.CloseWait, v.Other = uint32(u[3]),
+		uint32(u[4]), uint32(u[5]), uint32(u[6])
+	var err error
+	if v.RxQueue, err = d.getValue("sock.rq." + k); err != nil {
+		return v, err
+	}
+	v.Drops, err = d.getValue("sock.d." + k)
+	return v, err
+}
@@ -0,0 +1,212 @@
+package sysinfo
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand/v2"
+	"strconv"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// genTimeline generates a timeline with per-second snapshots in descending
+// order of time, with some noise on every value.
+func genTimeline(n, cores, containers int) PerfTimeline {
+	rnd := rand.New(rand.NewPCG(1, 2))
+	tl := PerfTimeline{
+		Interval: 1000,
+		Stats:    make([]PerfStat, n),
+		CInfo:    make(map[string]ContianerInfo),
+	}
+	for c := 0; c < containers; c++ {
+		id := strconv.Itoa(c) + "f3c2a9d1e8b7"
+		tl.CInfo[id] = ContianerInfo{
+			ID: id, Name: "server-" + strconv.Itoa(c),
+			Image: "game/server:1.0", Runing: true,
+			FirstSeen: 1760000000000, LastSeen: 1760000000000 + int64(n)*1000,
+			History: []ContainerState{
+				{TS: 1760000000000, Runing: true},
+				{TS: 1760000001000, Runing: false},
+				{TS: 1760000002000, Runing: true},
+			},
+		}
+	}
+	ts := int64(1760000000000) + int64(n)*1000
+	for i := range tl.Stats {
+		// jitter of the ticker
+		ts -= 1000 + int64(rnd.IntN(3)) - 1
+		s := PerfStat{
+			TS:  ts,
+			CPU: &CPUStat{Core: make([]float32, cores)},
+			Mem: &MemStat{
+				Total:     16 << 30,
+				Used:      8<<30 + uint64(rnd.IntN(1<<20))*4096,
+				Available: 7 << 30,
+				SwapTotal: 2 << 30,
+				SwapUsed:  uint64(rnd.IntN(1<<10)) * 4096,
+				Free:      1<<30 + uint64(rnd.IntN(1<<20))*4096,
+			},
+			Load: &LoadStat{
+				Load1:  float32(rnd.IntN(800)) / 100,
+				Load5:  2.5,
+				Load15: 2.25,
+			},
+			Pressure: map[string]PressureStat{
+				"cpu":    {Some10: float32(rnd.IntN(1000)) / 100},
+				"memory": {Some10: 1.5, Full10: 0.5, Full300: 0.01},
+			},
+			Sockets: map[string]SocketStat{
+				"tcp/25565": {Total: 3 + uint32(rnd.IntN(30)), Listen: 1,
+					Established: uint32(rnd.IntN(30)), TimeWait: 2},
+				"udp/8211": {Total: 1, RxQueue: uint64(rnd.IntN(4096)),
+					Drops: 17},
+			},
+			UDP: &UDPStat{
+				InDatagrams:  float32(rnd.IntN(100000)) / 10,
+				RcvbufErrors: float32(rnd.IntN(3)),
+			},
+			Custom: map[string]float64{
+				"players":                 float64(rnd.IntN(32)),
+				`tick_rate{world="main"}`: 29.97,
+			},
+			NetIOPSec: map[string]NetStat{
+				"eth0": {
+					BytesSend:   uint64(rnd.IntN(1 << 20)),
+					BytesRecv:   uint64(rnd.IntN(1 << 20)),
+					PacketsSend: uint64(rnd.IntN(1000)),
+					PacketsRecv: uint64(rnd.IntN(1000)),
+				},
+				"lo": {},
+			},
+			DiskUsage: map[string]DiskUsage{
+				"/": {Total: 100 << 30, Used: 40 << 30,
+					InodesTotal: 6 << 20, InodesUsed: 1 << 20, FSType: "ext4"},
+				"/data": {Total: 500 << 30, Used: 123 << 30, FSType: "xfs"},
+			},
+			DiskIO: map[string]DiskIOStat{
+				"sda": {
+					ReadBytes:  uint64(rnd.IntN(1 << 24)),
+					WriteBytes: uint64(rnd.IntN(1 << 24)),
+					ReadIOPS:   float32(rnd.IntN(500)),
+					AwaitMs:    float32(rnd.IntN(2000)) / 100,
+					Util:       float32(rnd.IntN(10000)) / 100,
+				},
+			},
+			CStat: make(map[string]ContainerStat),
+			Proc: map[string]ProcStat{
+				"palworld": {
+					Pid: 4242, CPU: float32(rnd.IntN(40000)) / 100,
+					RSS: 6<<30 + uint64(rnd.IntN(1<<16))*4096, VMS: 12 << 30,
+					Threads: 64, FDs: 120, VolCtxSw: uint64(rnd.IntN(5000)),
+					ReadBytes: uint64(rnd.IntN(1 << 20)),
+				},
+			},
+		}
+		for c := range s.CPU.Core {
+			s.CPU.Core[c] = float32(rnd.IntN(10000)) / 100
+			s.CPU.Total += s.CPU.Core[c] / float32(cores)
+		}
+		s.CPU.User = s.CPU.Total * 0.7
+		s.CPU.System = s.CPU.Total * 0.2
+		s.CPU.Steal = float32(rnd.IntN(500)) / 100
+		for id := range tl.CInfo {
+			s.CStat[id] = ContainerStat{
+				CPU:      float32(rnd.IntN(10000)) / 100,
+				MemUsed:  4<<30 + uint64(rnd.IntN(1<<16))*4096,
+				MemLimit: 16 << 30,
+				IOWrite:  uint64(rnd.IntN(1 << 20)),
+			}
+		}
+		if i == n/2 {
+			s.CEvent = []ContianerInfo{tl.CInfo["0f3c2a9d1e8b7"]}
+		}
+		tl.Stats[i] = s
+	}
+	return tl
+}
+
+func TestPerfCodec(t *testing.T) {
+	Convey("Test perf timeline codec", t, func() {
+		Convey("Round trip", func() {
+			tl := genTimeline(600, 8, 3)
+			tl.Stats[10].CPU = nil
+			tl.Stats[11].NetIOPSec = nil
+			tl.Stats[12].TS += 1 << 40
+			tl.Annotations = []Annotation{
+				{TS: tl.Stats[3].TS, Type: "task_start",
+					Text: "server restarted by alice", TraceID: "0123abcd"},
+				{TS: tl.Stats[400].TS, Type: "operation",
+					Text: "backup started"},
+			}
+			buf := bytes.Buffer{}
+			So(EncodePerfTimeline(&buf, tl), ShouldBeNil)
+			js, _ := json.Marshal(tl)
+			t.Logf("json: %d bytes, binary: %d bytes", len(js), buf.Len())
+			So(buf.Len(), ShouldBeLessThan, len(js)/4)
+
+			dec, err := DecodePerfTimeline(&buf)
+			So(err, ShouldBeNil)
+			So(dec, ShouldResemble, tl)
+		})
+
+		Convey("Empty timeline", func() {
+			tl := PerfTimeline{
+				Interval: 5000,
+				Stats:    []PerfStat{},
+				CInfo:    map[string]ContianerInfo{},
+			}
+			buf := bytes.Buffer{}
+			So(EncodePerfTimeline(&buf, tl), ShouldBeNil)
+			dec, err := DecodePerfTimeline(&buf)
+			So(err, ShouldBeNil)
+			So(dec, ShouldResemble, tl)
+		})
+
+		Convey("Invalid data", func() {
+			_, err := DecodePerfTimeline(bytes.NewReader([]byte("MRP")))
+			So(err, ShouldEqual, ErrPerfCodecFormat)
+			_, err = DecodePerfTimeline(bytes.NewReader([]byte("MRPT\x09")))
+			So(err, ShouldEqual, ErrPerfCodecVersion)
+
+			buf := bytes.Buffer{}
+			So(EncodePerfTimeline(&buf, genTimeline(10, 2, 1)), ShouldBeNil)
+			data := buf.Bytes()
+			_, err = DecodePerfTimeline(bytes.NewReader(data[:len(data)/2]))
+			So(err, ShouldEqual, ErrPerfCodecFormat)
+		})
+	})
+}
+
+func BenchmarkPerfCodec(b *testing.B) {
+	tl := genTimeline(3600, 16, 4)
+	js, _ := json.Marshal(tl)
+	bin := bytes.Buffer{}
+	EncodePerfTimeline(&bin, tl)
+
+	b.Run("EncodeJSON", func(b *testing.B) {
+		b.ReportMetric(float64(len(js)), "bytes")
+		for i := 0; i < b.N; i++ {
+			json.Marshal(tl)
+		}
+	})
+	b.Run("EncodeBinary", func(b *testing.B) {
+		b.ReportMetric(float64(bin.Len()), "bytes")
+		buf := bytes.Buffer{}
+		for i := 0; i < b.N; i++ {
+			buf.Reset()
+			EncodePerfTimeline(&buf, tl)
+		}
+	})
+	b.Run("DecodeJSON", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var dec PerfTimeline
+			json.Unmarshal(js, &dec)
+		}
+	})
+	b.Run("DecodeBinary", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			DecodePerfTimeline(bytes.NewReader(bin.Bytes()))
+		}
+	})
+}
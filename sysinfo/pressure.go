@@ -0,0 +1,107 @@
+package sysinfo
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/shirou/gopsutil/cpu"
+)
+
+// LoadStat represents the load average of the system
+type LoadStat struct {
+	Load1  float32 `json:"load1"`
+	Load5  float32 `json:"load5"`
+	Load15 float32 `json:"load15"`
+}
+
+// PressureStat represents the pressure stall information (PSI) of a
+// resource. Values are the percentage of time in which some or all
+// non-idle tasks were stalled, averaged over 10, 60 and 300 seconds.
+type PressureStat struct {
+	Some10  float32 `json:"some10"`
+	Some60  float32 `json:"some60"`
+	Some300 float32 `json:"some300"`
+	Full10  float32 `json:"full10"`
+	Full60  float32 `json:"full60"`
+	Full300 float32 `json:"full300"`
+}
+
+// PressureResources lists the resources of /proc/pressure
+var PressureResources = []string{"cpu", "memory", "io"}
+
+// readPressure reads /proc/pressure/<resource>
+func readPressure(resource string) (PressureStat, error) {
+	var ret PressureStat
+	data, err := os.ReadFile(procPath("pressure", resource))
+	if err != nil {
+		return ret, err
+	}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		f := strings.Fields(sc.Text())
+		if len(f) < 4 {
+			continue
+		}
+		avg := make(map[string]float32, 3)
+		for _, kv := range f[1:] {
+			k, v, _ := strings.Cut(kv, "=")
+			avg[k] = float32(parseFloat(v))
+		}
+		switch f[0] {
+		case "some":
+			ret.Some10, ret.Some60, ret.Some300 =
+				avg["avg10"], avg["avg60"], avg["avg300"]
+		case "full":
+			ret.Full10, ret.Full60, ret.Full300 =
+				avg["avg10"], avg["avg60"], avg["avg300"]
+		}
+	}
+	return ret, nil
+}
+
+// readAllPressure reads the PSI of all resources. It returns nil without
+// error if the kernel does not support PSI, or has it disabled.
+func readAllPressure() (map[string]PressureStat, error) {
+	ret := make(map[string]PressureStat, len(PressureResources))
+	for _, r := range PressureResources {
+		p, err := readPressure(r)
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTSUP) {
+			// the cpu file is missing on older kernels, "full" of cpu
+			// is always zero, so only the absence of all matters
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		ret[r] = p
+	}
+	if len(ret) == 0 {
+		return nil, nil
+	}
+	return ret, nil
+}
+
+// setCPUBreakdown fills the user, system, iowait and steal percentages of c
+// from two samples of the overall CPU times
+func setCPUBreakdown(c *CPUStat, prev, cur cpu.TimesStat) {
+	total := cur.Total() - prev.Total()
+	if total <= 0 {
+		return
+	}
+	pct := func(c, p float64) float32 {
+		if c < p {
+			return 0
+		}
+		return float32((c - p) / total * 100)
+	}
+	c.User = pct(cur.User+cur.Nice, prev.User+prev.Nice)
+	c.System = pct(cur.System+cur.Irq+cur.Softirq,
+		prev.System+prev.Irq+prev.Softirq)
+	c.IOWait = pct(cur.Iowait, prev.Iowait)
+	c.Steal = pct(cur.Steal, prev.Steal)
+}
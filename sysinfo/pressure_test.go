@@ -0,0 +1,52 @@
+package sysinfo
+
+import (
+	"testing"
+
+	"github.com/shirou/gopsutil/cpu"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPressure(t *testing.T) {
+	Convey("Test pressure stall information", t, func() {
+		root := t.TempDir()
+		defer func(old string) { ProcfsRoot = old }(ProcfsRoot)
+		ProcfsRoot = root
+
+		Convey("Kernel without PSI", func() {
+			psi, err := readAllPressure()
+			So(err, ShouldBeNil)
+			So(psi, ShouldBeNil)
+		})
+
+		Convey("Kernel with PSI", func() {
+			writeFixture(root, "pressure/cpu",
+				"some avg10=2.00 avg60=1.89 avg300=1.92 total=17636903\n"+
+					"full avg10=0.00 avg60=0.00 avg300=0.00 total=0\n")
+			writeFixture(root, "pressure/memory",
+				"some avg10=12.50 avg60=8.00 avg300=3.25 total=2627241\n"+
+					"full avg10=4.10 avg60=2.00 avg300=0.05 total=1973243\n")
+			psi, err := readAllPressure()
+			So(err, ShouldBeNil)
+			So(psi, ShouldHaveLength, 2)
+			So(psi, ShouldNotContainKey, "io")
+			So(psi["cpu"].Some60, ShouldAlmostEqual, 1.89, 0.001)
+			So(psi["memory"], ShouldResemble, PressureStat{
+				Some10: 12.5, Some60: 8, Some300: 3.25,
+				Full10: 4.1, Full60: 2, Full300: 0.05,
+			})
+		})
+	})
+
+	Convey("Test CPU breakdown", t, func() {
+		prev := cpu.TimesStat{User: 100, System: 50, Idle: 800, Steal: 10}
+		cur := cpu.TimesStat{User: 150, Nice: 10, System: 70, Idle: 900,
+			Iowait: 10, Steal: 20}
+		var c CPUStat
+		setCPUBreakdown(&c, prev, cur)
+		So(c.User, ShouldAlmostEqual, 30, 0.001)
+		So(c.System, ShouldAlmostEqual, 10, 0.001)
+		So(c.IOWait, ShouldAlmostEqual, 5, 0.001)
+		So(c.Steal, ShouldAlmostEqual, 5, 0.001)
+	})
+}
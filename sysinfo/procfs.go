@@ -0,0 +1,54 @@
+package sysinfo
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ProcfsRoot is the mount point of the proc filesystem. It can be changed
+// to a fixture directory for testing.
+var ProcfsRoot = "/proc"
+
+// clock ticks per second of the proc filesystem (USER_HZ)
+const procClockTicks = 100
+
+// procPath joins the path elements under ProcfsRoot
+func procPath(elem ...string) string {
+	return filepath.Join(append([]string{ProcfsRoot}, elem...)...)
+}
+
+// readProcFields reads a "key: value" or "key value" formatted file, such
+// as /proc/<pid>/status or /proc/<pid>/io, into a map. Only the first field
+// of the value is kept.
+func readProcFields(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]string)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		ret[strings.TrimSuffix(fields[0], ":")] = fields[1]
+	}
+	return ret, nil
+}
+
+// parseUint parses an unsigned integer and returns 0 on error
+func parseUint(s string) uint64 {
+	v, _ := strconv.ParseUint(s, 10, 64)
+	return v
+}
+
+// parseFloat parses a float and returns 0 on error
+func parseFloat(s string) float64 {
+	v, _ := strconv.ParseFloat(s, 64)
+	return v
+}
@@ -0,0 +1,234 @@
+package sysinfo
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrProcStatFormat = errors.New("invalid /proc/<pid>/stat format")
+)
+
+// pidStat is the parsed content of /proc/<pid>/stat
+type pidStat struct {
+	comm      string // executable name
+	utime     uint64 // user time in clock ticks
+	stime     uint64 // system time in clock ticks
+	threads   int32  // number of threads
+	starttime uint64 // start time after boot in clock ticks
+	vsize     uint64 // virtual memory size in bytes
+	rss       uint64 // resident set size in pages
+}
+
+// readPidStat reads /proc/<pid>/stat
+func readPidStat(pid int) (pidStat, error) {
+	var ret pidStat
+	data, err := os.ReadFile(procPath(strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return ret, err
+	}
+	// comm is in parentheses and may contain spaces or parentheses
+	s := string(data)
+	lp := strings.IndexByte(s, '(')
+	rp := strings.LastIndexByte(s, ')')
+	if lp < 0 || rp < lp {
+		return ret, ErrProcStatFormat
+	}
+	ret.comm = s[lp+1 : rp]
+	// fields start from field 3 (state)
+	f := strings.Fields(s[rp+1:])
+	if len(f) < 22 {
+		return ret, ErrProcStatFormat
+	}
+	ret.utime = parseUint(f[11])
+	ret.stime = parseUint(f[12])
+	ret.threads = int32(parseUint(f[17]))
+	ret.starttime = parseUint(f[19])
+	ret.vsize = parseUint(f[20])
+	ret.rss = parseUint(f[21])
+	return ret, nil
+}
+
+// ProcStat represents the performance data of a process.
+// CPU is in percent of a single core, so it can exceed 100 on multi-core
+// systems. Rates are per second.
+type ProcStat struct {
+	Pid          int     `json:"pid"`
+	CPU          float32 `json:"cpu"`
+	RSS          uint64  `json:"rss"`
+	VMS          uint64  `json:"vms"`
+	Threads      int32   `json:"threads"`
+	FDs          int32   `json:"fds"`
+	VolCtxSw     uint64  `json:"vol_ctx_sw"`
+	InvolCtxSw   uint64  `json:"invol_ctx_sw"`
+	ReadBytes    uint64  `json:"read_bytes"`
+	WrittenBytes uint64  `json:"written_bytes"`
+}
+
+// ProcTargets returns the processes to be sampled, the key is the name of
+// the task or the pid in decimal.
+type ProcTargets func() map[string]int
+
+// PidTargets returns ProcTargets of fixed pids keyed by the pid itself.
+func PidTargets(pids ...int) ProcTargets {
+	return func() map[string]int {
+		ret := make(map[string]int, len(pids))
+		for _, pid := range pids {
+			ret[strconv.Itoa(pid)] = pid
+		}
+		return ret
+	}
+}
+
+// maxCommLen is the length the kernel truncates executable names to
+const maxCommLen = 15
+
+// NameTargets returns ProcTargets of the processes whose executable name,
+// as in /proc/<pid>/comm, is one of names. Processes are looked up under
+// ProcfsRoot on each call, so restarted processes are followed. Names are
+// truncated like the kernel does. A process is keyed by its name, or by
+// name/pid if several processes share the name.
+func NameTargets(names ...string) ProcTargets {
+	want := make(map[string]string, len(names))
+	for _, name := range names {
+		comm := name
+		if len(comm) > maxCommLen {
+			comm = comm[:maxCommLen]
+		}
+		want[comm] = name
+	}
+	return func() map[string]int {
+		ret := make(map[string]int)
+		if len(want) == 0 {
+			return ret
+		}
+		dirs, err := os.ReadDir(ProcfsRoot)
+		if err != nil {
+			return ret
+		}
+		found := make(map[string][]int)
+		for _, d := range dirs {
+			pid, err := strconv.Atoi(d.Name())
+			if err != nil {
+				continue
+			}
+			// processes can exit while listing
+			st, err := readPidStat(pid)
+			if err != nil {
+				continue
+			}
+			if name, ok := want[st.comm]; ok {
+				found[name] = append(found[name], pid)
+			}
+		}
+		for name, pids := range found {
+			if len(pids) == 1 {
+				ret[name] = pids[0]
+				continue
+			}
+			for _, pid := range pids {
+				ret[fmt.Sprintf("%s/%d", name, pid)] = pid
+			}
+		}
+		return ret
+	}
+}
+
+// procCounters keeps the cumulative counters of a process for rates
+type procCounters struct {
+	ts        time.Time
+	starttime uint64 // to detect pid reuse
+	cpuTicks  uint64
+	volCtxSw  uint64
+	invCtxSw  uint64
+	readBytes uint64
+	writBytes uint64
+}
+
+// procSampler samples the processes returned by targets
+type procSampler struct {
+	targets ProcTargets
+	last    map[int]procCounters
+}
+
+// NewProcSampler creates a Sampler which fills PerfStat.Proc with the
+// processes returned by targets.
+func NewProcSampler(targets ProcTargets) Sampler {
+	return &procSampler{
+		targets: targets,
+		last:    make(map[int]procCounters),
+	}
+}
+
+// Sample implements Sampler
+func (s *procSampler) Sample(stat *PerfStat) error {
+	now := sampleTime(stat)
+	ret := make(map[string]ProcStat)
+	last := make(map[int]procCounters)
+	var errs []error
+	for name, pid := range s.targets() {
+		ps, cnt, err := readProcStat(pid)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("process %s(%d): %w", name, pid, err))
+			continue
+		}
+		cnt.ts = now
+		if p, ok := s.last[pid]; ok && p.starttime == cnt.starttime {
+			sec := now.Sub(p.ts).Seconds()
+			rate := func(c, p uint64) uint64 {
+				if c < p || sec <= 0 {
+					return 0
+				}
+				return uint64(float64(c-p) / sec)
+			}
+			if sec > 0 && cnt.cpuTicks >= p.cpuTicks {
+				ps.CPU = float32(float64(cnt.cpuTicks-p.cpuTicks) /
+					procClockTicks / sec * 100)
+			}
+			ps.VolCtxSw = rate(cnt.volCtxSw, p.volCtxSw)
+			ps.InvolCtxSw = rate(cnt.invCtxSw, p.invCtxSw)
+			ps.ReadBytes = rate(cnt.readBytes, p.readBytes)
+			ps.WrittenBytes = rate(cnt.writBytes, p.writBytes)
+		}
+		last[pid] = cnt
+		ret[name] = ps
+	}
+	s.last = last
+	stat.Proc = ret
+	return errors.Join(errs...)
+}
+
+// readProcStat reads the gauges and cumulative counters of a process
+func readProcStat(pid int) (ProcStat, procCounters, error) {
+	ps := ProcStat{Pid: pid}
+	var cnt procCounters
+	st, err := readPidStat(pid)
+	if err != nil {
+		return ps, cnt, err
+	}
+	cnt.starttime = st.starttime
+	cnt.cpuTicks = st.utime + st.stime
+	ps.Threads = st.threads
+	ps.VMS = st.vsize
+	ps.RSS = st.rss * uint64(os.Getpagesize())
+
+	dir := strconv.Itoa(pid)
+	if status, err := readProcFields(procPath(dir, "status")); err == nil {
+		cnt.volCtxSw = parseUint(status["voluntary_ctxt_switches"])
+		cnt.invCtxSw = parseUint(status["nonvoluntary_ctxt_switches"])
+	}
+	// io and fd need the same user or CAP_SYS_PTRACE, leave them zero
+	// if not permitted
+	if io, err := readProcFields(procPath(dir, "io")); err == nil {
+		cnt.readBytes = parseUint(io["read_bytes"])
+		cnt.writBytes = parseUint(io["write_bytes"])
+	}
+	if fds, err := os.ReadDir(procPath(dir, "fd")); err == nil {
+		ps.FDs = int32(len(fds))
+	}
+	return ps, cnt, nil
+}
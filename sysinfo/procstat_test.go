@@ -0,0 +1,103 @@
+package sysinfo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// writeFixture writes a file under the fixture root, creating directories
+func writeFixture(root, name, content string) {
+	p := filepath.Join(root, name)
+	os.MkdirAll(filepath.Dir(p), 0o755)
+	os.WriteFile(p, []byte(content), 0o644)
+}
+
+// writePidFixture writes the proc files of a fake process
+func writePidFixture(root string, pid int, ticks, ctxsw, rbytes uint64) {
+	dir := fmt.Sprint(pid)
+	writeFixture(root, dir+"/stat", fmt.Sprintf(
+		"%d (Pal Server (x)) S 1 %d %d 0 -1 4194560 100 0 0 0 %d %d 0 0 "+
+			"20 0 12 0 5000 1073741824 2048 18446744073709551615 0 0 0 0 0 "+
+			"0 0 0 0 0 0 0 17 0 0 0 0 0 0", pid, pid, pid, ticks, ticks))
+	writeFixture(root, dir+"/status", fmt.Sprintf(
+		"Name:\tPalServer\nThreads:\t12\nvoluntary_ctxt_switches:\t%d\n"+
+			"nonvoluntary_ctxt_switches:\t%d\n", ctxsw, ctxsw/2))
+	writeFixture(root, dir+"/io", fmt.Sprintf(
+		"rchar: 1\nwchar: 1\nread_bytes: %d\nwrite_bytes: %d\n",
+		rbytes, rbytes*2))
+	for i := 0; i < 3; i++ {
+		writeFixture(root, fmt.Sprintf("%s/fd/%d", dir, i), "")
+	}
+}
+
+func TestProcSampler(t *testing.T) {
+	Convey("Test process sampler", t, func() {
+		root := t.TempDir()
+		defer func(old string) { ProcfsRoot = old }(ProcfsRoot)
+		ProcfsRoot = root
+
+		writePidFixture(root, 42, 100, 1000, 4096)
+		s := NewProcSampler(func() map[string]int {
+			return map[string]int{"palworld": 42, "gone": 43}
+		})
+		stat := PerfStat{TS: 1760000000000}
+		err := s.Sample(&stat)
+		So(err, ShouldNotBeNil)
+		So(stat.Proc, ShouldContainKey, "palworld")
+		So(stat.Proc, ShouldNotContainKey, "gone")
+		ps := stat.Proc["palworld"]
+		So(ps.Pid, ShouldEqual, 42)
+		So(ps.Threads, ShouldEqual, 12)
+		So(ps.VMS, ShouldEqual, 1<<30)
+		So(ps.RSS, ShouldEqual, 2048*uint64(os.Getpagesize()))
+		So(ps.FDs, ShouldEqual, 3)
+		So(ps.CPU, ShouldEqual, 0)
+
+		// rates are computed by the time of sampling
+		writePidFixture(root, 42, 200, 1400, 8192)
+		stat = PerfStat{TS: 1760000002000}
+		s.Sample(&stat)
+		ps = stat.Proc["palworld"]
+		So(ps.CPU, ShouldAlmostEqual, 100, 1)
+		So(ps.VolCtxSw, ShouldAlmostEqual, 200, 1)
+		So(ps.InvolCtxSw, ShouldAlmostEqual, 100, 1)
+		So(ps.ReadBytes, ShouldAlmostEqual, 2048, 2)
+		So(ps.WrittenBytes, ShouldAlmostEqual, 4096, 4)
+	})
+}
+
+func TestNameTargets(t *testing.T) {
+	Convey("Test process targets by name", t, func() {
+		root := t.TempDir()
+		defer func(old string) { ProcfsRoot = old }(ProcfsRoot)
+		ProcfsRoot = root
+		comm := func(pid int, name string) {
+			writeFixture(root, fmt.Sprintf("%d/stat", pid), fmt.Sprintf(
+				"%d (%s) S 1 1 1 0 -1 0 0 0 0 0 1 1 0 0 20 0 1 0 5000 "+
+					"4096 1 0 0 0 0 0 0 0 0 0 0 0 0 17 0 0 0 0 0 0", pid, name))
+		}
+		comm(42, "PalServer-Linux")
+		comm(43, "sshd")
+		comm(44, "sshd")
+		comm(45, "backup")
+		writeFixture(root, "self/stat", "")
+		writeFixture(root, "meminfo", "")
+
+		So(NameTargets()(), ShouldBeEmpty)
+		targets := NameTargets("PalServer-Linux-Shipping", "sshd", "missing")
+		So(targets(), ShouldResemble, map[string]int{
+			"PalServer-Linux-Shipping": 42,
+			"sshd/43":                  43,
+			"sshd/44":                  44,
+		})
+
+		// restarted processes are followed
+		So(os.RemoveAll(filepath.Join(root, "42")), ShouldBeNil)
+		comm(50, "PalServer-Linux")
+		So(targets()["PalServer-Linux-Shipping"], ShouldEqual, 50)
+	})
+}
@@ -0,0 +1,192 @@
+package sysinfo
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+)
+
+var (
+	ErrPerfTimelineExists   = errors.New("perf timeline already exists")
+	ErrPerfTimelineNotFound = errors.New("perf timeline not found")
+	ErrPerfTimelineInterval = errors.New("invalid perf timeline interval")
+	ErrPerfTimelineCapacity = errors.New("invalid perf timeline capacity")
+)
+
+// PerfTimelineInfo describes a timeline of a PerfTimelineRegistry
+type PerfTimelineInfo struct {
+	Name     string `json:"name"`
+	Interval int64  `json:"interval"` // milliseconds
+	Capacity int    `json:"capacity"` // number of snapshots retained
+}
+
+// registryEntry is a timeline owned by a PerfTimelineRegistry
+type registryEntry struct {
+	info   PerfTimelineInfo
+	mgr    PerfTimelineMgr
+	cancel context.CancelFunc
+}
+
+// PerfTimelineRegistry owns named PerfTimelineMgr, such as one for the host
+// and one per game server instance, each with its own interval and
+// retention. All timelines are closed when the context of the registry is
+// done.
+type PerfTimelineRegistry struct {
+	ctx   context.Context
+	clock Clock
+
+	mtx  sync.RWMutex
+	mgrs map[string]registryEntry
+}
+
+// NewPerfTimelineRegistry creates a PerfTimelineRegistry whose timelines
+// are driven by the clock, SystemClock is used if clock is nil
+func NewPerfTimelineRegistry(
+	ctx context.Context,
+	clock Clock,
+) *PerfTimelineRegistry {
+	if clock == nil {
+		clock = SystemClock
+	}
+	return &PerfTimelineRegistry{
+		ctx:   ctx,
+		clock: clock,
+		mgrs:  make(map[string]registryEntry),
+	}
+}
+
+// Create creates a named timeline, it fails if the name is taken or the
+// interval or capacity is not positive
+func (r *PerfTimelineRegistry) Create(
+	name string,
+	interval int64,
+	capacity int,
+	init PerfStat,
+) (PerfTimelineMgr, error) {
+	if err := checkTimelineParams(interval, capacity); err != nil {
+		return nil, err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if _, ok := r.mgrs[name]; ok {
+		return nil, ErrPerfTimelineExists
+	}
+	return r.create(name, interval, capacity, init), nil
+}
+
+// GetOrCreate returns the named timeline, it is created with the given
+// parameters if it does not exist. It fails if the interval or capacity is
+// not positive.
+func (r *PerfTimelineRegistry) GetOrCreate(
+	name string,
+	interval int64,
+	capacity int,
+	init PerfStat,
+) (PerfTimelineMgr, error) {
+	if err := checkTimelineParams(interval, capacity); err != nil {
+		return nil, err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if e, ok := r.mgrs[name]; ok {
+		return e.mgr, nil
+	}
+	return r.create(name, interval, capacity, init), nil
+}
+
+// checkTimelineParams validates the parameters of a new timeline, which
+// would otherwise panic in the ticker or the ring
+func checkTimelineParams(interval int64, capacity int) error {
+	if interval <= 0 {
+		return ErrPerfTimelineInterval
+	}
+	if capacity <= 0 {
+		return ErrPerfTimelineCapacity
+	}
+	return nil
+}
+
+// create creates a timeline with the lock held
+func (r *PerfTimelineRegistry) create(
+	name string,
+	interval int64,
+	capacity int,
+	init PerfStat,
+) PerfTimelineMgr {
+	ctx, cancel := context.WithCancel(r.ctx)
+	e := registryEntry{
+		info: PerfTimelineInfo{
+			Name: name, Interval: interval, Capacity: capacity,
+		},
+		mgr: CreatePerfTimelineMgrWithClock(ctx, interval, capacity, init,
+			r.clock),
+		cancel: cancel,
+	}
+	r.mgrs[name] = e
+	return e.mgr
+}
+
+// Get returns the named timeline
+func (r *PerfTimelineRegistry) Get(name string) (PerfTimelineMgr, bool) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	e, ok := r.mgrs[name]
+	return e.mgr, ok
+}
+
+// Close closes the named timeline and removes it from the registry.
+// Samplers updating it stop with ErrPerfTimelineMgrClosed.
+func (r *PerfTimelineRegistry) Close(name string) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	e, ok := r.mgrs[name]
+	if !ok {
+		return ErrPerfTimelineNotFound
+	}
+	e.cancel()
+	delete(r.mgrs, name)
+	return nil
+}
+
+// List returns the info of all timelines ordered by name
+func (r *PerfTimelineRegistry) List() []PerfTimelineInfo {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	ret := make([]PerfTimelineInfo, 0, len(r.mgrs))
+	for _, e := range r.mgrs {
+		ret = append(ret, e.info)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
+
+// Export exports the named timelines, or all timelines if no name is
+// given. It fails if any of the names is not found.
+func (r *PerfTimelineRegistry) Export(
+	names ...string,
+) (map[string]PerfTimeline, error) {
+	r.mtx.RLock()
+	mgrs := make(map[string]PerfTimelineMgr)
+	if len(names) == 0 {
+		for name, e := range r.mgrs {
+			mgrs[name] = e.mgr
+		}
+	}
+	for _, name := range names {
+		e, ok := r.mgrs[name]
+		if !ok {
+			r.mtx.RUnlock()
+			return nil, ErrPerfTimelineNotFound
+		}
+		mgrs[name] = e.mgr
+	}
+	r.mtx.RUnlock()
+
+	// export without the lock of the registry
+	ret := make(map[string]PerfTimeline, len(mgrs))
+	for name, mgr := range mgrs {
+		ret[name] = mgr.Export()
+	}
+	return ret, nil
+}
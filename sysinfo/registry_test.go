@@ -0,0 +1,78 @@
+package sysinfo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPerfTimelineRegistry(t *testing.T) {
+	Convey("Test perf timeline registry", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		clock := NewManualClock(time.UnixMilli(1760000000000))
+		reg := NewPerfTimelineRegistry(ctx, clock)
+
+		host, err := reg.Create("host", 1000, 10, PerfStat{})
+		So(err, ShouldBeNil)
+		_, err = reg.Create("host", 5000, 10, PerfStat{})
+		So(err, ShouldEqual, ErrPerfTimelineExists)
+		pal, err := reg.GetOrCreate("palworld", 5000, 2, PerfStat{
+			Load: &LoadStat{Load1: 2},
+		})
+		So(err, ShouldBeNil)
+		mgr, err := reg.GetOrCreate("palworld", 1000, 1, PerfStat{})
+		So(err, ShouldBeNil)
+		So(mgr, ShouldEqual, pal)
+
+		// bad parameters would divide by zero or panic in the ticker
+		_, err = reg.Create("bad", 0, 10, PerfStat{})
+		So(err, ShouldEqual, ErrPerfTimelineInterval)
+		_, err = reg.Create("bad", 1000, 0, PerfStat{})
+		So(err, ShouldEqual, ErrPerfTimelineCapacity)
+		_, err = reg.GetOrCreate("bad", -1000, 10, PerfStat{})
+		So(err, ShouldEqual, ErrPerfTimelineInterval)
+		_, err = reg.GetOrCreate("bad", 1000, -1, PerfStat{})
+		So(err, ShouldEqual, ErrPerfTimelineCapacity)
+		_, ok := reg.Get("bad")
+		So(ok, ShouldBeFalse)
+
+		mgr, ok = reg.Get("host")
+		So(ok, ShouldBeTrue)
+		So(mgr, ShouldEqual, host)
+		So(reg.List(), ShouldResemble, []PerfTimelineInfo{
+			{Name: "host", Interval: 1000, Capacity: 10},
+			{Name: "palworld", Interval: 5000, Capacity: 2},
+		})
+
+		// each timeline ticks on its own interval
+		clock.Advance(5 * time.Second)
+		deadline := time.Now().Add(5 * time.Second)
+		for (host.CountStats() == 0 || pal.CountStats() == 0) &&
+			time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		tls, err := reg.Export()
+		So(err, ShouldBeNil)
+		So(tls, ShouldHaveLength, 2)
+		So(tls["palworld"].Interval, ShouldEqual, 5000)
+		So(tls["palworld"].Stats[0].Load.Load1, ShouldEqual, 2)
+
+		tls, err = reg.Export("palworld")
+		So(err, ShouldBeNil)
+		So(tls, ShouldHaveLength, 1)
+		_, err = reg.Export("palworld", "minecraft")
+		So(err, ShouldEqual, ErrPerfTimelineNotFound)
+
+		So(reg.Close("palworld"), ShouldBeNil)
+		So(pal.Active(), ShouldBeFalse)
+		So(reg.Close("palworld"), ShouldEqual, ErrPerfTimelineNotFound)
+		_, ok = reg.Get("palworld")
+		So(ok, ShouldBeFalse)
+
+		cancel()
+		So(host.Active(), ShouldBeFalse)
+	})
+}
@@ -0,0 +1,85 @@
+package sysinfo
+
+import (
+	"math"
+	"time"
+)
+
+// ReplayTimeline feeds a recorded timeline, such as a decoded export, into
+// a manager created by CreateManualPerfTimelineMgr with the clock. For each
+// recorded snapshot in order of time, the clock is set to its timestamp,
+// the manager is updated with its data and a snapshot is taken, so that the
+// manager ends up with the same snapshots as recorded, and downstream code
+// observes them as if they were sampled live. As with Update, a section
+// missing from a snapshot keeps its previous value.
+// Containers running at the start of the timeline and annotations are
+// replayed as well.
+func ReplayTimeline(
+	mgr PerfTimelineMgr,
+	clock *ManualClock,
+	tl PerfTimeline,
+) error {
+	if len(tl.Stats) == 0 {
+		return nil
+	}
+	// annotations in ascending order
+	annots := make([]Annotation, len(tl.Annotations))
+	for i, a := range tl.Annotations {
+		annots[len(annots)-1-i] = a
+	}
+	annotate := func(until int64) error {
+		for len(annots) > 0 && annots[0].TS <= until {
+			if err := mgr.Annotate(annots[0]); err != nil {
+				return err
+			}
+			annots = annots[1:]
+		}
+		return nil
+	}
+
+	first := tl.Stats[len(tl.Stats)-1].TS
+	seed := runningAt(tl.CInfo, first)
+	for i := len(tl.Stats) - 1; i >= 0; i-- {
+		stat := tl.Stats[i]
+		if seed != nil {
+			stat.CEvent = append(seed, stat.CEvent...)
+			seed = nil
+		}
+		clock.Set(time.UnixMilli(stat.TS))
+		if err := mgr.Update(stat); err != nil {
+			return err
+		}
+		if err := annotate(stat.TS); err != nil {
+			return err
+		}
+		if err := mgr.Snapshot(); err != nil {
+			return err
+		}
+	}
+	// annotations after the last snapshot
+	return annotate(math.MaxInt64)
+}
+
+// runningAt returns the containers running at the given time as events
+func runningAt(cinfo map[string]ContianerInfo, ts int64) []ContianerInfo {
+	var ret []ContianerInfo
+	for _, info := range cinfo {
+		running := info.Runing
+		if len(info.History) > 0 {
+			if info.History[0].TS > ts {
+				continue // appears later by its events
+			}
+			for _, h := range info.History {
+				if h.TS <= ts {
+					running = h.Runing
+				}
+			}
+		}
+		if running {
+			ret = append(ret, ContianerInfo{
+				ID: info.ID, Name: info.Name, Image: info.Image, Runing: true,
+			})
+		}
+	}
+	return ret
+}
@@ -0,0 +1,204 @@
+package sysinfo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/load"
+	"github.com/shirou/gopsutil/mem"
+	"github.com/shirou/gopsutil/net"
+)
+
+// Sampler fills a part of a PerfStat snapshot.
+// A sampler only sets the sections it is responsible for, and leaves the
+// others untouched, so that several samplers can share one snapshot.
+// If stat.TS is set, it is the time of sampling and rates are computed by
+// it, otherwise by the system time.
+type Sampler interface {
+	Sample(stat *PerfStat) error
+}
+
+// sampleTime returns the time of sampling of a snapshot
+func sampleTime(stat *PerfStat) time.Time {
+	if stat.TS != 0 {
+		return time.UnixMilli(stat.TS)
+	}
+	return time.Now()
+}
+
+// hostSampler samples CPU, memory, network, load and pressure of the host.
+type hostSampler struct {
+	lastTs  time.Time                     // time of the last network sample
+	lastNet map[string]net.IOCountersStat // last network counters
+	lastCPU *cpu.TimesStat                // last overall CPU times
+}
+
+// NewHostSampler creates a Sampler for CPU, memory, network, load and
+// pressure of the host. Pressure is left nil on kernels without PSI.
+func NewHostSampler() Sampler {
+	return &hostSampler{}
+}
+
+// Sample implements Sampler
+func (s *hostSampler) Sample(stat *PerfStat) error {
+	var errs []error
+	if cores, err := cpu.Percent(0, true); err != nil {
+		errs = append(errs, err)
+	} else {
+		c := &CPUStat{Core: make([]float32, len(cores))}
+		for i, v := range cores {
+			c.Core[i] = float32(v)
+			c.Total += float32(v)
+		}
+		if len(cores) > 0 {
+			c.Total /= float32(len(cores))
+		}
+		if times, err := cpu.Times(false); err != nil {
+			errs = append(errs, err)
+		} else if len(times) > 0 {
+			if s.lastCPU != nil {
+				setCPUBreakdown(c, *s.lastCPU, times[0])
+			}
+			s.lastCPU = &times[0]
+		}
+		stat.CPU = c
+	}
+
+	if vm, err := mem.VirtualMemory(); err != nil {
+		errs = append(errs, err)
+	} else {
+		stat.Mem = &MemStat{
+			Total:     vm.Total,
+			Used:      vm.Used,
+			Available: vm.Available,
+			Free:      vm.Free,
+		}
+		if sw, err := mem.SwapMemory(); err != nil {
+			errs = append(errs, err)
+		} else {
+			stat.Mem.SwapTotal = sw.Total
+			stat.Mem.SwapUsed = sw.Used
+		}
+	}
+
+	if avg, err := load.Avg(); err != nil {
+		errs = append(errs, err)
+	} else {
+		stat.Load = &LoadStat{
+			Load1:  float32(avg.Load1),
+			Load5:  float32(avg.Load5),
+			Load15: float32(avg.Load15),
+		}
+	}
+
+	if psi, err := readAllPressure(); err != nil {
+		errs = append(errs, err)
+	} else if psi != nil {
+		stat.Pressure = psi
+	}
+
+	if nics, err := net.IOCounters(true); err != nil {
+		errs = append(errs, err)
+	} else {
+		now := sampleTime(stat)
+		cur := make(map[string]net.IOCountersStat, len(nics))
+		for _, v := range nics {
+			cur[v.Name] = v
+		}
+		if s.lastNet != nil {
+			stat.NetIOPSec = netRates(s.lastNet, cur, now.Sub(s.lastTs))
+		}
+		s.lastNet = cur
+		s.lastTs = now
+	}
+	return errors.Join(errs...)
+}
+
+// netRates calculates per second rates between two network counter samples
+func netRates(
+	prev, cur map[string]net.IOCountersStat,
+	elapsed time.Duration,
+) map[string]NetStat {
+	ret := make(map[string]NetStat, len(cur))
+	sec := elapsed.Seconds()
+	if sec <= 0 {
+		return ret
+	}
+	rate := func(c, p uint64) uint64 {
+		if c < p {
+			return 0 // counter reset
+		}
+		return uint64(float64(c-p) / sec)
+	}
+	for k, c := range cur {
+		p, ok := prev[k]
+		if !ok {
+			continue
+		}
+		ret[k] = NetStat{
+			BytesSend:   rate(c.BytesSent, p.BytesSent),
+			BytesRecv:   rate(c.BytesRecv, p.BytesRecv),
+			PacketsSend: rate(c.PacketsSent, p.PacketsSent),
+			PacketsRecv: rate(c.PacketsRecv, p.PacketsRecv),
+		}
+	}
+	return ret
+}
+
+// RunSamplers runs the samplers every interval and updates the manager with
+// the merged result, until the context is done or the manager is closed.
+// Sampling errors are reported to onError if it is not nil.
+func RunSamplers(
+	ctx context.Context,
+	mgr PerfTimelineMgr,
+	interval time.Duration,
+	onError func(error),
+	samplers ...Sampler,
+) {
+	RunSamplersWithClock(ctx, mgr, interval, SystemClock, onError,
+		samplers...)
+}
+
+// RunSamplersWithClock is RunSamplers driven by the clock, which ticks the
+// samplers and gives the time of sampling for rates. SystemClock is used
+// if clock is nil.
+func RunSamplersWithClock(
+	ctx context.Context,
+	mgr PerfTimelineMgr,
+	interval time.Duration,
+	clock Clock,
+	onError func(error),
+	samplers ...Sampler,
+) {
+	if clock == nil {
+		clock = SystemClock
+	}
+	sample := func() error {
+		// the time is only used by the samplers, the manager stamps the
+		// snapshots itself
+		stat := PerfStat{TS: clock.Now().UnixMilli()}
+		for _, s := range samplers {
+			if err := s.Sample(&stat); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+		return mgr.Update(stat)
+	}
+	if sample() != nil {
+		return
+	}
+	ticker := clock.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			if sample() != nil {
+				return
+			}
+		}
+	}
+}
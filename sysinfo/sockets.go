@@ -0,0 +1,239 @@
+package sysinfo
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrSocketPort = errors.New("invalid socket port, expect tcp/<port> or udp/<port>")
+)
+
+// SocketPort is a local port to watch sockets on
+type SocketPort struct {
+	Proto string // "tcp" or "udp"
+	Port  uint16
+}
+
+// String returns the port as "tcp/25565", which is the key of the port in
+// PerfStat.Sockets
+func (p SocketPort) String() string {
+	return p.Proto + "/" + strconv.Itoa(int(p.Port))
+}
+
+// ParseSocketPort parses a port given as "tcp/25565" or "udp/8211"
+func ParseSocketPort(s string) (SocketPort, error) {
+	proto, port, ok := strings.Cut(s, "/")
+	if !ok || (proto != "tcp" && proto != "udp") {
+		return SocketPort{}, fmt.Errorf("%w: %q", ErrSocketPort, s)
+	}
+	n, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return SocketPort{}, fmt.Errorf("%w: %q", ErrSocketPort, s)
+	}
+	return SocketPort{Proto: proto, Port: uint16(n)}, nil
+}
+
+// SocketStat is the sockets bound to a local port, over IPv4 and IPv6.
+// The TCP states are only counted for TCP ports.
+type SocketStat struct {
+	Total       uint32 `json:"total"`
+	Listen      uint32 `json:"listen,omitempty"`
+	Established uint32 `json:"established,omitempty"`
+	SynRecv     uint32 `json:"syn_recv,omitempty"`
+	TimeWait    uint32 `json:"time_wait,omitempty"`
+	CloseWait   uint32 `json:"close_wait,omitempty"`
+	Other       uint32 `json:"other,omitempty"` // other TCP states
+	// RxQueue is the bytes waiting in the receive queues
+	RxQueue uint64 `json:"rx_queue"`
+	// Drops is the datagrams dropped by the UDP sockets since they are
+	// created
+	Drops uint64 `json:"drops,omitempty"`
+}
+
+// UDPStat is the UDP datagrams and errors of the host per second, from
+// /proc/net/snmp
+type UDPStat struct {
+	InDatagrams  float32 `json:"in_datagrams"`
+	OutDatagrams float32 `json:"out_datagrams"`
+	NoPorts      float32 `json:"no_ports"`
+	InErrors     float32 `json:"in_errors"`
+	RcvbufErrors float32 `json:"rcvbuf_errors"`
+	SndbufErrors float32 `json:"sndbuf_errors"`
+}
+
+// TCP states of /proc/net/tcp
+const (
+	tcpEstablished = 0x01
+	tcpSynRecv     = 0x03
+	tcpTimeWait    = 0x06
+	tcpCloseWait   = 0x08
+	tcpListen      = 0x0a
+)
+
+// readNetSockets adds the sockets of the watched ports in a file of
+// /proc/net, such as tcp6. The file may not exist without IPv6.
+func readNetSockets(
+	name string,
+	watch map[SocketPort]bool,
+	ret map[string]SocketStat,
+) error {
+	data, err := os.ReadFile(procPath("net", name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	proto := strings.TrimSuffix(name, "6")
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Scan() // header
+	for sc.Scan() {
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when
+		// retrnsmt uid timeout inode ref pointer drops
+		f := strings.Fields(sc.Text())
+		if len(f) < 10 {
+			continue
+		}
+		_, hexPort, _ := strings.Cut(f[1], ":")
+		port, err := strconv.ParseUint(hexPort, 16, 16)
+		if err != nil {
+			continue
+		}
+		p := SocketPort{Proto: proto, Port: uint16(port)}
+		if !watch[p] {
+			continue
+		}
+		s := ret[p.String()]
+		s.Total++
+		if _, rx, ok := strings.Cut(f[4], ":"); ok {
+			q, _ := strconv.ParseUint(rx, 16, 64)
+			s.RxQueue += q
+		}
+		if proto == "udp" {
+			if len(f) > 12 {
+				s.Drops += parseUint(f[12])
+			}
+			ret[p.String()] = s
+			continue
+		}
+		st, _ := strconv.ParseUint(f[3], 16, 8)
+		switch st {
+		case tcpListen:
+			s.Listen++
+		case tcpEstablished:
+			s.Established++
+		case tcpSynRecv:
+			s.SynRecv++
+		case tcpTimeWait:
+			s.TimeWait++
+		case tcpCloseWait:
+			s.CloseWait++
+		default:
+			s.Other++
+		}
+		ret[p.String()] = s
+	}
+	return nil
+}
+
+// readSnmpUDP reads the cumulative UDP counters of /proc/net/snmp
+func readSnmpUDP() (map[string]uint64, error) {
+	data, err := os.ReadFile(procPath("net", "snmp"))
+	if err != nil {
+		return nil, err
+	}
+	// a header line of names is followed by a line of values
+	var names []string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		f := strings.Fields(sc.Text())
+		if len(f) == 0 || f[0] != "Udp:" {
+			continue
+		}
+		if names == nil {
+			names = f[1:]
+			continue
+		}
+		ret := make(map[string]uint64, len(names))
+		for i, v := range f[1:] {
+			if i < len(names) {
+				ret[names[i]] = parseUint(v)
+			}
+		}
+		return ret, nil
+	}
+	return nil, fmt.Errorf("no Udp counters in %s", procPath("net", "snmp"))
+}
+
+// socketSampler samples the sockets of the watched ports
+type socketSampler struct {
+	ports   []SocketPort
+	watch   map[SocketPort]bool
+	lastTs  time.Time
+	lastUDP map[string]uint64
+}
+
+// NewSocketSampler creates a Sampler which fills PerfStat.Sockets with the
+// sockets of the watched ports, such as the player connections of a game
+// server, and PerfStat.UDP with the UDP errors of the host.
+func NewSocketSampler(ports ...SocketPort) Sampler {
+	s := &socketSampler{
+		ports: ports,
+		watch: make(map[SocketPort]bool, len(ports)),
+	}
+	for _, p := range ports {
+		s.watch[p] = true
+	}
+	return s
+}
+
+// Sample implements Sampler
+func (s *socketSampler) Sample(stat *PerfStat) error {
+	var errs []error
+	if len(s.ports) > 0 {
+		socks := make(map[string]SocketStat, len(s.ports))
+		// watched ports without sockets are reported as zero
+		for _, p := range s.ports {
+			socks[p.String()] = SocketStat{}
+		}
+		for _, name := range []string{"tcp", "tcp6", "udp", "udp6"} {
+			if err := readNetSockets(name, s.watch, socks); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		stat.Sockets = socks
+	}
+
+	now := sampleTime(stat)
+	udp, err := readSnmpUDP()
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	if sec := now.Sub(s.lastTs).Seconds(); s.lastUDP != nil && sec > 0 {
+		rate := func(k string) float32 {
+			if udp[k] < s.lastUDP[k] {
+				return 0
+			}
+			return float32(float64(udp[k]-s.lastUDP[k]) / sec)
+		}
+		stat.UDP = &UDPStat{
+			InDatagrams:  rate("InDatagrams"),
+			OutDatagrams: rate("OutDatagrams"),
+			NoPorts:      rate("NoPorts"),
+			InErrors:     rate("InErrors"),
+			RcvbufErrors: rate("RcvbufErrors"),
+			SndbufErrors: rate("SndbufErrors"),
+		}
+	}
+	s.lastTs = now
+	s.lastUDP = udp
+	return errors.Join(errs...)
+}
@@ -0,0 +1,87 @@
+package sysinfo
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// tcpHeader is the header line of /proc/net/tcp and /proc/net/tcp6
+const tcpHeader = "  sl  local_address rem_address   st tx_queue rx_queue tr " +
+	"tm->when retrnsmt   uid  timeout inode\n"
+
+// writeSnmpFixture writes /proc/net/snmp with the UDP counters
+func writeSnmpFixture(root string, in, rcvbuf uint64) {
+	writeFixture(root, "net/snmp", fmt.Sprintf(
+		"Ip: Forwarding DefaultTTL\nIp: 1 64\n"+
+			"Udp: InDatagrams NoPorts InErrors OutDatagrams RcvbufErrors "+
+			"SndbufErrors InCsumErrors\n"+
+			"Udp: %d 4 %d 50 %d 0 0\n", in, rcvbuf, rcvbuf))
+}
+
+func TestSocketSampler(t *testing.T) {
+	Convey("Test parsing socket ports", t, func() {
+		p, err := ParseSocketPort("tcp/25565")
+		So(err, ShouldBeNil)
+		So(p, ShouldResemble, SocketPort{Proto: "tcp", Port: 25565})
+		So(p.String(), ShouldEqual, "tcp/25565")
+		for _, s := range []string{"25565", "sctp/1", "udp/70000", "tcp/"} {
+			_, err = ParseSocketPort(s)
+			So(errors.Is(err, ErrSocketPort), ShouldBeTrue)
+		}
+	})
+
+	Convey("Test socket sampler", t, func() {
+		root := t.TempDir()
+		procfs := ProcfsRoot
+		ProcfsRoot = root
+		defer func() { ProcfsRoot = procfs }()
+		// 25565 is 63DD, 8211 is 2013
+		writeFixture(root, "net/tcp", tcpHeader+
+			"   0: 00000000:63DD 00000000:0000 0A 00000000:00000000 "+
+			"00:00000000 00000000  1000        0 1 1 0 100 0 0 10 0\n"+
+			"   1: 0100000A:63DD 0200000A:C350 01 00000000:00000010 "+
+			"00:00000000 00000000  1000        0 2 1 0 20 4 30 10 -1\n"+
+			"   2: 0100000A:63DD 0300000A:C351 06 00000000:00000000 "+
+			"00:00000000 00000000     0        0 0 1 0 20 4 30 10 -1\n"+
+			"   3: 0100007F:0016 0100007F:C352 01 00000000:00000000 "+
+			"00:00000000 00000000     0        0 3 1 0 20 4 30 10 -1\n")
+		writeFixture(root, "net/tcp6", tcpHeader+
+			"   0: 00000000000000000000000001000000:63DD "+
+			"00000000000000000000000002000000:C353 08 00000000:00000000 "+
+			"00:00000000 00000000  1000        0 4 1 0 20 4 30 10 -1\n")
+		writeFixture(root, "net/udp",
+			"   sl  local_address rem_address   st tx_queue rx_queue tr "+
+				"tm->when retrnsmt   uid  timeout inode ref pointer drops\n"+
+				"  100: 00000000:2013 00000000:0000 07 00000000:00000200 "+
+				"00:00000000 00000000  1000        0 5 2 0000000000000000 42\n")
+		writeSnmpFixture(root, 1000, 2)
+
+		s := NewSocketSampler(
+			SocketPort{Proto: "tcp", Port: 25565},
+			SocketPort{Proto: "udp", Port: 8211},
+			SocketPort{Proto: "udp", Port: 27015},
+		)
+		var stat PerfStat
+		So(s.Sample(&stat), ShouldBeNil)
+		So(stat.UDP, ShouldBeNil)
+		So(stat.Sockets, ShouldResemble, map[string]SocketStat{
+			"tcp/25565": {Total: 4, Listen: 1, Established: 1, TimeWait: 1,
+				CloseWait: 1, RxQueue: 16},
+			"udp/8211":  {Total: 1, RxQueue: 512, Drops: 42},
+			"udp/27015": {},
+		})
+
+		s.(*socketSampler).lastTs = time.Now().Add(-2 * time.Second)
+		writeSnmpFixture(root, 3000, 12)
+		stat = PerfStat{}
+		So(s.Sample(&stat), ShouldBeNil)
+		So(stat.UDP, ShouldNotBeNil)
+		So(stat.UDP.InDatagrams, ShouldAlmostEqual, 1000, 10)
+		So(stat.UDP.RcvbufErrors, ShouldAlmostEqual, 5, 0.1)
+		So(stat.UDP.NoPorts, ShouldEqual, 0)
+	})
+}
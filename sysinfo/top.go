@@ -0,0 +1,169 @@
+package sysinfo
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/user"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrTopOrder = errors.New("invalid order of top processes")
+)
+
+// orders of top processes
+const (
+	TopByCPU = "cpu"
+	TopByMem = "mem"
+)
+
+// TopProc is a process of the top listing
+type TopProc struct {
+	Pid     int     `json:"pid"`
+	Name    string  `json:"name"`
+	User    string  `json:"user"`
+	Cmdline string  `json:"cmdline"`
+	CPU     float32 `json:"cpu"` // percent of a single core
+	RSS     uint64  `json:"rss"`
+	// StartTime is the unix time in milliseconds when the process started
+	StartTime int64 `json:"start_time"`
+}
+
+// TopProcs returns the top n processes ordered by TopByCPU or TopByMem, or
+// all processes if n is not positive. CPU usage is computed from two
+// samples of /proc taken the interval apart, so it blocks for the
+// interval, or until the context is done.
+func TopProcs(
+	ctx context.Context,
+	by string,
+	n int,
+	interval time.Duration,
+) ([]TopProc, error) {
+	if by != TopByCPU && by != TopByMem {
+		return nil, ErrTopOrder
+	}
+	start := time.Now()
+	prev, err := readAllPidStat()
+	if err != nil {
+		return nil, err
+	}
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+	}
+	cur, err := readAllPidStat()
+	if err != nil {
+		return nil, err
+	}
+	ret := rankProcs(prev, cur, time.Since(start).Seconds(), by, n)
+
+	// details are only read for the listed processes
+	var btime int64
+	if f, err := readProcFields(procPath("stat")); err == nil {
+		btime = int64(parseUint(f["btime"]))
+	}
+	for i := range ret {
+		p := &ret[i]
+		p.StartTime = btime*1000 +
+			int64(cur[p.Pid].starttime)*1000/procClockTicks
+		p.User, p.Cmdline = readProcOwner(p.Pid, p.Name)
+	}
+	return ret, nil
+}
+
+// readAllPidStat reads the stat of all processes keyed by pid, processes
+// exiting while reading are skipped
+func readAllPidStat() (map[int]pidStat, error) {
+	entries, err := os.ReadDir(procPath())
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[int]pidStat, len(entries))
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil || !e.IsDir() {
+			continue
+		}
+		if st, err := readPidStat(pid); err == nil {
+			ret[pid] = st
+		}
+	}
+	return ret, nil
+}
+
+// rankProcs computes the CPU usage between two samples taken sec seconds
+// apart, and returns the top n processes of the latter sample without the
+// details. Processes missing from the former sample, or whose pid is
+// reused, have no CPU usage.
+func rankProcs(
+	prev, cur map[int]pidStat,
+	sec float64,
+	by string,
+	n int,
+) []TopProc {
+	pageSize := uint64(os.Getpagesize())
+	ret := make([]TopProc, 0, len(cur))
+	for pid, st := range cur {
+		p := TopProc{Pid: pid, Name: st.comm, RSS: st.rss * pageSize}
+		if pv, ok := prev[pid]; ok && pv.starttime == st.starttime &&
+			sec > 0 {
+			ticks := st.utime + st.stime
+			if pt := pv.utime + pv.stime; ticks >= pt {
+				p.CPU = float32(float64(ticks-pt) / procClockTicks / sec * 100)
+			}
+		}
+		ret = append(ret, p)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		a, b := ret[i], ret[j]
+		if by == TopByCPU && a.CPU != b.CPU {
+			return a.CPU > b.CPU
+		}
+		if a.RSS != b.RSS {
+			return a.RSS > b.RSS
+		}
+		return a.Pid < b.Pid
+	})
+	if n > 0 && len(ret) > n {
+		ret = ret[:n]
+	}
+	return ret
+}
+
+// cache of user names by uid
+var userNames sync.Map
+
+// readProcOwner reads the user name and the command line of a process,
+// kernel threads without a command line are shown as [name]
+func readProcOwner(pid int, name string) (string, string) {
+	dir := strconv.Itoa(pid)
+	var owner string
+	if status, err := readProcFields(procPath(dir, "status")); err == nil {
+		// the first field of Uid is the real uid
+		uid := status["Uid"]
+		if v, ok := userNames.Load(uid); ok {
+			owner = v.(string)
+		} else if uid != "" {
+			owner = uid
+			if u, err := user.LookupId(uid); err == nil {
+				owner = u.Username
+			}
+			userNames.Store(uid, owner)
+		}
+	}
+	cmdline := "[" + name + "]"
+	if data, err := os.ReadFile(procPath(dir, "cmdline")); err == nil {
+		if s := strings.TrimRight(string(data), "\x00"); s != "" {
+			cmdline = strings.ReplaceAll(s, "\x00", " ")
+		}
+	}
+	return owner, cmdline
+}
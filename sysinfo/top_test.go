@@ -0,0 +1,74 @@
+package sysinfo
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTopProcs(t *testing.T) {
+	Convey("Test ranking processes", t, func() {
+		prev := map[int]pidStat{
+			1: {comm: "init", utime: 100, stime: 100, starttime: 1, rss: 10},
+			2: {comm: "pal", utime: 1000, stime: 0, starttime: 5, rss: 300},
+			3: {comm: "reused", utime: 0, stime: 0, starttime: 7, rss: 20},
+		}
+		cur := map[int]pidStat{
+			1: {comm: "init", utime: 110, stime: 110, starttime: 1, rss: 10},
+			2: {comm: "pal", utime: 1150, stime: 50, starttime: 5, rss: 300},
+			3: {comm: "reused", utime: 500, stime: 0, starttime: 9, rss: 20},
+			4: {comm: "new", utime: 50, stime: 0, starttime: 11, rss: 500},
+		}
+		top := rankProcs(prev, cur, 2, TopByCPU, 2)
+		So(top, ShouldHaveLength, 2)
+		So(top[0].Pid, ShouldEqual, 2)
+		So(top[0].CPU, ShouldEqual, 100)
+		So(top[1].Pid, ShouldEqual, 1)
+		So(top[1].CPU, ShouldEqual, 10)
+
+		top = rankProcs(prev, cur, 2, TopByMem, 0)
+		So(top, ShouldHaveLength, 4)
+		So(top[0].Pid, ShouldEqual, 4)
+		So(top[0].RSS, ShouldEqual, 500*uint64(os.Getpagesize()))
+		So(top[0].CPU, ShouldEqual, 0)
+		So(top[1].Pid, ShouldEqual, 2)
+		So(top[3].Pid, ShouldEqual, 1)
+	})
+
+	Convey("Test listing top processes", t, func() {
+		root := t.TempDir()
+		procfs := ProcfsRoot
+		ProcfsRoot = root
+		defer func() { ProcfsRoot = procfs }()
+		writeFixture(root, "stat", "cpu  1 2 3 4\nbtime 1760000000\n")
+		writePidFixture(root, 42, 100, 10, 0)
+		writeFixture(root, "42/status", "Name:\tPalServer\nUid:\t0\t0\t0\t0\n")
+		writeFixture(root, "42/cmdline", "./PalServer.sh\x00-port=8211\x00")
+		writePidFixture(root, 2, 0, 0, 0)
+		writeFixture(root, "2/stat",
+			"2 (kthreadd) S 0 0 0 0 -1 0 0 0 0 0 0 0 0 0 20 0 1 0 2 0 0")
+		writeFixture(root, "self/stat", "ignored")
+
+		_, err := TopProcs(context.Background(), "io", 10, 0)
+		So(err, ShouldEqual, ErrTopOrder)
+
+		top, err := TopProcs(context.Background(), TopByMem, 10,
+			10*time.Millisecond)
+		So(err, ShouldBeNil)
+		So(top, ShouldHaveLength, 2)
+		So(top[0].Pid, ShouldEqual, 42)
+		So(top[0].Name, ShouldEqual, "Pal Server (x)")
+		So(top[0].User, ShouldEqual, "root")
+		So(top[0].Cmdline, ShouldEqual, "./PalServer.sh -port=8211")
+		So(top[0].StartTime, ShouldEqual, 1760000000000+5000*10)
+		So(top[1].Cmdline, ShouldEqual, "[kthreadd]")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = TopProcs(ctx, TopByCPU, 10, time.Hour)
+		So(err, ShouldEqual, context.Canceled)
+	})
+}
@@ -0,0 +1,77 @@
+package taskmgr
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/w-sdc/mushroomant/log"
+)
+
+// EventType is the type of a task event
+type EventType string
+
+// Types of task events
+const (
+	EventTaskStart EventType = "task_start"
+	EventTaskExit  EventType = "task_exit"
+	EventTaskError EventType = "task_error"
+	// EventOperation is an operation requested by a user, such as a
+	// restart or a backup
+	EventOperation EventType = "operation"
+)
+
+// Event is a lifecycle event of a task or an operation
+type Event struct {
+	TS    time.Time
+	Type  EventType
+	Task  string // name of the task
+	Pid   int    // pid of the process, 0 if not applicable
+	Text  string // human readable description
+	Trace log.TraceScope
+}
+
+// EventHandler receives task events
+type EventHandler func(e Event)
+
+var (
+	mtxHandlers sync.RWMutex
+	handlers    = make(map[int]EventHandler)
+	nextHandler int
+)
+
+// OnEvent registers a handler of task events. Handlers are called
+// synchronously and should not block. The returned function unregisters
+// the handler.
+func OnEvent(h EventHandler) func() {
+	mtxHandlers.Lock()
+	defer mtxHandlers.Unlock()
+	id := nextHandler
+	nextHandler++
+	handlers[id] = h
+	return func() {
+		mtxHandlers.Lock()
+		defer mtxHandlers.Unlock()
+		delete(handlers, id)
+	}
+}
+
+// Emit publishes an event to all handlers. The timestamp is filled if it
+// is zero, and the trace is taken from the context.
+func Emit(ctx context.Context, e Event) {
+	if e.TS.IsZero() {
+		e.TS = time.Now()
+	}
+	if e.Trace == nil {
+		e.Trace = log.GetTrace(ctx)
+	}
+	mtxHandlers.RLock()
+	hs := make([]EventHandler, 0, len(handlers))
+	for _, h := range handlers {
+		hs = append(hs, h)
+	}
+	mtxHandlers.RUnlock()
+	for _, h := range hs {
+		h(e)
+	}
+}
@@ -0,0 +1,39 @@
+package taskmgr
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/w-sdc/mushroomant/log"
+)
+
+func TestEvent(t *testing.T) {
+	Convey("Test task events", t, func() {
+		var got1, got2 []Event
+		off1 := OnEvent(func(e Event) { got1 = append(got1, e) })
+		off2 := OnEvent(func(e Event) { got2 = append(got2, e) })
+		defer off2()
+
+		ctx := log.WithTrace(context.Background(), "restart")
+		Emit(ctx, Event{Type: EventOperation, Text: "restart by alice"})
+		So(got1, ShouldHaveLength, 1)
+		So(got2, ShouldHaveLength, 1)
+		So(got1[0].Type, ShouldEqual, EventOperation)
+		So(got1[0].TS.IsZero(), ShouldBeFalse)
+		So(got1[0].Trace, ShouldResemble, log.GetTrace(ctx))
+
+		ts := time.UnixMilli(1760000000000)
+		Emit(context.Background(), Event{TS: ts, Type: EventTaskExit})
+		So(got1[1].TS, ShouldEqual, ts)
+		So(got1[1].Trace, ShouldBeEmpty)
+
+		// unsubscribed handlers receive no more events
+		off1()
+		off1()
+		Emit(context.Background(), Event{Type: EventTaskStart})
+		So(got1, ShouldHaveLength, 2)
+		So(got2, ShouldHaveLength, 3)
+	})
+}
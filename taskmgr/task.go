@@ -2,7 +2,10 @@ package taskmgr
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"os"
+	"os/exec"
 )
 
 type procStatus int
@@ -24,4 +27,66 @@ type process struct {
 	stdinSrc  io.Reader
 	stdoutDst io.WriteCloser
 	stderrDst io.WriteCloser
+	done      chan struct{} // closed when the process has exited
+}
+
+// start launches the process as the task name. The process is killed when
+// ctx is done.
+// EventTaskStart is emitted once it is started, then EventTaskExit or
+// EventTaskError when it ends, or EventTaskError if it fails to start.
+func (p *process) start(name string) error {
+	if p.ctx == nil {
+		p.ctx = context.Background()
+	}
+	cmd := exec.CommandContext(p.ctx, p.cmd, p.args...)
+	if len(p.envs) > 0 {
+		cmd.Env = os.Environ()
+		for k, v := range p.envs {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+	}
+	cmd.Stdin = p.stdinSrc
+	cmd.Stdout = p.stdoutDst
+	cmd.Stderr = p.stderrDst
+	p.done = make(chan struct{})
+	if err := cmd.Start(); err != nil {
+		p.status = procStatusError
+		p.retcode = -1
+		close(p.done)
+		Emit(p.ctx, Event{Type: EventTaskError, Task: name,
+			Text: fmt.Sprintf("%s failed to start: %v", name, err)})
+		return err
+	}
+	p.pid = cmd.Process.Pid
+	p.status = procStatusRunning
+	Emit(p.ctx, Event{Type: EventTaskStart, Task: name, Pid: p.pid,
+		Text: fmt.Sprintf("%s started", name)})
+	go p.wait(name, cmd)
+	return nil
+}
+
+// wait waits for the process to exit and records the result.
+func (p *process) wait(name string, cmd *exec.Cmd) {
+	err := cmd.Wait()
+	p.retcode = -1
+	if cmd.ProcessState != nil {
+		p.retcode = cmd.ProcessState.ExitCode()
+	}
+	e := Event{Type: EventTaskExit, Task: name, Pid: p.pid,
+		Text: fmt.Sprintf("%s exited", name)}
+	if err != nil {
+		p.status = procStatusError
+		e.Type = EventTaskError
+		e.Text = fmt.Sprintf("%s failed: %v", name, err)
+	} else {
+		p.status = procStatusDone
+	}
+	Emit(p.ctx, e)
+	if p.stdoutDst != nil {
+		p.stdoutDst.Close()
+	}
+	if p.stderrDst != nil {
+		p.stderrDst.Close()
+	}
+	close(p.done)
 }
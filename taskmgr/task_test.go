@@ -0,0 +1,63 @@
+package taskmgr
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestProcess(t *testing.T) {
+	Convey("Test process lifecycle", t, func() {
+		var events []Event
+		off := OnEvent(func(e Event) {
+			if e.Task != "" {
+				events = append(events, e)
+			}
+		})
+		defer off()
+
+		Convey("The task is killed when the context is done", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			p := &process{ctx: ctx, cmd: "sleep", args: []string{"10"}}
+			So(p.start("sleeper"), ShouldBeNil)
+			So(p.pid, ShouldBeGreaterThan, 0)
+
+			cancel()
+			<-p.done
+			So(p.status, ShouldEqual, procStatusError)
+			So(events, ShouldHaveLength, 2)
+			So(events[0].Type, ShouldEqual, EventTaskStart)
+			So(events[0].Pid, ShouldEqual, p.pid)
+			So(events[1].Type, ShouldEqual, EventTaskError)
+			So(events[1].Task, ShouldEqual, "sleeper")
+		})
+
+		Convey("Exit code is recorded", func() {
+			p := &process{cmd: "sh", args: []string{"-c", "exit 3"}}
+			So(p.start("exiter"), ShouldBeNil)
+			<-p.done
+			So(p.status, ShouldEqual, procStatusError)
+			So(p.retcode, ShouldEqual, 3)
+
+			p = &process{cmd: "true"}
+			So(p.start("exiter"), ShouldBeNil)
+			<-p.done
+			So(p.status, ShouldEqual, procStatusDone)
+			So(p.retcode, ShouldEqual, 0)
+			So(events, ShouldHaveLength, 4)
+			So(events[3].Type, ShouldEqual, EventTaskExit)
+			So(events[3].Text, ShouldEqual, "exiter exited")
+		})
+
+		Convey("Failed start is reported", func() {
+			p := &process{cmd: "/nonexistent/command"}
+			So(p.start("missing"), ShouldNotBeNil)
+			So(p.status, ShouldEqual, procStatusError)
+			So(events, ShouldHaveLength, 1)
+			So(events[0].Type, ShouldEqual, EventTaskError)
+			So(events[0].Pid, ShouldEqual, 0)
+		})
+	})
+}